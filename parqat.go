@@ -1,12 +1,32 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
 	"github.com/spf13/cobra"
+
+	"parqat/pkg/parqat"
 )
 
 /*
@@ -41,9 +61,28 @@ Examples:
   cat data.json | parqat -o data.parquet              # JSON to Parquet (default settings)
   cat data.json | parqat --streaming -o data.parquet  # Streaming mode for large files
   cat data.json | parqat --compression snappy -o data.parquet  # Use Snappy compression
+  parqat --list-codecs                                 # Names --compression accepts
   parqat data.parquet                                  # Parquet to JSON
   parqat data.parquet --head 10                        # First 10 rows
   parqat data.parquet --tail 5                         # Last 5 rows
+  parqat data.parquet --sample 100 --seed 42           # 100 random rows, reproducibly
+  parqat data.parquet --rows 10234-10240               # Just these rows, e.g. around a bad record
+  parqat data.parquet --format tsv                     # Tab-separated with a header row
+  cat data.parquet | parqat --head 5                   # Parquet on stdin is detected and read
+  parqat https://host/data.parquet --head 5            # Remote file, fetched with range requests
+  parqat --count a.parquet b.parquet                   # Total row count from file footers
+  parqat data.parquet --count-by region                # Rows per distinct region
+  parqat data.parquet --where "region == 'eu'"         # Only matching rows; other row groups are skipped
+  parqat data.parquet --cast id:string,ts:epoch_millis # Big IDs as text, times as numbers
+  parqat merge a.parquet b.parquet -o all.parquet      # Combine files without a JSON round trip
+  parqat --validate data.parquet                       # Exit non-zero if the file is unreadable
+  parqat --layout data.parquet                         # Row group and column chunk sizes
+  parqat --verify-stats data.parquet                   # Check stored min/max/null counts
+  parqat --profile data.parquet                        # Numeric column summaries as JSON
+  parqat --show-created-by data.parquet                # Which writer made the file
+  parqat --compact small-groups.parquet -o out.parquet # Rewrite with large row groups
+  parqat --repair cut-off.parquet --schema schema.json # Recover rows from a file without a footer
+  parqat --schema-merge day1.json day2.json -o out/    # One schema for files whose types drift
   echo '{"name":"John","tags":["user","admin"]}' | parqat > data.parquet  # Complex JSON
 
 Performance Options:
@@ -53,55 +92,885 @@ Performance Options:
   --streaming: Enable for large datasets (uses temp files)
 
 Created by ` + company + ` - https://github.com/syntropiq/parqat`,
-	Args: cobra.MaximumNArgs(1),
+	// The file counts are checked in RunE, once PersistentPreRunE has applied the defaults file
+	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 0 {
-			// File provided - convert Parquet to JSON
-			return FromParquetFile(os.Stdout, args[0], head, tail)
+		if err := checkRootArgs(cmd, args); err != nil {
+			return inStage("usage", err)
+		}
+		if teePath != "" && (listCodecs || listEncoding || countRows || validate || validateDeep || verifyStats || profile || layout || showMeta || showCreated) {
+			// These print reports, not converted rows, so there'd be nothing worth a copy
+			return inStage("usage", fmt.Errorf("--tee only copies converted output; it cannot be combined with --count, --validate, --validate-deep, --verify-stats, --profile, --layout, --show-meta, --show-created-by or the --list flags"))
+		}
+		if listCodecs || listEncoding {
+			if listCodecs && listEncoding {
+				return inStage("usage", fmt.Errorf("--list-codecs and --list-encodings cannot be combined"))
+			}
+			// The names come from the tables the flags are checked against, so they can't go stale
+			names := codecNames()
+			if listEncoding {
+				names = parqat.EncodingNames()
+			}
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return nil
 		}
-		// No file - convert JSON from stdin to Parquet
 
-		// Validate that head/tail aren't used when converting JSON to Parquet
-		if head > 0 || tail > 0 {
-			return fmt.Errorf("--head and --tail flags can only be used when reading parquet files")
+		if maxOpenFiles < 0 || maxGoroutines < 0 {
+			return inStage("usage", fmt.Errorf("--max-open-files and --max-goroutines want a positive number, or 0 for GOMAXPROCS"))
 		}
 
-		var w io.Writer
-		if outputPath == "" {
-			w = os.Stdout
-		} else {
-			file, err := os.Create(outputPath)
+		if countRows {
+			// Counts come straight from the footers, no row data is decoded
+			counts, err := readEach(args, func(path string) (int64, error) { return parqat.CountParquetFiles(path) })
+			if err != nil {
+				return inStage("read", err)
+			}
+			var total int64
+			for _, count := range counts {
+				total += count
+			}
+			fmt.Println(total)
+			return nil
+		}
+
+		if layout {
+			// Sizes come from the footers and page indexes, no row data is decoded
+			layouts, err := readEach(args, parqat.DescribeLayout)
+			if err != nil {
+				return inStage("read", err)
+			}
+			for i, path := range args {
+				described := layouts[i]
+				if len(args) > 1 {
+					fmt.Printf("%s:\n", path)
+				}
+				if err := described.Describe(os.Stdout); err != nil {
+					return inStage("read", err)
+				}
+			}
+			return nil
+		}
+
+		if showMeta {
+			// Descriptions come from the footers, no row data is decoded
+			metas, err := readEach(args, parqat.ColumnMeta)
+			if err != nil {
+				return inStage("read", err)
+			}
+			for i, path := range args {
+				described := metas[i]
+				if len(args) > 1 {
+					fmt.Printf("%s:\n", path)
+				}
+				for _, column := range described {
+					fmt.Printf("%s\t%s\n", column.Name, column.Description)
+				}
+			}
+			return nil
+		}
+
+		if showCreated {
+			// Read from the footers, no row data is decoded
+			creators, err := readEach(args, parqat.CreatedBy)
+			if err != nil {
+				return inStage("read", err)
+			}
+			for i, path := range args {
+				created := creators[i]
+				if len(args) > 1 {
+					fmt.Printf("%s: ", path)
+				}
+				fmt.Println(created)
+			}
+			return nil
+		}
+
+		if validate || validateDeep {
+			// Nothing is written on success; the exit status is the verdict
+			_, err := readEach(args, func(path string) (struct{}, error) {
+				return struct{}{}, parqat.ValidateParquetFile(path, validateDeep)
+			})
+			return inStage("read", err)
+		}
+
+		if verifyStats {
+			// Every mismatch of every file is listed before the verdict
+			var mismatched int
+			verified, err := readEach(args, parqat.VerifyStats)
+			if err != nil {
+				return inStage("read", err)
+			}
+			for i, path := range args {
+				mismatches := verified[i]
+				for _, mismatch := range mismatches {
+					if len(args) > 1 {
+						fmt.Printf("%s: ", path)
+					}
+					fmt.Println(mismatch)
+				}
+				mismatched += len(mismatches)
+			}
+			if mismatched > 0 {
+				return inStage("read", fmt.Errorf("%d statistics don't match the data", mismatched))
+			}
+			return nil
+		}
+
+		if profile {
+			// One JSON object per file, for a data-quality dashboard to ingest
+			enc := json.NewEncoder(os.Stdout)
+			profiles, err := readEach(args, func(path string) (*parqat.FileProfile, error) {
+				return parqat.ProfileParquetFile(path, parqat.ReaderConfig{Sample: sampleSize, Seed: sampleSeed})
+			})
+			if err != nil {
+				return inStage("read", err)
+			}
+			for _, profiled := range profiles {
+				if err := enc.Encode(profiled); err != nil {
+					return inStage("read", err)
+				}
+			}
+			return nil
+		}
+
+		if compact {
+			return compactFile(args[0])
+		}
+
+		if repair {
+			return repairFile(cmd, args[0])
+		}
+
+		if schemaMerge {
+			return mergeSchemaFiles(cmd, args)
+		}
+
+		switch direction {
+		case "auto", "read", "write":
+		default:
+			return inStage("usage", fmt.Errorf("invalid --direction %q: want auto, read or write", direction))
+		}
+		if direction == "read" && inputGzip {
+			return inStage("usage", fmt.Errorf("--input-gzip cannot be combined with --direction read"))
+		}
+
+		var input io.Reader = os.Stdin
+		if len(args) > 0 {
+			gzipped := inputGzip || direction == "write"
+			if !gzipped && direction == "auto" && !parqat.IsURL(args[0]) {
+				var err error
+				if gzipped, err = parqat.IsGzipFile(args[0]); err != nil {
+					return inStage("read", err)
+				}
+			}
+			if !gzipped {
+				// File provided - convert Parquet to JSON
+				return readOutput(cmd, func(w io.Writer, config parqat.ReaderConfig) error {
+					return parqat.FromParquetFileWithConfig(w, args[0], config)
+				})
+			}
+
+			// Gzipped file (or --direction write) provided - it holds JSON, convert it to Parquet
+			file, err := os.Open(args[0])
 			if err != nil {
-				return fmt.Errorf("creating output file: %w", err)
+				return inStage("read", fmt.Errorf("opening file %s: %w", args[0], err))
 			}
 			defer file.Close()
-			w = file
+			input = file
+		} else if direction != "write" && !inputGzip {
+			// Parquet piped into stdin is read like a file, once it is buffered or spooled to disk
+			sniffed, isParquet, err := parqat.SniffParquet(input)
+			if err != nil {
+				return inStage("read", err)
+			}
+			if isParquet || direction == "read" {
+				return readOutput(cmd, func(w io.Writer, config parqat.ReaderConfig) error {
+					return parqat.FromParquetWithConfig(w, sniffed, config)
+				})
+			}
+			input = sniffed
+		}
+		// No Parquet input - convert JSON to Parquet
+
+		// Validate that sample/row-group aren't used when converting JSON to Parquet; head and
+		// tail select input records here as they select rows when reading
+		if sampleSize > 0 || len(rowGroups) > 0 || rowOffset > 0 || rowLength > 0 || rowRange != "" {
+			return inStage("usage", fmt.Errorf("--sample, --offset, --length, --rows and --row-group flags can only be used when reading parquet files"))
+		}
+		if len(columns) > 0 || len(excludeColumns) > 0 || flatten || explode != "" || countBy != "" || len(casts) > 0 || where != "" {
+			return inStage("usage", fmt.Errorf("--columns, --exclude, --flatten, --explode, --count-by, --cast and --where can only be used when reading parquet files"))
+		}
+		if outputFormat != parqat.FormatJSON || (delimiter != "" && inputFormat != "csv") {
+			return inStage("usage", fmt.Errorf("--format and --delimiter can only be used when reading parquet files (or --delimiter with --input-format csv)"))
 		}
 
 		// Create writer configuration from command line flags
-		config := createWriterConfig()
+		config, err := createWriterConfig()
+		if err != nil {
+			return inStage("usage", err)
+		}
+		defer reportRowCounts()
+
+		// Spool files go into a directory of this run's own, removed as a whole on the way out
+		dir, cleanup, err := processTempDir(config.TempDir)
+		if err != nil {
+			return inStage("write", err)
+		}
+		defer cleanup()
+		config.TempDir = dir
+
+		input, err = parqat.DecompressInput(input, inputGzip)
+		if err != nil {
+			return inStage("read", err)
+		}
+		if input, err = convertInput(cmd, input); err != nil {
+			return inStage("usage", err)
+		}
+
+		if dryRun {
+			// Report the plan instead of writing anything
+			plan, err := parqat.PlanParquet(input, config, enableStreaming)
+			if err != nil {
+				return inStage("plan", err)
+			}
+			return plan.Describe(os.Stderr)
+		}
+
+		if manifestPath != "" && (outputPath == "" || config.PartitionBy != "" || config.MaxFileBytes > 0) {
+			return inStage("usage", fmt.Errorf("--manifest requires a single output file (-o), not --partition-by, --max-file-bytes or stdout"))
+		}
+		stop, release := stopOnInterrupt()
+		defer release()
+		config.Stop = stop
+		if err := writeOutput(input, config); err != nil {
+			return inStage("write", err)
+		}
+		select {
+		case <-stop:
+			return inStage("write", errInterrupted)
+		default:
+		}
+		if manifestPath != "" {
+			return inStage("manifest", parqat.WriteManifest(manifestPath, outputPath))
+		}
+		return nil
+	},
+}
 
-		if enableStreaming {
-			return StreamingToParquet(w, os.Stdin, config)
+// checkRootArgs checks the number of files given against the modes that read several or exactly one.
+func checkRootArgs(cmd *cobra.Command, args []string) error {
+	if countRows || validate || validateDeep || verifyStats || profile || layout || showMeta || showCreated || schemaMerge {
+		return cobra.MinimumNArgs(1)(cmd, args)
+	}
+	if compact || repair {
+		return cobra.ExactArgs(1)(cmd, args)
+	}
+	return cobra.MaximumNArgs(1)(cmd, args)
+}
+
+// mergeCmd combines Parquet files without a round trip through JSON.
+var mergeCmd = &cobra.Command{
+	Use:   "merge file.parquet... -o merged.parquet",
+	Short: "Combine Parquet files with compatible schemas into one file",
+	Long: `Combine Parquet files into one, in the order given, with the first file's schema.
+Rows are copied as Parquet values, which is much faster than converting to JSON and back,
+though their pages are still decoded and re-encoded with --compression, --encoding and the
+other writer flags given.
+Files whose schema differs must be compatible: no columns the first file lacks, the same
+types, and no nulls in columns the first file requires.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if mergeOutput == "" {
+			return inStage("usage", fmt.Errorf("merge requires an output file (-o)"))
+		}
+		if compressionType == "auto" {
+			return inStage("usage", fmt.Errorf("merge needs a --compression codec; auto works on JSON input"))
+		}
+		config, err := createWriterConfig()
+		if err != nil {
+			return inStage("usage", err)
+		}
+		if out, err := os.Stat(mergeOutput); err == nil {
+			for _, path := range args {
+				if in, err := os.Stat(path); err == nil && os.SameFile(in, out) {
+					return inStage("usage", fmt.Errorf("the output %s is also an input", mergeOutput))
+				}
+			}
+		}
+
+		file, err := os.Create(mergeOutput)
+		if err != nil {
+			return inStage("write", fmt.Errorf("creating output file: %w", err))
+		}
+		defer file.Close()
+		if err := parqat.MergeParquetFiles(file, args, config); err != nil {
+			file.Close()
+			os.Remove(mergeOutput) // Don't leave a partial file behind
+			return inStage("write", err)
 		}
-		return ToParquetWithConfig(w, os.Stdin, config)
+		return inStage("write", file.Close())
 	},
 }
 
+/*
+compactFile rewrites the Parquet file at path to -o with the writer flags, reporting the row
+group count and size before and after to stderr.
+*/
+func compactFile(path string) error {
+	if outputPath == "" {
+		return inStage("usage", fmt.Errorf("--compact requires an output file (-o)"))
+	}
+	if in, err := os.Stat(path); err == nil {
+		if out, err := os.Stat(outputPath); err == nil && os.SameFile(in, out) {
+			return inStage("usage", fmt.Errorf("--compact cannot rewrite %s in place; write to another file and rename it", path))
+		}
+	}
+	config, err := createWriterConfig()
+	if err != nil {
+		return inStage("usage", err)
+	}
+	before, err := parqat.DescribeParquetFile(path)
+	if err != nil {
+		return inStage("read", err)
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return inStage("write", fmt.Errorf("creating output file: %w", err))
+	}
+	defer file.Close()
+	if err := parqat.CompactParquetFile(file, path, config); err != nil {
+		file.Close()
+		os.Remove(outputPath) // Don't leave a partial file behind
+		return inStage("write", err)
+	}
+	if err := file.Close(); err != nil {
+		return inStage("write", err)
+	}
+
+	after, err := parqat.DescribeParquetFile(outputPath)
+	if err != nil {
+		return inStage("read", err)
+	}
+	fmt.Fprintf(os.Stderr, "compacted %s: %d row groups, %d bytes -> %d row groups, %d bytes\n",
+		path, before.RowGroups, before.FileSize, after.RowGroups, after.FileSize)
+	return nil
+}
+
+/*
+repairFile writes the rows recoverable from the damaged Parquet file at path as the reader flags
+ask, then warns on stderr that the result is best-effort and how much of the file it covers.
+*/
+func repairFile(cmd *cobra.Command, path string) error {
+	var schema *parqat.SchemaFile
+	if schemaPath != "" {
+		var err error
+		if schema, err = parqat.LoadSchemaFile(schemaPath); err != nil {
+			return inStage("usage", err)
+		}
+	}
+
+	var report parqat.RepairReport
+	err := readOutput(cmd, func(w io.Writer, config parqat.ReaderConfig) (err error) {
+		report, err = parqat.RepairParquetFile(w, path, schema, config)
+		return err
+	})
+	switch {
+	case report.FooterIntact:
+		fmt.Fprintf(os.Stderr, "%s has an intact footer; read its %d rows as usual\n", path, report.Rows)
+	case report.RowGroups > 0:
+		fmt.Fprintf(os.Stderr, "warning: --repair is best-effort; recovered %d rows in %d row groups from the first %d of %d bytes of %s, rows after that are lost\n",
+			report.Rows, report.RowGroups, report.RecoveredBytes, report.FileSize, path)
+	}
+	return err
+}
+
+/*
+mergeSchemaFiles converts the JSON files at paths into the -o directory, each to a Parquet file
+of the same name, all with one schema inferred across them. The merged schema and the fields
+whose type it changed for some file are printed to stderr first.
+*/
+func mergeSchemaFiles(cmd *cobra.Command, paths []string) error {
+	if outputPath == "" {
+		return inStage("usage", fmt.Errorf("--schema-merge requires an output directory (-o)"))
+	}
+	if enableStreaming || appendMode || partitionBy != "" || maxFileBytes != "" || teePath != "" || manifestPath != "" || dryRun {
+		return inStage("usage", fmt.Errorf("--schema-merge cannot be combined with --streaming, --append, --partition-by, --max-file-bytes, --tee, --manifest or --dry-run"))
+	}
+	if inputFormat != "json" {
+		return inStage("usage", fmt.Errorf("--schema-merge requires JSON input"))
+	}
+	outputs := make([]string, len(paths))
+	inputs := make(map[string]string, len(paths))
+	for i, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".gz")
+		outputs[i] = filepath.Join(outputPath, strings.TrimSuffix(name, filepath.Ext(name))+".parquet")
+		if other, ok := inputs[outputs[i]]; ok {
+			return inStage("usage", fmt.Errorf("%s and %s would both be written to %s", other, path, outputs[i]))
+		}
+		inputs[outputs[i]] = path
+	}
+
+	config, err := createWriterConfig()
+	if err != nil {
+		return inStage("usage", err)
+	}
+	defer reportRowCounts()
+	dir, cleanup, err := processTempDir(config.TempDir)
+	if err != nil {
+		return inStage("write", err)
+	}
+	defer cleanup()
+	config.TempDir = dir
+
+	merged, err := parqat.MergeSchemaFiles(paths, config)
+	if err != nil {
+		return inStage("read", err)
+	}
+	if err := merged.Describe(os.Stderr); err != nil {
+		return inStage("read", err)
+	}
+	converter, err := parqat.NewConverter(config, merged.Schema)
+	if err != nil {
+		return inStage("usage", err)
+	}
+	if err := os.MkdirAll(outputPath, 0o755); err != nil {
+		return inStage("write", fmt.Errorf("creating output directory: %w", err))
+	}
+	for i, path := range paths {
+		if err := convertFile(converter, path, outputs[i]); err != nil {
+			return inStage("write", fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return nil
+}
+
+// convertFile converts the JSON file at path, which may be gzip-compressed, to output with converter.
+func convertFile(converter *parqat.Converter, path, output string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer in.Close()
+	input, err := parqat.DecompressInput(in, false)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer file.Close()
+	if err := converter.Convert(file, input); err != nil {
+		file.Close()
+		os.Remove(output) // Don't leave a partial file behind
+		return err
+	}
+	return file.Close()
+}
+
+// reportRowCounts prints to stderr how many input rows were skipped or dropped along the way.
+func reportRowCounts() {
+	if skippedRows > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d rows that were not JSON objects\n", skippedRows)
+	}
+	if droppedRows > 0 {
+		fmt.Fprintf(os.Stderr, "dropped %d rows with nulls in required columns\n", droppedRows)
+	}
+	if duplicateRows > 0 {
+		fmt.Fprintf(os.Stderr, "dropped %d duplicate rows\n", duplicateRows)
+	}
+	for _, field := range slices.Sorted(maps.Keys(defaultedValues)) {
+		fmt.Fprintf(os.Stderr, "substituted the default for %d nulls in %s\n", defaultedValues[field], field)
+	}
+	for _, fields := range slices.SortedFunc(maps.Keys(droppedKeys), func(a, b [2]string) int { return slices.Compare(a[:], b[:]) }) {
+		fmt.Fprintf(os.Stderr, "dropped %d values of %q for those of %q, normalized to the same name\n", droppedKeys[fields], fields[1], fields[0])
+	}
+}
+
+// convertInput turns the input into JSON rows according to --input-format.
+func convertInput(cmd *cobra.Command, input io.Reader) (io.Reader, error) {
+	switch inputFormat {
+	case "json":
+		for _, name := range []string{"bool-true", "bool-false", "null-token", "no-header", "names"} {
+			if cmd.Flags().Changed(name) {
+				return nil, fmt.Errorf("--%s requires --input-format csv", name)
+			}
+		}
+		return input, nil
+	case "csv":
+		config := parqat.DefaultCSVInputConfig()
+		config.TrueTokens, config.FalseTokens, config.NullTokens = boolTrue, boolFalse, nullTokens
+		if len(csvNames) > 0 && !noHeader {
+			return nil, fmt.Errorf("--names requires --no-header")
+		}
+		config.NoHeader, config.Names = noHeader, csvNames
+		if delimiter != "" {
+			comma, err := parseDelimiter(delimiter)
+			if err != nil {
+				return nil, err
+			}
+			config.Delimiter = comma
+		}
+		return parqat.CSVToJSON(input, config), nil
+	}
+	return nil, fmt.Errorf("invalid --input-format %q: want json or csv", inputFormat)
+}
+
+/*
+processTempDir creates a parqat-<pid>-<random> directory under parent, or the OS temp directory
+if it's empty, for the spool files of this run, so runs sharing a --temp-dir never remove each
+other's files. cleanup removes the directory with everything in it, or with --keep-temp leaves
+it and prints where it is.
+*/
+func processTempDir(parent string) (dir string, cleanup func(), err error) {
+	if dir, err = os.MkdirTemp(parent, fmt.Sprintf("parqat-%d-*", os.Getpid())); err != nil {
+		return "", nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	if keepTemp {
+		return dir, func() { fmt.Fprintf(os.Stderr, "kept temp files in %s\n", dir) }, nil
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+/*
+readEach calls read on every path in parallel, as many at a time as --max-open-files and
+--max-goroutines allow, and returns the results in the order of paths. After a read fails no
+more are started, and the first failure in path order is returned.
+*/
+func readEach[T any](paths []string, read func(path string) (T, error)) ([]T, error) {
+	workers := runtime.GOMAXPROCS(0)
+	for _, limit := range []int{maxOpenFiles, maxGoroutines} {
+		if limit > 0 {
+			workers = min(workers, limit)
+		}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		failed  atomic.Bool
+		results = make([]T, len(paths))
+		errs    = make([]error, len(paths))
+		next    = make(chan int)
+	)
+	for range min(workers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if failed.Load() {
+					continue
+				}
+				if results[i], errs[i] = read(paths[i]); errs[i] != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// writeOutput converts the JSON rows of input to Parquet as the output flags direct.
+func writeOutput(input io.Reader, config parqat.WriterConfig) error {
+	if teePath != "" && (appendMode || config.PartitionBy != "" || config.MaxFileBytes > 0) {
+		return fmt.Errorf("--tee cannot be combined with --append, --partition-by or --max-file-bytes")
+	}
+	if teePath != "" && outputPath != "" && sameFile(teePath, outputPath) {
+		return fmt.Errorf("--tee must name a different file than -o")
+	}
+
+	if appendMode {
+		if outputPath == "" {
+			return fmt.Errorf("--append requires an output file (-o)")
+		}
+		if _, err := os.Stat(outputPath); err == nil {
+			if enableStreaming || len(config.SortBy) > 0 {
+				return fmt.Errorf("--append cannot be combined with --streaming or --sort-by")
+			}
+			return appendToParquetFile(outputPath, input, config)
+		}
+		// Nothing to append to yet - write a fresh file
+	}
+
+	if config.MaxFileBytes > 0 {
+		if outputPath == "" {
+			return fmt.Errorf("--max-file-bytes requires an output file (-o) to number the files after")
+		}
+		if enableStreaming || appendMode || config.PartitionBy != "" {
+			return fmt.Errorf("--max-file-bytes cannot be combined with --streaming, --append or --partition-by")
+		}
+		return parqat.ToParquetSplit(outputPath, input, config)
+	}
+
+	if config.PartitionBy != "" {
+		if outputPath == "" {
+			return fmt.Errorf("--partition-by requires an output directory (-o)")
+		}
+		if enableStreaming || appendMode {
+			return fmt.Errorf("--partition-by cannot be combined with --streaming or --append")
+		}
+		return parqat.ToParquetPartitioned(outputPath, input, config)
+	}
+
+	var w io.Writer
+	if outputPath == "" {
+		w = os.Stdout
+	} else {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	w, closeTee, err := teeOutput(w)
+	if err != nil {
+		return err
+	}
+
+	if enableStreaming {
+		if len(config.SortBy) > 0 {
+			err = fmt.Errorf("--sort-by cannot be combined with --streaming")
+		} else {
+			err = parqat.StreamingToParquet(w, input, config)
+		}
+	} else {
+		err = parqat.ToParquetWithConfig(w, input, config)
+	}
+	if closeErr := closeTee(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Streaming writes rows as it goes, so a bad row leaves a partial file behind
+		for _, path := range []string{outputPath, teePath} {
+			if path != "" {
+				os.Remove(path)
+			}
+		}
+	}
+	return err
+}
+
+// readOutput writes the rows read by read to stdout (and the --tee file) as the reader flags ask.
+func readOutput(cmd *cobra.Command, read func(w io.Writer, config parqat.ReaderConfig) error) error {
+	config, err := createReaderConfig(cmd)
+	if err != nil {
+		return inStage("usage", err)
+	}
+	// Parquet piped in is spooled into this run's own temp directory, as the writers' files are
+	dir, cleanup, err := processTempDir(config.TempDir)
+	if err != nil {
+		return inStage("read", err)
+	}
+	defer cleanup()
+	config.TempDir = dir
+
+	out, closeTee, err := teeOutput(os.Stdout)
+	if err != nil {
+		return inStage("usage", err)
+	}
+	err = read(out, config)
+	if closeErr := closeTee(); err == nil {
+		err = closeErr
+	}
+	return inStage("read", err)
+}
+
+/*
+sameFile reports whether paths a and b name the same file: through links or different
+spellings when both exist, or by their cleaned absolute paths when either is yet to be created.
+*/
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(infoA, infoB)
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+/*
+teeOutput returns w duplicated into the --tee file, when there is one, and a function that
+closes that file. A failed write to either destination fails the whole write.
+*/
+func teeOutput(w io.Writer) (io.Writer, func() error, error) {
+	if teePath == "" {
+		return w, func() error { return nil }, nil
+	}
+	file, err := os.Create(teePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating tee file: %w", err)
+	}
+	return io.MultiWriter(w, file), func() error {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("closing tee file: %w", err)
+		}
+		return nil
+	}, nil
+}
+
 func init() {
 	// Basic flags
-	rootCmd.Flags().IntVar(&head, "head", 0, "Number of rows to read from the beginning")
-	rootCmd.Flags().IntVar(&tail, "tail", 0, "Number of rows to read from the end")
-	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output Parquet file path. If not provided, output is written to stdout.")
+	rootCmd.Flags().IntVar(&head, "head", 0, "Number of rows to read from the beginning; when writing parquet, the number of input records to convert (like --limit)")
+	rootCmd.Flags().IntVar(&tail, "tail", 0, "Number of rows to read from the end; when writing parquet, convert only the last N input records (every record is still read)")
+	rootCmd.Flags().IntVar(&sampleSize, "sample", 0, "Number of rows to pick uniformly at random when reading parquet files")
+	rootCmd.Flags().Int64Var(&sampleSeed, "seed", 0, "Random seed for --sample, for reproducible samples")
+	rootCmd.Flags().Int64Var(&rowOffset, "offset", 0, "Skip this many rows when reading parquet files; whole row groups before it are never decoded")
+	rootCmd.Flags().Int64Var(&rowLength, "length", 0, "With --offset, read at most this many rows (0 = to the end); e.g. one disjoint slice per worker")
+	rootCmd.Flags().StringVar(&rowRange, "rows", "", "Only output the rows with these 0-based indexes in the file, as first-last (inclusive) or one index, e.g. to isolate a bad record; a range past the end is cut short with a warning")
+	rootCmd.Flags().IntSliceVar(&rowGroups, "row-group", nil, "Only read the row groups with these 0-based indexes when reading parquet files (e.g. 3)")
+	rootCmd.Flags().StringVar(&where, "where", "", "Only output the rows where a column compares to a value when reading parquet files, as column op value (op: ==, !=, <, <=, >, >=; e.g. \"region == 'eu'\"); row groups whose statistics rule out a match aren't decoded")
+	rootCmd.Flags().StringSliceVar(&columns, "columns", nil, "Only output these columns, in this order, when reading parquet files (e.g. id,name)")
+	rootCmd.Flags().StringSliceVar(&excludeColumns, "exclude", nil, "Output every column except these when reading parquet files (e.g. payload)")
+	rootCmd.Flags().BoolVar(&flatten, "flatten", false, "Expand nested groups into dotted columns (addr.city) when reading parquet files; lists and maps become JSON strings")
+	rootCmd.Flags().StringVar(&explode, "explode", "", "Output one row per element of this array column when reading parquet files, repeating the other columns (lists, or JSON-string arrays as parqat writes them; like SQL UNNEST)")
+	rootCmd.Flags().BoolVar(&explodeKeepEmpty, "explode-keep-empty", false, "With --explode, output rows whose array is empty or null once, with a null in its place, instead of dropping them")
+	rootCmd.Flags().StringSliceVar(&casts, "cast", nil, "Output columns in another representation when reading parquet files, as column:cast (string, epoch_seconds, epoch_millis or epoch_micros; e.g. id:string,ts:epoch_millis)")
+	rootCmd.Flags().BoolVar(&countRows, "count", false, "Print the number of rows in the given parquet files (summed) without decoding them")
+	rootCmd.Flags().StringVar(&countBy, "count-by", "", "Instead of the rows, output each distinct value of this column with its row count, most common first (nulls count as a value); only that column is decoded")
+	rootCmd.Flags().BoolVar(&layout, "layout", false, "Print the row groups of the given parquet files with their rows and per-column codec, page count, compressed and uncompressed sizes")
+	rootCmd.Flags().BoolVar(&profile, "profile", false, "Print a JSON summary of each numeric column of the given parquet files, one object per file: min, max, mean, null fraction and distinct count, from the statistics where they have them and from --sample rows (default 10000) otherwise")
+	rootCmd.Flags().BoolVar(&showCreated, "show-created-by", false, "Print the created_by string from the footers of the given parquet files, naming the writer that made each")
+	rootCmd.Flags().BoolVar(&showMeta, "show-meta", false, "Print the column descriptions stored in the given parquet files (see --column-meta), one name and description per line")
+	rootCmd.Flags().BoolVar(&sortKeys, "sort-keys", true, "Write JSON keys in sorted order when reading parquet files; --sort-keys=false follows the schema's column order")
+	rootCmd.Flags().IntVar(&outputBuffer, "output-buffer-size", 4096, "Bytes of output buffered between writes when reading parquet files: larger for fewer system calls when piping to fast consumers, smaller for rows to arrive sooner")
+	rootCmd.Flags().BoolVar(&lineBuffered, "line-buffered", false, "Flush output after every row when reading parquet files (lower latency in pipelines, lower throughput)")
+	rootCmd.Flags().StringVar(&outputFormat, "format", parqat.FormatJSON, "Output format when reading parquet files: json, columnar for one object of per-column arrays (buffers every row; bound it with --head), csv, tsv, or arrow for an Arrow IPC stream")
+	rootCmd.Flags().StringVar(&timezone, "timezone", "UTC", "IANA time zone (e.g. Europe/Berlin or Local) to render UTC-adjusted timestamps in when reading parquet files")
+	rootCmd.Flags().StringVar(&delimiter, "delimiter", "", "Field delimiter for csv/tsv output, a single character (\\t for tab)")
+	rootCmd.Flags().BoolVar(&validate, "validate", false, "Check that the given parquet files are readable; exits non-zero with the first error")
+	rootCmd.Flags().BoolVar(&validateDeep, "validate-deep", false, "Like --validate, but also decode every row")
+	rootCmd.Flags().BoolVar(&verifyStats, "verify-stats", false, "Decode the given parquet files and check the min/max and null counts in their column chunk statistics and column indexes against the data; lists each mismatch and exits non-zero if there are any")
+	rootCmd.Flags().BoolVar(&repair, "repair", false, "Best-effort read of a parquet file with a missing or corrupt footer (e.g. a cut-off upload): recovers the complete row groups before the damage, given the file's --schema")
+	rootCmd.Flags().BoolVar(&schemaMerge, "schema-merge", false, "Convert the given JSON files (plain or gzipped) into the -o directory with one schema inferred across all of them, printing it and any type coercions to stderr")
+	rootCmd.Flags().BoolVar(&compact, "compact", false, "Rewrite the given parquet file to -o with the writer flags (compression, row group size, dictionary), coalescing small row groups")
+	rootCmd.Flags().BoolVar(&omitNulls, "omit-nulls", false, "Leave null fields out of JSON rows when reading parquet files, for compact output from sparse files (all-null rows are written as {})")
+	rootCmd.Flags().IntVar(&floatDigits, "float-precision", 0, "Round float and double values to at most N significant digits when reading parquet files, for clean, diffable output (0 keeps full precision)")
+	rootCmd.Flags().StringVar(&nullAs, "null-as", "", "Token written for null values when reading parquet files, even null or an empty string (default: JSON null, an empty cell in csv and tsv)")
+	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output Parquet file path, with $VAR and ${VAR} expanded from the environment (any other $ is kept). If not provided, output is written to stdout.")
+	rootCmd.Flags().StringVar(&teePath, "tee", "", "Also write the output (JSON/CSV when reading, parquet when writing) to this file, as well as to stdout or -o")
 	rootCmd.Flags().BoolP("version", "v", false, "Show version information")
+	rootCmd.Flags().BoolVar(&appendMode, "append", false, "Append rows to the existing output file; rewrites the whole file, so cost grows with its size")
+	rootCmd.Flags().StringVar(&inputFormat, "input-format", "json", "Format of the input converted to parquet: json, or csv with a header row (or without one, with --no-header)")
+	rootCmd.Flags().BoolVar(&noHeader, "no-header", false, "Read the first CSV row as data rather than column names (with --input-format csv); columns are named by --names, or col0, col1, ...")
+	rootCmd.Flags().StringSliceVar(&csvNames, "names", nil, "With --no-header, the names of the CSV columns, in order (e.g. id,name,score)")
+	rootCmd.Flags().StringSliceVar(&boolTrue, "bool-true", []string{"true"}, "CSV cells read as true, case-insensitively (with --input-format csv)")
+	rootCmd.Flags().StringSliceVar(&boolFalse, "bool-false", []string{"false"}, "CSV cells read as false, case-insensitively (with --input-format csv)")
+	rootCmd.Flags().StringSliceVar(&nullTokens, "null-token", []string{"", "null"}, "CSV cells read as null, case-insensitively (with --input-format csv; default: empty cells and null)")
+	rootCmd.Flags().StringVar(&direction, "direction", "auto", "Which way to convert: auto (stdin starting with PAR1 and non-gzip files are parquet), read (parquet to JSON/CSV) or write (JSON/CSV to parquet)")
+	rootCmd.Flags().BoolVar(&inputGzip, "input-gzip", false, "Treat JSON input as gzip-compressed (normally detected automatically)")
+	rootCmd.Flags().StringVar(&unwrap, "unwrap", "", "Lift the fields of this object field to the top level of every row before the schema is inferred (e.g. data for {\"data\": {...}, \"meta\": {...}})")
+	rootCmd.Flags().StringVar(&normalizeKeys, "normalize-keys", "", "Normalize top-level field names before schema inference and --rename, merging fields that end up alike into one column and reporting values dropped that way (nested objects keep their names): trim (whitespace), lower (trim and lowercase), or snake (trim and snake_case)")
+	rootCmd.Flags().BoolVar(&strictKeys, "strict-keys", false, "With --normalize-keys, fail on two field names normalized to the same name instead of merging them")
+	rootCmd.Flags().StringVar(&unwrapPrefix, "unwrap-prefix", "", "Prefix for the fields lifted by --unwrap, so they can't collide with top-level fields (e.g. data_)")
+	rootCmd.Flags().StringSliceVar(&renames, "rename", nil, "Rename a field, as old:new (repeatable; e.g. userId:user_id), when writing parquet before the schema is inferred and when reading it")
 
 	// Writer configuration flags (SIMD-optimized defaults)
-	rootCmd.Flags().StringVar(&compressionType, "compression", "zstd", "Compression type: none, snappy, gzip, zstd (default: zstd for best performance)")
+	rootCmd.Flags().BoolVar(&listCodecs, "list-codecs", false, "Print the names --compression accepts, one per line, and exit")
+	rootCmd.Flags().BoolVar(&listEncoding, "list-encodings", false, "Print the names --default-encoding and --encoding accept, one per line, and exit")
+	rootCmd.Flags().StringVar(&compressionType, "compression", "zstd", "Compression type: none, snappy, gzip, zstd, or auto to try snappy and zstd on a sample (default: zstd for best performance)")
+	rootCmd.Flags().StringVar(&optimizeFor, "optimize-for", "", "What --compression auto and --auto-tune optimize for: size or speed (default: size)")
+	rootCmd.Flags().BoolVar(&autoTune, "auto-tune", false, "Try a few page buffer and row group sizes on a sample of the input and convert with whichever does best for --optimize-for")
 	rootCmd.Flags().IntVar(&pageBufferSize, "page-buffer-size", 256*1024, "Page buffer size in bytes (default: 262144 = 2^18, SIMD-optimized)")
+	rootCmd.Flags().IntVar(&batchSize, "batch-size", 0, "Rows handled per batch when writing; in streaming mode, decoded rows held in memory at once, independent of --page-buffer-size (0 = 262144, or 131072 with --streaming)")
 	rootCmd.Flags().Int64Var(&maxRowsPerGroup, "max-rows-per-group", 1048576, "Maximum rows per row group (default: 1048576 = 2^20, SIMD-optimized)")
+	rootCmd.Flags().Int64Var(&rowGroupBytes, "row-group-bytes", 0, "Approximate byte budget per row group; combined with --max-rows-per-group, whichever is hit first wins (0 = unlimited)")
+	rootCmd.Flags().Int64Var(&flushEvery, "flush-every", 0, "Close a row group after this many rows so readers see it sooner; the smallest of this, --max-rows-per-group and --row-group-bytes wins (0 = off)")
+	rootCmd.Flags().DurationVar(&flushInterval, "flush-interval", 0, "Close a row group once it has been open this long (e.g. 5s), checked as rows arrive (0 = off)")
 	rootCmd.Flags().IntVar(&dataPageVersion, "data-page-version", 2, "Data page version (1 or 2, default: 2 for better performance)")
-	rootCmd.Flags().BoolVar(&enableDictionary, "enable-dictionary", true, "Enable dictionary encoding for better compression")
+	rootCmd.Flags().BoolVar(&enableDictionary, "enable-dictionary", true, "Dictionary-encode columns without an explicit encoding, for better compression of repetitive values")
 	rootCmd.Flags().BoolVar(&enableStreaming, "streaming", false, "Enable streaming mode for large datasets (uses temp files)")
+	rootCmd.Flags().StringSliceVar(&bloomColumns, "bloom-columns", nil, "Columns to write bloom filters for (e.g. id,email)")
+	rootCmd.Flags().StringSliceVar(&sortBy, "sort-by", nil, "Sort rows by these columns before writing; prefix with - for descending (e.g. col1,-col2)")
+	rootCmd.Flags().StringSliceVar(&uuidColumns, "uuid-columns", nil, "Columns of UUID strings to store as 16-byte UUID values")
+	rootCmd.Flags().StringSliceVar(&binaryColumns, "binary-columns", nil, "Columns of base64 strings to store as raw BYTE_ARRAY values (read back as base64)")
+	rootCmd.Flags().BoolVar(&ejson, "ejson", false, "Read MongoDB Extended JSON wrappers ($numberLong, $numberDecimal, $date, $oid, $binary, ...) as the values they wrap, e.g. for mongoexport output")
+	rootCmd.Flags().BoolVar(&detectDates, "detect-dates", false, "Store columns whose values are all YYYY-MM-DD strings as DATE")
+	rootCmd.Flags().BoolVar(&detectTimestamps, "detect-timestamps", false, "Store columns whose values are all RFC 3339 timestamps as timestamps")
+	rootCmd.Flags().BoolVar(&assumeUTC, "assume-utc", false, "Read timestamps without a zone offset (2023-05-01T12:00:00) as UTC; otherwise they are not detected as timestamps and timestamp columns reject them")
+	rootCmd.Flags().StringVar(&timestampFormat, "timestamp-format", parqat.TimestampMicros, "How --detect-timestamps stores timestamps: micros, millis, or int96 for legacy Spark/Hive/Impala readers")
+	rootCmd.Flags().BoolVar(&evolveSchema, "evolve", false, "In streaming mode, widen the schema with fields that first appear after the sampled rows")
+	rootCmd.Flags().StringSliceVar(&decimalColumns, "decimal-columns", nil, "Columns to store as DECIMAL, as name:precision:scale (e.g. price:10:2)")
+	rootCmd.Flags().IntVar(&enumThreshold, "enum-threshold", 0, "Annotate string columns with fewer distinct values than this in the sample as ENUM (0 = never)")
+	rootCmd.Flags().StringVar(&onTypeConflict, "on-type-conflict", parqat.TypeConflictString, "What to do with columns holding several JSON types: string (store as strings), error, majority (convert to the most common type)")
+	rootCmd.Flags().Float64Var(&requiredThreshold, "required-threshold", 0, "Write columns whose sampled share of nulls is at most this (0-1) as required instead of optional (0 = any null makes a column optional)")
+	rootCmd.Flags().StringArrayVar(&defaultValues, "default", nil, "Write this value in place of a field's nulls and missing values, as field:value (repeatable; e.g. count:0, which must fit the column's type); the column is then written as required")
+	rootCmd.Flags().StringVar(&onRequiredNull, "on-required-null", parqat.RequiredNullError, "With --required-threshold, what to do with rows that have a null in a required column: error, or drop (reporting each to stderr)")
+	rootCmd.Flags().StringVar(&defaultEncoding, "default-encoding", "", "Encoding for every column whose type supports it (e.g. DELTA_BINARY_PACKED)")
+	rootCmd.Flags().StringSliceVar(&columnEncodings, "encoding", nil, "Encoding for a column, as name:ENCODING (repeatable; e.g. timestamp:DELTA_BINARY_PACKED)")
+	rootCmd.Flags().StringSliceVar(&deltaColumns, "delta-columns", nil, "Integer or timestamp columns to delta-encode, for near-monotonic values like sequence numbers and event times (e.g. seq,ts)")
+	rootCmd.Flags().StringVar(&createdBy, "created-by", "", "Write this as the created_by string in the file footer, for provenance (e.g. \"parqat 1.0.0 (nightly-load)\"; default: parquet-go's own)")
+	rootCmd.Flags().StringArrayVar(&columnMeta, "column-meta", nil, "Describe a column in the file's metadata, as name=description (repeatable; e.g. price=\"USD amount\")")
+	rootCmd.Flags().StringSliceVar(&typeHints, "type-hint", nil, "Override the inferred type of a column, as name:type (repeatable; types: "+strings.Join(parqat.TypeHintNames(), ", ")+")")
+	rootCmd.Flags().StringSliceVar(&statsColumns, "stats-columns", nil, "Write min/max statistics only for these columns (default: all columns)")
+	rootCmd.Flags().BoolVar(&noStats, "no-stats", false, "Write no min/max statistics at all")
+	rootCmd.Flags().BoolVar(&verifyOutput, "verify", false, "Read the written parquet data back and compare it with the input rows before writing it out (slower, not with --streaming or --append)")
+	rootCmd.Flags().Int64Var(&limitRows, "limit", 0, "Stop after converting this many JSON rows to parquet; the rest of the input is not read (0 = no limit); when reading parquet files, like --head")
+	rootCmd.Flags().StringVar(&partitionBy, "partition-by", "", "Write a Hive-style dataset into the -o directory, one column=value/part.parquet per value of this column")
+	rootCmd.Flags().StringVar(&maxFileBytes, "max-file-bytes", "", "Split the output into numbered files of roughly this size each (e.g. 128MB): -o out.parquet writes out-000.parquet, out-001.parquet, ...")
+	rootCmd.Flags().BoolVar(&keepPartitionColumn, "keep-partition-column", false, "With --partition-by, also keep the partition column inside each file")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Infer the schema and print it with the row count and codec to stderr, without writing any parquet")
+	rootCmd.Flags().BoolVar(&dedupe, "dedupe", false, "Drop rows identical to an earlier row, reporting how many to stderr; keeps a 16-byte hash per distinct row in memory")
+	rootCmd.Flags().StringSliceVar(&dedupeBy, "dedupe-by", nil, "Drop rows whose values in these fields match an earlier row's, keeping the first (implies --dedupe); memory grows with the number of distinct keys")
+	rootCmd.Flags().BoolVar(&skipInvalid, "skip-invalid", false, "Skip input records that are not JSON objects (e.g. 42 or [1,2]), reporting each to stderr, instead of failing")
+	rootCmd.Flags().StringVar(&schemaPath, "schema", "", "Write with the schema in this JSON file instead of inferring one (the format --dump-schema writes); with --repair, the schema the damaged file was written with")
+	rootCmd.Flags().StringVar(&dumpSchemaPath, "dump-schema", "", "Also save the schema used for writing to this JSON file, for review or reuse with --schema")
+	rootCmd.Flags().StringVar(&avroSchemaPath, "avro-schema", "", "Also save the schema used for writing to this file as an Avro record schema (.avsc), e.g. for a schema registry")
+	rootCmd.Flags().StringVar(&schemaName, "schema-name", "row", "Name of the schema's root message, for tools that key off it")
+	rootCmd.Flags().StringVar(&manifestPath, "manifest", "", "After writing, save a JSON sidecar with the schema, row and row group counts, codec, null counts and file size to this path")
+	rootCmd.Flags().StringVar(&tempDir, "temp-dir", "", "Directory for temporary spool files, including large parquet input read from a pipe (default: the OS temp directory)")
+	rootCmd.Flags().BoolVar(&keepTemp, "keep-temp", false, "Keep this run's temp directory and the spool files in it instead of removing them on exit, printing its path to stderr (for debugging)")
+	rootCmd.Flags().BoolVar(&noTemp, "no-temp", false, "Keep the input in memory instead of spooling it to a temp file (small inputs, not with --streaming)")
+	rootCmd.Flags().IntVar(&maxOpenFiles, "max-open-files", 0, "Most files open at once: partition files written in parallel with --partition-by, and files read in parallel when several are given (0 = GOMAXPROCS)")
+	rootCmd.Flags().IntVar(&maxGoroutines, "max-goroutines", 0, "Most goroutines reading the files given together (--count, --validate, --profile, ...) in parallel (0 = GOMAXPROCS)")
+	rootCmd.Flags().StringVar(&maxMemory, "max-memory", "", "Switch to streaming, with --evolve, once the rows read take roughly this much memory (e.g. 512MB; default: no limit; not with --no-temp)")
+
+	mergeCmd.Flags().StringVarP(&mergeOutput, "output", "o", "", "Path of the merged Parquet file")
+	// The writer flags that apply to merge, as they do to --compact
+	for _, name := range []string{"compression", "page-buffer-size", "data-page-version", "enable-dictionary", "default-encoding", "encoding", "delta-columns", "bloom-columns", "stats-columns", "no-stats", "created-by", "column-meta"} {
+		mergeCmd.Flags().AddFlag(rootCmd.Flags().Lookup(name))
+	}
+	rootCmd.AddCommand(mergeCmd)
+
+	// Fill in flags left off the command line from the defaults file
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		path, required := flagDefaultsPath()
+		if err := applyFlagDefaults(cmd, path, required); err != nil {
+			return inStage("usage", err)
+		}
+		for _, output := range []*string{&outputPath, &mergeOutput, &teePath, &manifestPath, &dumpSchemaPath, &avroSchemaPath} {
+			expanded, err := expandEnvPath(*output, allowEmptyEnv)
+			if err != nil {
+				return inStage("usage", err)
+			}
+			*output = expanded
+		}
+		if jsonErrors {
+			// Execute reports the error as JSON instead
+			rootCmd.SilenceErrors, rootCmd.SilenceUsage = true, true
+		}
+		return nil
+	}
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return inStage("usage", err)
+	})
+	rootCmd.PersistentFlags().BoolVar(&allowEmptyEnv, "allow-empty-env", false, "Expand unset or empty environment variables in output paths to nothing instead of failing")
+	rootCmd.PersistentFlags().BoolVar(&jsonErrors, "json-errors", false, "On failure, print a JSON object with the error, a stable code, the stage and the failing record to stderr")
 
 	// Handle version flag
 	rootCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
@@ -114,69 +983,1040 @@ func init() {
 }
 
 /*
-Execute runs the root Cobra command for the CLI.
-It handles command-line parsing and error reporting.
+flagDefaultsPath returns the file persistent flag defaults are read from: $PARQAT_CONFIG if set,
+which then has to exist, or else parqat/defaults.json in the user config directory
+(~/.config on Linux), which is optional.
 */
-func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+func flagDefaultsPath() (path string, required bool) {
+	if path := os.Getenv("PARQAT_CONFIG"); path != "" {
+		return path, true
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
 	}
+	return filepath.Join(dir, "parqat", "defaults.json"), false
 }
 
-func main() {
-	Execute()
-}
+/*
+applyFlagDefaults sets the flags of cmd that weren't given on the command line from the JSON
+object in the file at path, whose keys are flag names (e.g. {"compression": "snappy",
+"streaming": true}). Lists set list flags. Keys must name flags of the root command;
+those the running subcommand doesn't have are ignored.
+*/
+func applyFlagDefaults(cmd *cobra.Command, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("reading flag defaults: %w", err)
+	}
 
-var outputPath string
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var defaults map[string]any
+	if err := dec.Decode(&defaults); err != nil {
+		return fmt.Errorf("decoding flag defaults %s: %w", path, err)
+	}
 
-var (
-	head int
-	tail int
-)
+	for name, value := range defaults {
+		if cmd.Root().Flags().Lookup(name) == nil {
+			return fmt.Errorf("flag defaults %s: unknown flag %q", path, name)
+		}
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || flag.Changed {
+			continue // Not this command's flag, or the command line wins
+		}
 
-// Writer configuration flags with SIMD-optimized defaults
+		// Setting the value directly leaves the flag unchanged, as if it was never given
+		var err error
+		switch v := value.(type) {
+		case string, bool, json.Number:
+			err = flag.Value.Set(fmt.Sprint(v))
+		case []any:
+			list, ok := flag.Value.(interface{ Replace([]string) error })
+			if !ok {
+				return fmt.Errorf("flag defaults %s: --%s takes a single value, not a list", path, name)
+			}
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			err = list.Replace(items)
+		default:
+			return fmt.Errorf("flag defaults %s: --%s must be a string, number, boolean or list", path, name)
+		}
+		if err != nil {
+			return fmt.Errorf("flag defaults %s: invalid value for --%s: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+/*
+Execute runs the root Cobra command for the CLI.
+It handles command-line parsing and error reporting.
+*/
+func Execute() {
+	// Bad flags fail before --json-errors is parsed, so look for it up front
+	if slices.Contains(os.Args[1:], "--json-errors") {
+		jsonErrors = true
+		rootCmd.SilenceErrors, rootCmd.SilenceUsage = true, true
+	}
+	if err := rootCmd.Execute(); err != nil {
+		if jsonErrors {
+			writeJSONError(os.Stderr, err)
+		} else {
+			fmt.Println(err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// Exit codes, so scripts can tell bad input apart from other failures.
+const (
+	exitError        = 1   // I/O and other runtime errors
+	exitInvalidInput = 2   // malformed JSON input
+	exitInterrupted  = 130 // stopped by SIGINT, as shells report it
+)
+
+// exitCode maps an error returned by the root command to the process exit code.
+func exitCode(err error) int {
+	var decodeErr *parqat.DecodeError
+	if errors.As(err, &decodeErr) {
+		return exitInvalidInput
+	}
+	if errors.Is(err, errInterrupted) {
+		return exitInterrupted
+	}
+	return exitError
+}
+
+// errorCodes are the stable names --json-errors gives the exit codes.
+var errorCodes = map[int]string{
+	exitError:        "error",
+	exitInvalidInput: "invalid_input",
+	exitInterrupted:  "interrupted",
+}
+
+// errInterrupted reports a conversion cut short by SIGINT, whose output is valid but partial.
+var errInterrupted = errors.New("interrupted: the output holds only the rows read before the interrupt")
+
+/*
+stopOnInterrupt returns a channel closed by the first SIGINT, which ends the input of a
+conversion so the rows read so far are still written as a valid file. A second SIGINT exits
+at once. release restores the default handling.
+*/
+func stopOnInterrupt() (stop <-chan struct{}, release func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	stopped, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(os.Stderr, "interrupted: writing the rows read so far (interrupt again to abort)")
+		close(stopped)
+		select {
+		case <-signals:
+			os.Exit(exitInterrupted)
+		case <-done:
+		}
+	}()
+	return stopped, func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// stageError records the stage of a run that failed, for --json-errors.
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// inStage tags err, if not nil, as having happened in stage.
+func inStage(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &stageError{stage: stage, err: err}
+}
+
+// jsonError is what --json-errors prints for a failure.
+type jsonError struct {
+	Error    string `json:"error"`
+	Code     string `json:"code"`
+	ExitCode int    `json:"exit_code"`
+	Stage    string `json:"stage,omitempty"`
+	Record   int    `json:"record,omitempty"`
+	Offset   *int64 `json:"offset,omitempty"`
+}
+
+// writeJSONError writes err to w as a single-line jsonError.
+func writeJSONError(w io.Writer, err error) {
+	report := jsonError{Error: err.Error(), ExitCode: exitCode(err)}
+	report.Code = errorCodes[report.ExitCode]
+
+	var stageErr *stageError
+	if errors.As(err, &stageErr) {
+		report.Stage = stageErr.stage
+	}
+	var decodeErr *parqat.DecodeError
+	if errors.As(err, &decodeErr) {
+		// Malformed input is a decode failure whatever stage came across it
+		report.Stage = "decode"
+		report.Record, report.Offset = decodeErr.Record, &decodeErr.Offset
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func main() {
+	Execute()
+}
+
+var outputPath string
+
+var teePath string
+
+var renames []string
+
+var direction string
+
+var jsonErrors bool
+
+var allowEmptyEnv bool
+
+var mergeOutput string
+
+var (
+	inputGzip  bool
+	appendMode bool
+)
+
+var (
+	head         int
+	tail         int
+	nullAs       string
+	omitNulls    bool
+	floatDigits  int
+	lineBuffered bool
+	outputBuffer int
+	sortKeys     bool
+	outputFormat string
+	delimiter    string
+	countRows    bool
+	listCodecs   bool
+	listEncoding bool
+	layout       bool
+	showMeta     bool
+	showCreated  bool
+	validate     bool
+	validateDeep bool
+	verifyStats  bool
+	profile      bool
+	compact      bool
+	repair       bool
+	schemaMerge  bool
+	sampleSize   int
+	sampleSeed   int64
+	rowOffset    int64
+	rowLength    int64
+	rowRange     string
+	rowGroups    []int
+	where        string
+	flatten      bool
+
+	explode          string
+	explodeKeepEmpty bool
+	countBy          string
+	casts            []string
+)
+
+// Writer configuration flags with SIMD-optimized defaults
 var (
 	compressionType  string
+	optimizeFor      string
+	autoTune         bool
 	pageBufferSize   int
+	batchSize        int
 	maxRowsPerGroup  int64
+	rowGroupBytes    int64
+	flushEvery       int64
+	flushInterval    time.Duration
 	dataPageVersion  int
 	enableDictionary bool
 	enableStreaming  bool
+	evolveSchema     bool
+	detectDates      bool
+	ejson            bool
+	unwrap           string
+	unwrapPrefix     string
+	normalizeKeys    string
+	strictKeys       bool
+	droppedKeys      map[[2]string]int // values dropped, by the field kept and the field dropped
+	uuidColumns      []string
+	binaryColumns    []string
+	sortBy           []string
+	bloomColumns     []string
+	decimalColumns   []string
+	enumThreshold    int
+	typeHints        []string
+	columnMeta       []string
+	createdBy        string
+	defaultEncoding  string
+	columnEncodings  []string
+	deltaColumns     []string
+	onTypeConflict   string
+	limitRows        int64
+	verifyOutput     bool
+	statsColumns     []string
+	noStats          bool
+	tempDir          string
+	keepTemp         bool
+	noTemp           bool
+	maxMemory        string
+	maxFileBytes     string
+	skipInvalid      bool
+	dedupe           bool
+	dedupeBy         []string
+	duplicateRows    int
+	dryRun           bool
+	manifestPath     string
+	skippedRows      int
 )
 
+// Nullability flags
+var (
+	requiredThreshold float64
+	onRequiredNull    string
+	droppedRows       int
+	defaultValues     []string
+	defaultedValues   map[string]int
+)
+
+// Partitioned output flags
+var (
+	partitionBy         string
+	keepPartitionColumn bool
+)
+
+// Resource limit flags
+var (
+	maxOpenFiles  int
+	maxGoroutines int
+)
+
+// Timestamp flags
+var (
+	detectTimestamps bool
+	timestampFormat  string
+	assumeUTC        bool
+	timezone         string
+)
+
+// Column projection flags
+var (
+	columns        []string
+	excludeColumns []string
+)
+
+// CSV input flags
+var (
+	inputFormat string
+	boolTrue    []string
+	boolFalse   []string
+	nullTokens  []string
+	noHeader    bool
+	csvNames    []string
+)
+
+// Schema file flags
+var (
+	schemaPath     string
+	dumpSchemaPath string
+	avroSchemaPath string
+	schemaName     string
+)
+
+// createReaderConfig creates a ReaderConfig from command line flags.
+func createReaderConfig(cmd *cobra.Command) (parqat.ReaderConfig, error) {
+	config := parqat.DefaultReaderConfig()
+	config.Head = head
+	// --limit is --head by another name here too, as --head is --limit when writing
+	if limitRows > 0 {
+		if head > 0 && int64(head) != limitRows {
+			return config, fmt.Errorf("--head and --limit both set the number of rows to read; use one")
+		}
+		config.Head = int(limitRows)
+	}
+	config.Tail = tail
+	config.Offset = rowOffset
+	config.Length = rowLength
+	if cmd.Flags().Changed("null-as") {
+		config.NullAs = &nullAs // Even "null", which then is the string, not JSON null
+	}
+	config.OmitNulls = omitNulls
+	config.FloatPrecision = floatDigits
+	config.TempDir = tempDir // readOutput makes this run's directory for spooled Parquet under it
+	config.LineBuffered = lineBuffered
+	if outputBuffer <= 0 {
+		return config, fmt.Errorf("invalid --output-buffer-size %d: want a positive number of bytes", outputBuffer)
+	}
+	config.OutputBufferSize = outputBuffer
+	config.SchemaKeyOrder = !sortKeys
+	config.Format = outputFormat
+	config.ColumnarBuffered = func(rows int64) {
+		fmt.Fprintf(os.Stderr, "warning: --format columnar holds every row in memory and has buffered %d rows so far; bound it with --head\n", rows)
+	}
+	config.RowGroups = rowGroups
+	config.Columns = columns
+	config.ExcludeColumns = excludeColumns
+	config.Flatten = flatten
+	config.Explode = explode
+	config.ExplodeKeepEmpty = explodeKeepEmpty
+	config.CountBy = countBy
+	if where != "" {
+		predicate, err := parqat.ParsePredicate(where)
+		if err != nil {
+			return config, fmt.Errorf("--where: %w", err)
+		}
+		if tail > 0 || sampleSize > 0 || rowOffset > 0 || rowLength > 0 || rowRange != "" {
+			return config, fmt.Errorf("--where cannot be combined with --tail, --sample, --offset, --length or --rows")
+		}
+		config.Where = predicate
+		config.RowGroupsSkipped = func(skipped, total int) {
+			if skipped > 0 {
+				fmt.Fprintf(os.Stderr, "--where skipped %d of %d row groups by their statistics\n", skipped, total)
+			}
+		}
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return config, fmt.Errorf("invalid --timezone %q: %w", timezone, err)
+	}
+	config.Location = location
+
+	rename, err := parseRenames(renames)
+	if err != nil {
+		return config, err
+	}
+	config.Rename = rename
+
+	cast, err := parseCasts(casts)
+	if err != nil {
+		return config, err
+	}
+	config.Cast = cast
+
+	if len(columns) > 0 && len(excludeColumns) > 0 {
+		return config, fmt.Errorf("--columns and --exclude cannot be combined")
+	}
+	if explodeKeepEmpty && explode == "" {
+		return config, fmt.Errorf("--explode-keep-empty requires --explode")
+	}
+	if floatDigits < 0 {
+		return config, fmt.Errorf("--float-precision must not be negative")
+	}
+	if (rowOffset > 0 || rowLength > 0) && (config.Head > 0 || tail > 0 || sampleSize > 0) {
+		return config, fmt.Errorf("--offset and --length cannot be combined with --head, --tail or --sample")
+	}
+	if rowRange != "" {
+		if rowOffset > 0 || rowLength > 0 || config.Head > 0 || tail > 0 || sampleSize > 0 {
+			return config, fmt.Errorf("--rows cannot be combined with --offset, --length, --head, --tail or --sample")
+		}
+		first, last, err := parseRowRange(rowRange)
+		if err != nil {
+			return config, err
+		}
+		config.Offset, config.Length = first, last-first+1
+		config.RangeTruncated = func(numRows int64) {
+			if first >= numRows {
+				fmt.Fprintf(os.Stderr, "warning: --rows %s starts past the last row; there are only %d rows\n", rowRange, numRows)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "warning: --rows %s ends past the last row; printing rows %d-%d of %d\n", rowRange, first, numRows-1, numRows)
+		}
+	}
+
+	if delimiter != "" {
+		if outputFormat == parqat.FormatJSON {
+			return config, fmt.Errorf("--delimiter requires --format csv or tsv")
+		}
+		comma, err := parseDelimiter(delimiter)
+		if err != nil {
+			return config, err
+		}
+		config.Delimiter = comma
+	}
+
+	if sampleSize > 0 {
+		if config.Head > 0 || tail > 0 {
+			return config, fmt.Errorf("--sample cannot be combined with --head or --tail")
+		}
+		config.Sample = sampleSize
+		config.Seed = sampleSeed
+		if !cmd.Flags().Changed("seed") {
+			config.Seed = time.Now().UnixNano()
+		}
+	}
+	return config, nil
+}
+
+// parseRowRange parses a --rows range of the form first-last (inclusive) or a single row index.
+func parseRowRange(s string) (first, last int64, err error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	if first, err = strconv.ParseInt(strings.TrimSpace(lo), 10, 64); err != nil || first < 0 {
+		return 0, 0, fmt.Errorf("invalid --rows %q: want first-last or a row index, e.g. 10234-10240", s)
+	}
+	last = first
+	if isRange {
+		if last, err = strconv.ParseInt(strings.TrimSpace(hi), 10, 64); err != nil || last < 0 {
+			return 0, 0, fmt.Errorf("invalid --rows %q: want first-last or a row index, e.g. 10234-10240", s)
+		}
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("invalid --rows %q: the last row comes before the first", s)
+	}
+	return first, last, nil
+}
+
+// parseDelimiter parses --delimiter, which must be a single character; \t spells a tab.
+func parseDelimiter(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("invalid --delimiter %q: must be a single character", s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+// codecs maps the --compression names to their codecs; auto picks one of them per input.
+var codecs = map[string]compress.Codec{
+	"none":   &parquet.Uncompressed,
+	"snappy": &parquet.Snappy,
+	"gzip":   &parquet.Gzip,
+	"zstd":   &parquet.Zstd,
+}
+
+// codecNames returns the names --compression accepts, auto included, sorted.
+func codecNames() []string {
+	names := append(slices.Collect(maps.Keys(codecs)), "auto")
+	slices.Sort(names)
+	return names
+}
+
 /*
 createWriterConfig creates a WriterConfig from command line flags.
 It applies user-specified compression, buffer sizes, and other performance options.
 */
-func createWriterConfig() WriterConfig {
-	config := DefaultWriterConfig()
+func createWriterConfig() (parqat.WriterConfig, error) {
+	config := parqat.DefaultWriterConfig()
 
 	// Override with command line flags
-	switch compressionType {
-	case "none":
-		config.Codec = &parquet.Uncompressed
-	case "snappy":
-		config.Codec = &parquet.Snappy
-	case "gzip":
-		config.Codec = &parquet.Gzip
-	case "zstd":
-		config.Codec = &parquet.Zstd
-		// default already set to zstd in DefaultWriterConfig
+	if compressionType == "auto" {
+		config.AutoCodec = true
+		config.CodecChosen = func(codec compress.Codec) {
+			fmt.Fprintf(os.Stderr, "compression: auto picked %s\n", strings.ToLower(codec.String()))
+		}
+	} else if codec, ok := codecs[compressionType]; ok {
+		config.Codec = codec
+	} else {
+		return config, fmt.Errorf("invalid --compression %q (valid: %s)", compressionType, strings.Join(codecNames(), ", "))
+	}
+
+	switch optimizeFor {
+	case "":
+	case parqat.OptimizeSize, parqat.OptimizeSpeed:
+		if !config.AutoCodec && !autoTune {
+			return config, fmt.Errorf("--optimize-for requires --compression auto or --auto-tune")
+		}
+		config.OptimizeFor = optimizeFor
+	default:
+		return config, fmt.Errorf("invalid --optimize-for %q: want size or speed", optimizeFor)
 	}
 
 	config.PageBufferSize = pageBufferSize
+	if batchSize < 0 {
+		return config, fmt.Errorf("invalid --batch-size %d: want a positive number of rows", batchSize)
+	}
+	config.BatchSize = batchSize
 	config.MaxRowsPerRowGroup = maxRowsPerGroup
+	if autoTune {
+		// Replaces the two sizes above once a sample has been read
+		config.AutoTune = true
+		config.Tuned = func(pageBufferSize int, maxRowsPerRowGroup int64) {
+			fmt.Fprintf(os.Stderr, "auto-tune: picked --page-buffer-size %d --max-rows-per-group %d\n", pageBufferSize, maxRowsPerRowGroup)
+		}
+	}
+	config.RowGroupBytes = rowGroupBytes
+	config.FlushEvery = flushEvery
+	config.FlushInterval = flushInterval
 	config.DataPageVersion = dataPageVersion
 	config.UseDictionary = enableDictionary
+	config.EvolveSchema = evolveSchema
+	config.DetectDates = detectDates
+	config.EJSON = ejson
+	config.DetectTimestamps = detectTimestamps
+	config.AssumeUTC = assumeUTC
+
+	switch timestampFormat {
+	case parqat.TimestampMicros, parqat.TimestampMillis, parqat.TimestampInt96:
+		config.TimestampFormat = timestampFormat
+	default:
+		return config, fmt.Errorf("invalid --timestamp-format %q: want micros, millis or int96", timestampFormat)
+	}
+	config.UUIDColumns = uuidColumns
+	config.BinaryColumns = binaryColumns
+	config.SortBy = sortBy
+	config.BloomColumns = bloomColumns
+	config.StatsColumns = statsColumns
+	config.NoStats = noStats
+	config.TempDir = tempDir
+	config.Limit = limitRows
+	config.Verify = verifyOutput
+
+	// --head is --limit by another name, so both directions take the first N rows the same way
+	if head > 0 {
+		if limitRows > 0 && limitRows != int64(head) {
+			return config, fmt.Errorf("--head and --limit both set the number of rows to convert; use one")
+		}
+		config.Limit = int64(head)
+	}
+	config.Tail = int64(tail)
+
+	if verifyOutput && (enableStreaming || appendMode) {
+		return config, fmt.Errorf("--verify cannot be combined with --streaming or --append")
+	}
+	if (config.AutoCodec || config.AutoTune) && appendMode {
+		return config, fmt.Errorf("--compression auto and --auto-tune cannot be combined with --append, which rewrites the whole file")
+	}
+	config.PartitionBy = partitionBy
+	config.KeepPartitionColumn = keepPartitionColumn
+	config.MaxOpenFiles = maxOpenFiles
+	config.NoTemp = noTemp
+	config.KeepTemp = keepTemp
+	config.DumpSchema = dumpSchemaPath
+	config.AvroSchema = avroSchemaPath
+	config.SchemaName = schemaName
+
+	if maxMemory != "" {
+		budget, err := parseByteSize(maxMemory)
+		if err != nil {
+			return config, fmt.Errorf("invalid --max-memory %q: %w", maxMemory, err)
+		}
+		config.MaxMemory = budget
+	}
+	if maxFileBytes != "" {
+		limit, err := parseByteSize(maxFileBytes)
+		if err != nil {
+			return config, fmt.Errorf("invalid --max-file-bytes %q: %w", maxFileBytes, err)
+		}
+		config.MaxFileBytes = limit
+	}
+
+	if skipInvalid {
+		config.InvalidRow = func(err *parqat.DecodeError) {
+			skippedRows++
+			fmt.Fprintf(os.Stderr, "skipping invalid row (%d so far): %v\n", skippedRows, err)
+		}
+	}
+
+	config.Dedupe = dedupe
+	config.DedupeBy = dedupeBy
+	config.DuplicateRow = func(int) { duplicateRows++ }
+
+	if (dumpSchemaPath != "" || avroSchemaPath != "" || schemaName != "row") && appendMode {
+		return config, fmt.Errorf("--dump-schema, --avro-schema and --schema-name cannot be combined with --append, which keeps the existing file's schema")
+	}
+	if schemaPath != "" {
+		schema, err := parqat.LoadSchemaFile(schemaPath)
+		if err != nil {
+			return config, err
+		}
+		config.Schema = schema
+	}
+
+	if noTemp && enableStreaming {
+		return config, fmt.Errorf("--no-temp cannot be combined with --streaming, which needs a temp file for its second pass")
+	}
+	if noTemp && maxMemory != "" {
+		return config, fmt.Errorf("--no-temp cannot be combined with --max-memory, which needs a temp file to read piped input again")
+	}
+
+	decimals, err := parseDecimalColumns(decimalColumns)
+	if err != nil {
+		return config, err
+	}
+	config.DecimalColumns = decimals
+	if enumThreshold < 0 {
+		return config, fmt.Errorf("invalid --enum-threshold %d: want 0 or more", enumThreshold)
+	}
+	config.EnumThreshold = enumThreshold
+
+	switch onTypeConflict {
+	case parqat.TypeConflictString, parqat.TypeConflictError, parqat.TypeConflictMajority:
+		config.OnTypeConflict = onTypeConflict
+	default:
+		return config, fmt.Errorf("invalid --on-type-conflict %q: want string, error or majority", onTypeConflict)
+	}
+
+	if requiredThreshold < 0 || requiredThreshold > 1 {
+		return config, fmt.Errorf("invalid --required-threshold %g: want a share between 0 and 1", requiredThreshold)
+	}
+	config.RequiredThreshold = requiredThreshold
+	switch onRequiredNull {
+	case parqat.RequiredNullError, parqat.RequiredNullDrop:
+		config.OnRequiredNull = onRequiredNull
+	default:
+		return config, fmt.Errorf("invalid --on-required-null %q: want error or drop", onRequiredNull)
+	}
+	if onRequiredNull == parqat.RequiredNullDrop {
+		config.DroppedRow = func(record int, err error) {
+			droppedRows++
+			fmt.Fprintf(os.Stderr, "dropping row (%d so far): %v\n", droppedRows, err)
+		}
+	}
+	if config.Defaults, err = parseDefaults(defaultValues); err != nil {
+		return config, err
+	}
+	config.Defaulted = func(record int, field string) {
+		if defaultedValues == nil {
+			defaultedValues = make(map[string]int)
+		}
+		defaultedValues[field]++
+	}
+
+	if defaultEncoding != "" {
+		name := strings.ToUpper(defaultEncoding)
+		if !slices.Contains(parqat.EncodingNames(), name) {
+			return config, fmt.Errorf("invalid --default-encoding %q (valid: %s)", defaultEncoding, strings.Join(parqat.EncodingNames(), ", "))
+		}
+		config.DefaultEncodingType = name
+	}
+
+	encodings, err := parseColumnEncodings(columnEncodings)
+	if err != nil {
+		return config, err
+	}
+	config.ColumnEncodings = encodings
+	config.DeltaColumns = deltaColumns
+
+	rename, err := parseRenames(renames)
+	if err != nil {
+		return config, err
+	}
+	config.Rename = rename
+
+	if unwrapPrefix != "" && unwrap == "" {
+		return config, fmt.Errorf("--unwrap-prefix requires --unwrap")
+	}
+	config.Unwrap = unwrap
+	config.UnwrapPrefix = unwrapPrefix
+
+	switch normalizeKeys {
+	case "", parqat.KeysTrim, parqat.KeysLower, parqat.KeysSnake:
+		config.NormalizeKeys = normalizeKeys
+	default:
+		return config, fmt.Errorf("invalid --normalize-keys %q: want trim, lower or snake", normalizeKeys)
+	}
+	if strictKeys && normalizeKeys == "" {
+		return config, fmt.Errorf("--strict-keys requires --normalize-keys")
+	}
+	config.StrictKeys = strictKeys
+	config.DroppedKey = func(record int, kept, dropped string) {
+		if droppedKeys == nil {
+			droppedKeys = make(map[[2]string]int)
+		}
+		droppedKeys[[2]string{kept, dropped}]++
+	}
+
+	hints, err := parseTypeHints(typeHints)
+	if err != nil {
+		return config, err
+	}
+	config.TypeHints = hints
+
+	meta, err := parseColumnMeta(columnMeta)
+	if err != nil {
+		return config, err
+	}
+	config.ColumnMeta = meta
+	config.CreatedBy = createdBy
+
+	return config, nil
+}
 
-	return config
+// parseDecimalColumns parses --decimal-columns entries of the form name:precision:scale.
+func parseDecimalColumns(specs []string) (map[string]parqat.DecimalSpec, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	decimals := make(map[string]parqat.DecimalSpec, len(specs))
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --decimal-columns entry %q: want name:precision:scale", spec)
+		}
+		if _, dup := decimals[parts[0]]; dup {
+			return nil, fmt.Errorf("invalid --decimal-columns entry %q: column %s given twice", spec, parts[0])
+		}
+		precision, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid precision in --decimal-columns entry %q: %w", spec, err)
+		}
+		scale, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid scale in --decimal-columns entry %q: %w", spec, err)
+		}
+		decimals[parts[0]] = parqat.DecimalSpec{Precision: precision, Scale: scale}
+	}
+	return decimals, nil
 }
 
+// parseColumnEncodings parses --encoding entries of the form name:ENCODING.
+func parseColumnEncodings(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	valid := parqat.EncodingNames()
+	encodings := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, enc, ok := strings.Cut(spec, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --encoding entry %q: want name:ENCODING", spec)
+		}
+		enc = strings.ToUpper(enc)
+		if !slices.Contains(valid, enc) {
+			return nil, fmt.Errorf("invalid --encoding entry %q: unknown encoding (valid: %s)", spec, strings.Join(valid, ", "))
+		}
+		if _, dup := encodings[name]; dup {
+			return nil, fmt.Errorf("invalid --encoding entry %q: column %s given twice", spec, name)
+		}
+		encodings[name] = enc
+	}
+	return encodings, nil
+}
+
+// parseTypeHints parses --type-hint entries of the form name:type.
+func parseTypeHints(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	valid := parqat.TypeHintNames()
+	hints := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, typ, ok := strings.Cut(spec, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --type-hint entry %q: want name:type", spec)
+		}
+		if !slices.Contains(valid, typ) {
+			return nil, fmt.Errorf("invalid --type-hint entry %q: unknown type %q (valid: %s)", spec, typ, strings.Join(valid, ", "))
+		}
+		if _, dup := hints[name]; dup {
+			return nil, fmt.Errorf("invalid --type-hint entry %q: %s already has a type hint", spec, name)
+		}
+		hints[name] = typ
+	}
+	return hints, nil
+}
+
+// parseDefaults parses --default entries of the form field:value.
+func parseDefaults(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	defaults := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --default entry %q: want field:value", spec)
+		}
+		if _, dup := defaults[name]; dup {
+			return nil, fmt.Errorf("invalid --default entry %q: %s already has a default", spec, name)
+		}
+		defaults[name] = value
+	}
+	return defaults, nil
+}
+
+// parseColumnMeta parses --column-meta entries of the form name=description.
+func parseColumnMeta(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	meta := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, description, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --column-meta entry %q: want name=description", spec)
+		}
+		if _, dup := meta[name]; dup {
+			return nil, fmt.Errorf("invalid --column-meta entry %q: %s already has a description", spec, name)
+		}
+		meta[name] = description
+	}
+	return meta, nil
+}
+
+// envPlaceholder matches the $VAR and ${VAR} placeholders of output paths.
+var envPlaceholder = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
 /*
-ToParquetWithConfig wraps ToParquet with a custom WriterConfig.
-It allows fine-tuned control over Parquet writing parameters.
+expandEnvPath expands $VAR and ${VAR} in an output path (e.g. out-${JOB_ID}.parquet) from the
+environment; any other $ is kept as it is. Unset or empty variables are an error unless
+allowEmpty is set, so a job can't silently write to out-.parquet.
 */
-func ToParquetWithConfig(w io.Writer, r io.Reader, config WriterConfig) error {
-	return toParquetOptimized(w, r, config)
+func expandEnvPath(path string, allowEmpty bool) (string, error) {
+	var missing string
+	expanded := envPlaceholder.ReplaceAllStringFunc(path, func(placeholder string) string {
+		name := strings.Trim(placeholder, "${}")
+		value := os.Getenv(name)
+		if value == "" && !allowEmpty && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("output path %s: environment variable %s is unset or empty (use --allow-empty-env to expand it to nothing)", path, missing)
+	}
+	return expanded, nil
+}
+
+// parseRenames parses --rename entries of the form old:new.
+func parseRenames(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	rename := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		old, name, ok := strings.Cut(spec, ":")
+		if !ok || old == "" || name == "" {
+			return nil, fmt.Errorf("invalid --rename entry %q: want old:new", spec)
+		}
+		if _, dup := rename[old]; dup {
+			return nil, fmt.Errorf("invalid --rename entry %q: %s is already renamed", spec, old)
+		}
+		for other, taken := range rename {
+			if taken == name {
+				return nil, fmt.Errorf("invalid --rename entry %q: %s is already renamed to %s", spec, other, name)
+			}
+		}
+		rename[old] = name
+	}
+	return rename, nil
+}
+
+// parseCasts parses --cast entries of the form column:cast; the casts are checked when reading.
+func parseCasts(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	cast := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		column, to, ok := strings.Cut(spec, ":")
+		if !ok || column == "" || to == "" {
+			return nil, fmt.Errorf("invalid --cast entry %q: want column:cast", spec)
+		}
+		if _, dup := cast[column]; dup {
+			return nil, fmt.Errorf("invalid --cast entry %q: %s is already cast", spec, column)
+		}
+		cast[column] = to
+	}
+	return cast, nil
+}
+
+// byteUnits maps size suffixes to their multiples of a byte; all of them are powers of 1024.
+var byteUnits = map[string]int64{
+	"": 1, "B": 1,
+	"K": 1 << 10, "KB": 1 << 10, "KIB": 1 << 10,
+	"M": 1 << 20, "MB": 1 << 20, "MIB": 1 << 20,
+	"G": 1 << 30, "GB": 1 << 30, "GIB": 1 << 30,
+	"T": 1 << 40, "TB": 1 << 40, "TIB": 1 << 40,
+}
+
+// parseByteSize parses a size such as 512MB, 2G or 1048576 into bytes.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	digits := strings.TrimRightFunc(s, unicode.IsLetter)
+	unit, ok := byteUnits[strings.ToUpper(strings.TrimSpace(s[len(digits):]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit (valid: B, KB, MB, GB, TB)")
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(digits), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("want a size such as 512MB")
+	}
+	if n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("size too large")
+	}
+	return n * unit, nil
+}
+
+/*
+appendToParquetFile appends the JSON rows from input to the Parquet file at path.
+Parquet footers can't be extended in place, so the existing row groups and the new rows are
+written to a temporary file next to path, which then replaces the original.
+*/
+func appendToParquetFile(path string, input io.Reader, config parqat.WriterConfig) error {
+	existing, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file %s: %w", path, err)
+	}
+	defer existing.Close()
+
+	fileInfo, err := existing.Stat()
+	if err != nil {
+		return fmt.Errorf("getting file info for %s: %w", path, err)
+	}
+
+	pr, err := parquet.OpenFile(existing, fileInfo.Size())
+	if err != nil {
+		return fmt.Errorf("opening parquet file %s: %w", path, err)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".parqat_append_*.parquet")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tempFile.Name()) // No-op once renamed
+
+	if err := parqat.AppendToParquet(tempFile, pr, input, config); err != nil {
+		tempFile.Close()
+		return err
+	}
+	// CreateTemp makes the file 0600; the rewritten file keeps the original's permissions
+	if err := tempFile.Chmod(fileInfo.Mode().Perm()); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("setting permissions of temp file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("closing temp file: %w", err)
+	}
+
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	return nil
 }
@@ -2,301 +2,512 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/spf13/cobra"
+
+	"parqat/pkg/parqat"
 )
 
-func TestToParquet(t *testing.T) {
+func TestVersionInfo(t *testing.T) {
+	// Test that version variables are set
+	if version == "" {
+		t.Error("version variable is empty")
+	}
+	if company == "" {
+		t.Error("company variable is empty")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	decodeErr := &parqat.DecodeError{Record: 3, Offset: 42, Err: fmt.Errorf("invalid character")}
+	if got := exitCode(fmt.Errorf("converting: %w", decodeErr)); got != exitInvalidInput {
+		t.Errorf("exitCode(decode error) = %d, want %d", got, exitInvalidInput)
+	}
+	if got := exitCode(fmt.Errorf("opening file: no such file")); got != exitError {
+		t.Errorf("exitCode(other error) = %d, want %d", got, exitError)
+	}
+}
+
+func TestWriteJSONError(t *testing.T) {
 	tests := []struct {
-		name     string
-		input    string
-		expected bool // true if should succeed
+		err  error
+		want string
 	}{
 		{
-			name:     "simple JSON object",
-			input:    `{"name": "John", "age": 30, "active": true}`,
-			expected: true,
-		},
-		{
-			name:     "multiple JSON objects",
-			input:    `{"name": "John", "age": 30}` + "\n" + `{"name": "Jane", "age": 25}`,
-			expected: true,
-		},
-		{
-			name:     "empty input",
-			input:    "",
-			expected: true,
-		},
-		{
-			name:     "invalid JSON",
-			input:    `{"name": "John", "age":`,
-			expected: false,
-		},
-		{
-			name:     "JSON with array",
-			input:    `{"name": "John", "hobbies": ["reading", "coding"]}`,
-			expected: true,
-		},
-		{
-			name:     "JSON with null values",
-			input:    `{"name": "John", "middle_name": null, "age": 30}`,
-			expected: true,
+			inStage("write", fmt.Errorf("converting: %w", &parqat.DecodeError{Record: 3, Offset: 0, Err: fmt.Errorf("invalid character")})),
+			`{"error":"converting: decoding json at record 3 (offset 0): invalid character","code":"invalid_input","exit_code":2,"stage":"decode","record":3,"offset":0}`,
 		},
+		{inStage("read", fmt.Errorf("no such file")), `{"error":"no such file","code":"error","exit_code":1,"stage":"read"}`},
+		{fmt.Errorf("boom"), `{"error":"boom","code":"error","exit_code":1}`},
 	}
-
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			input := strings.NewReader(tt.input)
-			output := &bytes.Buffer{}
-
-			err := ToParquet(output, input)
-			if tt.expected && err != nil {
-				t.Errorf("ToParquet() error = %v, want nil", err)
-			}
-			if !tt.expected && err == nil {
-				t.Errorf("ToParquet() error = nil, want error")
-			}
-
-			if tt.expected && err == nil {
-				// Verify we can read the parquet data back
-				if output.Len() > 0 {
-					reader := parquet.NewGenericReader[any](bytes.NewReader(output.Bytes()))
-					defer reader.Close()
-
-					// Try to read at least one row to verify format
-					rows := make([]any, 1)
-					_, readErr := reader.Read(rows)
-					if readErr != nil && readErr != io.EOF {
-						t.Errorf("Failed to read back parquet data: %v", readErr)
-					}
-				}
-			}
-		})
+		var buf bytes.Buffer
+		writeJSONError(&buf, tt.err)
+		if got := strings.TrimSpace(buf.String()); got != tt.want {
+			t.Errorf("writeJSONError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+	if inStage("read", nil) != nil {
+		t.Error("inStage(nil) != nil")
 	}
 }
 
-func TestFromParquet(t *testing.T) {
-	// Create a test parquet file
-	testData := []map[string]any{
-		{"name": "John", "age": 30.0, "active": true},
-		{"name": "Jane", "age": 25.0, "active": false},
-		{"name": "Bob", "age": 35.0, "active": true},
+func TestParseTypeHints(t *testing.T) {
+	hints, err := parseTypeHints([]string{"age:int64", "zip:string"})
+	if err != nil {
+		t.Fatalf("parseTypeHints() error = %v", err)
+	}
+	if hints["age"] != "int64" || hints["zip"] != "string" {
+		t.Errorf("parseTypeHints() = %v", hints)
 	}
 
-	// Convert to parquet
-	parquetBuf := &bytes.Buffer{}
-	schema := parquet.NewSchema("test", parquet.Group{
-		"name":   parquet.Optional(parquet.String()),
-		"age":    parquet.Optional(parquet.Leaf(parquet.DoubleType)),
-		"active": parquet.Optional(parquet.Leaf(parquet.BooleanType)),
-	})
+	for _, specs := range [][]string{{"age"}, {":int64"}, {"age:integer"}, {"age:int64", "age:string"}} {
+		if _, err := parseTypeHints(specs); err == nil {
+			t.Errorf("parseTypeHints(%q) error = nil, want error", specs)
+		}
+	}
+}
 
-	err := parquet.Write(parquetBuf, testData, schema)
+func TestParseDecimalColumns(t *testing.T) {
+	decimals, err := parseDecimalColumns([]string{"amount:10:2", "rate:18:4"})
 	if err != nil {
-		t.Fatalf("Failed to create test parquet data: %v", err)
+		t.Fatalf("parseDecimalColumns() error = %v", err)
+	}
+	want := map[string]parqat.DecimalSpec{"amount": {Precision: 10, Scale: 2}, "rate": {Precision: 18, Scale: 4}}
+	if !reflect.DeepEqual(decimals, want) {
+		t.Errorf("parseDecimalColumns() = %v, want %v", decimals, want)
 	}
 
-	tests := []struct {
-		name         string
-		head         int
-		tail         int
-		expectedRows int
-	}{
-		{
-			name:         "read all rows",
-			head:         0,
-			tail:         0,
-			expectedRows: 3,
-		},
-		{
-			name:         "read first 2 rows",
-			head:         2,
-			tail:         0,
-			expectedRows: 2,
-		},
-		{
-			name:         "read last 1 row",
-			head:         0,
-			tail:         1,
-			expectedRows: 1,
-		},
-		{
-			name:         "read first 10 rows (more than available)",
-			head:         10,
-			tail:         0,
-			expectedRows: 3,
-		},
-		{
-			name:         "read last 10 rows (more than available)",
-			head:         0,
-			tail:         10,
-			expectedRows: 3,
-		},
+	for _, specs := range [][]string{{"amount:10"}, {":10:2"}, {"amount:x:2"}, {"amount:10:2", "amount:18:4"}} {
+		if _, err := parseDecimalColumns(specs); err == nil {
+			t.Errorf("parseDecimalColumns(%q) error = nil, want error", specs)
+		}
 	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			input := bytes.NewReader(parquetBuf.Bytes())
-			output := &bytes.Buffer{}
-
-			err := FromParquet(output, input, tt.head, tt.tail)
-			if err != nil {
-				t.Errorf("FromParquet() error = %v, want nil", err)
-			}
-
-			// Count JSON lines in output
-			outputStr := output.String()
-			lines := strings.Split(strings.TrimSpace(outputStr), "\n")
-			if outputStr == "" {
-				lines = []string{}
-			}
-
-			if len(lines) != tt.expectedRows {
-				t.Errorf("FromParquet() returned %d rows, want %d", len(lines), tt.expectedRows)
-			}
-		})
+func TestParseColumnEncodings(t *testing.T) {
+	encodings, err := parseColumnEncodings([]string{"id:delta_binary_packed", "name:PLAIN"})
+	if err != nil {
+		t.Fatalf("parseColumnEncodings() error = %v", err)
+	}
+	if want := map[string]string{"id": "DELTA_BINARY_PACKED", "name": "PLAIN"}; !reflect.DeepEqual(encodings, want) {
+		t.Errorf("parseColumnEncodings() = %v, want %v", encodings, want)
+	}
+
+	for _, specs := range [][]string{{"id"}, {":PLAIN"}, {"id:ZIGZAG"}, {"id:PLAIN", "id:RLE_DICTIONARY"}} {
+		if _, err := parseColumnEncodings(specs); err == nil {
+			t.Errorf("parseColumnEncodings(%q) error = nil, want error", specs)
+		}
 	}
 }
 
-func TestRoundTrip(t *testing.T) {
-	// Test that JSON -> Parquet -> JSON preserves data
-	testCases := []string{
-		`{"name": "John", "age": 30, "active": true}`,
-		`{"name": "Jane", "age": 25, "active": false}` + "\n" + `{"name": "Bob", "age": 35, "active": true}`,
-		`{"id": 1, "value": null, "score": 99.5}`,
-	}
-
-	for i, testCase := range testCases {
-		t.Run(fmt.Sprintf("roundtrip_%d", i), func(t *testing.T) {
-			// JSON -> Parquet
-			jsonInput := strings.NewReader(testCase)
-			parquetBuf := &bytes.Buffer{}
-			err := ToParquet(parquetBuf, jsonInput)
-			if err != nil {
-				t.Fatalf("ToParquet() error = %v", err)
-			}
-
-			// Parquet -> JSON
-			parquetInput := bytes.NewReader(parquetBuf.Bytes())
-			jsonOutput := &bytes.Buffer{}
-			err = FromParquet(jsonOutput, parquetInput, 0, 0)
-			if err != nil {
-				t.Fatalf("FromParquet() error = %v", err)
-			}
-
-			// Verify we got some output
-			if jsonOutput.Len() == 0 {
-				t.Error("Round trip produced no output")
-			}
-
-			// For more complex validation, we could parse both JSON inputs and outputs
-			// and compare the data structures, but for now just verify we get valid JSON
-			outputStr := strings.TrimSpace(jsonOutput.String())
-			if outputStr != "" {
-				lines := strings.Split(outputStr, "\n")
-				for _, line := range lines {
-					var obj map[string]any
-					if err := json.Unmarshal([]byte(line), &obj); err != nil {
-						t.Errorf("Round trip produced invalid JSON: %v", err)
-					}
-				}
-			}
-		})
+func TestParseRenames(t *testing.T) {
+	rename, err := parseRenames([]string{"userId:user_id", "firstName:first_name"})
+	if err != nil {
+		t.Fatalf("parseRenames() error = %v", err)
+	}
+	if want := map[string]string{"userId": "user_id", "firstName": "first_name"}; !reflect.DeepEqual(rename, want) {
+		t.Errorf("parseRenames() = %v, want %v", rename, want)
+	}
+
+	for _, specs := range [][]string{{"userId"}, {":id"}, {"id:"}, {"a:x", "a:y"}, {"a:x", "b:x"}} {
+		if _, err := parseRenames(specs); err == nil {
+			t.Errorf("parseRenames(%q) error = nil, want error", specs)
+		}
 	}
 }
 
-func TestEmptyFile(t *testing.T) {
-	// Test empty parquet file
-	emptyParquetBuf := &bytes.Buffer{}
-	schema := parquet.NewSchema("empty", parquet.Group{
-		"dummy": parquet.Optional(parquet.String()),
-	})
+func TestParseCasts(t *testing.T) {
+	cast, err := parseCasts([]string{"id:string", "ts:epoch_millis"})
+	if err != nil {
+		t.Fatalf("parseCasts() error = %v", err)
+	}
+	if want := map[string]string{"id": "string", "ts": "epoch_millis"}; !reflect.DeepEqual(cast, want) {
+		t.Errorf("parseCasts() = %v, want %v", cast, want)
+	}
 
-	err := parquet.Write(emptyParquetBuf, []map[string]any{}, schema)
+	for _, specs := range [][]string{{"id"}, {":string"}, {"id:"}, {"id:string", "id:epoch_millis"}} {
+		if _, err := parseCasts(specs); err == nil {
+			t.Errorf("parseCasts(%q) error = nil, want error", specs)
+		}
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	defaults, err := parseDefaults([]string{"count:0", "note:a:b"})
 	if err != nil {
-		t.Fatalf("Failed to create empty parquet file: %v", err)
+		t.Fatalf("parseDefaults() error = %v", err)
+	}
+	if want := map[string]string{"count": "0", "note": "a:b"}; !reflect.DeepEqual(defaults, want) {
+		t.Errorf("parseDefaults() = %v, want %v", defaults, want)
 	}
 
-	input := bytes.NewReader(emptyParquetBuf.Bytes())
-	output := &bytes.Buffer{}
+	for _, specs := range [][]string{{"count"}, {":0"}, {"count:0", "count:1"}} {
+		if _, err := parseDefaults(specs); err == nil {
+			t.Errorf("parseDefaults(%q) error = nil, want error", specs)
+		}
+	}
+}
 
-	err = FromParquet(output, input, 0, 0)
+func TestParseColumnMeta(t *testing.T) {
+	meta, err := parseColumnMeta([]string{"price=USD amount, before tax", "note=a=b"})
 	if err != nil {
-		t.Errorf("FromParquet() with empty file error = %v, want nil", err)
+		t.Fatalf("parseColumnMeta() error = %v", err)
+	}
+	if want := map[string]string{"price": "USD amount, before tax", "note": "a=b"}; !reflect.DeepEqual(meta, want) {
+		t.Errorf("parseColumnMeta() = %v, want %v", meta, want)
 	}
 
-	if output.Len() != 0 {
-		t.Errorf("FromParquet() with empty file produced output, want empty")
+	for _, specs := range [][]string{{"price"}, {"=USD amount"}, {"price=USD", "price=EUR"}} {
+		if _, err := parseColumnMeta(specs); err == nil {
+			t.Errorf("parseColumnMeta(%q) error = nil, want error", specs)
+		}
 	}
 }
 
-func TestVersionInfo(t *testing.T) {
-	// Test that version variables are set
-	if version == "" {
-		t.Error("version variable is empty")
+func TestParseDelimiter(t *testing.T) {
+	tests := map[string]rune{`\t`: '\t', "|": '|', ";": ';', "\t": '\t'}
+	for input, want := range tests {
+		got, err := parseDelimiter(input)
+		if err != nil || got != want {
+			t.Errorf("parseDelimiter(%q) = %q, %v; want %q", input, got, err, want)
+		}
 	}
-	if company == "" {
-		t.Error("company variable is empty")
+	if _, err := parseDelimiter("||"); err == nil {
+		t.Error("parseDelimiter(\"||\") error = nil, want error")
+	}
+}
+
+func TestParseRowRange(t *testing.T) {
+	tests := map[string][2]int64{"10234-10240": {10234, 10240}, "7": {7, 7}, "0-0": {0, 0}, " 3 - 5 ": {3, 5}}
+	for input, want := range tests {
+		first, last, err := parseRowRange(input)
+		if err != nil || first != want[0] || last != want[1] {
+			t.Errorf("parseRowRange(%q) = %d, %d, %v; want %d, %d", input, first, last, err, want[0], want[1])
+		}
+	}
+	for _, input := range []string{"", "-5", "5-", "a-b", "9-3", "1-2-3"} {
+		if _, _, err := parseRowRange(input); err == nil {
+			t.Errorf("parseRowRange(%q) error = nil, want error", input)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{"1048576": 1 << 20, "512MB": 512 << 20, "2g": 2 << 30, "64 KiB": 64 << 10, "10B": 10}
+	for input, want := range tests {
+		got, err := parseByteSize(input)
+		if err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "MB", "1.5GB", "-1MB", "12PB", "99999999999TB"} {
+		if _, err := parseByteSize(input); err == nil {
+			t.Errorf("parseByteSize(%q) error = nil, want error", input)
+		}
+	}
+}
+
+func TestExpandEnvPath(t *testing.T) {
+	t.Setenv("JOB_ID", "42")
+	t.Setenv("EMPTY", "")
+	if got, err := expandEnvPath("out/${JOB_ID}/run-$JOB_ID.parquet", false); err != nil || got != "out/42/run-42.parquet" {
+		t.Errorf("expandEnvPath() = %q, %v; want out/42/run-42.parquet", got, err)
+	}
+	for _, path := range []string{"out-${PARQAT_UNSET_VAR}.parquet", "out-$EMPTY.parquet"} {
+		if _, err := expandEnvPath(path, false); err == nil {
+			t.Errorf("expandEnvPath(%q) error = nil, want error", path)
+		}
+	}
+	if got, err := expandEnvPath("out-${PARQAT_UNSET_VAR}.parquet", true); err != nil || got != "out-.parquet" {
+		t.Errorf("expandEnvPath() with empty allowed = %q, %v; want out-.parquet", got, err)
+	}
+	// A $ that isn't a placeholder is part of the name
+	if got, err := expandEnvPath("cost$/$5-${JOB_ID}-${bad name}-$.parquet", false); err != nil || got != "cost$/$5-42-${bad name}-$.parquet" {
+		t.Errorf("expandEnvPath() = %q, %v; want cost$/$5-42-${bad name}-$.parquet", got, err)
+	}
+}
+
+func TestTeeOutput(t *testing.T) {
+	defer func() { teePath = "" }()
+	teePath = filepath.Join(t.TempDir(), "copy.json")
+
+	var stdout bytes.Buffer
+	w, closeTee, err := teeOutput(&stdout)
+	if err != nil {
+		t.Fatalf("teeOutput() error = %v", err)
+	}
+	fmt.Fprintln(w, `{"id":1}`)
+	if err := closeTee(); err != nil {
+		t.Fatalf("closing tee file: %v", err)
+	}
+	copied, err := os.ReadFile(teePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != `{"id":1}`+"\n" || string(copied) != stdout.String() {
+		t.Errorf("wrote %q and tee file %q, want both %q", stdout.String(), copied, `{"id":1}`+"\n")
+	}
+
+	teePath = filepath.Join(t.TempDir(), "missing", "copy.json")
+	if _, _, err := teeOutput(&stdout); err == nil {
+		t.Error("teeOutput() into a missing directory error = nil, want error")
+	}
+}
+
+func TestSameFile(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.parquet")
+	if err := os.WriteFile(out, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.parquet")
+	if err := os.Symlink(out, link); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: out, b: link, want: true},
+		{a: out, b: filepath.Join(dir, "sub", "..", "out.parquet"), want: true},
+		{a: filepath.Join(dir, "new.parquet"), b: filepath.Join(dir, ".", "new.parquet"), want: true},
+		{a: out, b: filepath.Join(dir, "new.parquet"), want: false},
+	}
+	for _, tt := range tests {
+		if got := sameFile(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameFile(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAppendToParquetFileKeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.parquet")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parqat.ToParquet(file, strings.NewReader(`{"id": 1}`)); err != nil {
+		t.Fatalf("ToParquet() error = %v", err)
+	}
+	file.Close()
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := appendToParquetFile(path, strings.NewReader(`{"id": 2}`), parqat.DefaultWriterConfig()); err != nil {
+		t.Fatalf("appendToParquetFile() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o640 {
+		t.Errorf("mode after append = %v, want -rw-r-----", mode)
 	}
 }
 
-// Helper function to create a temporary file for testing
-func createTempFile(t *testing.T, content string) *os.File {
-	file, err := os.CreateTemp("", "parqat_test_*.tmp")
+func TestMergeWriterFlags(t *testing.T) {
+	defer func() { compressionType, createdBy, mergeOutput = "zstd", "", "" }()
+	dir := t.TempDir()
+	var inputs []string
+	for i, row := range []string{`{"id": 1}`, `{"id": 2}`} {
+		path := filepath.Join(dir, fmt.Sprintf("in%d.parquet", i))
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parqat.ToParquet(file, strings.NewReader(row)); err != nil {
+			t.Fatalf("ToParquet() error = %v", err)
+		}
+		file.Close()
+		inputs = append(inputs, path)
+	}
+
+	if err := mergeCmd.ParseFlags([]string{"--compression", "gzip", "--created-by", "nightly-merge", "-o", filepath.Join(dir, "merged.parquet")}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+	if err := mergeCmd.RunE(mergeCmd, inputs); err != nil {
+		t.Fatalf("merge error = %v", err)
+	}
+	file, err := os.Open(mergeOutput)
 	if err != nil {
-		t.Fatalf("Failed to create temp file: %v", err)
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+	pf, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if got := pf.Metadata().CreatedBy; got != "nightly-merge" {
+		t.Errorf("merged created_by = %q, want nightly-merge", got)
+	}
+	if got := pf.Metadata().RowGroups[0].Columns[0].MetaData.Codec; got != format.Gzip {
+		t.Errorf("merged codec = %v, want GZIP", got)
 	}
 
-	if _, err := file.WriteString(content); err != nil {
-		t.Fatalf("Failed to write to temp file: %v", err)
+	compressionType = "auto"
+	if err := mergeCmd.RunE(mergeCmd, inputs); err == nil {
+		t.Error("merge with --compression auto error = nil, want error")
 	}
+}
 
-	if _, err := file.Seek(0, 0); err != nil {
-		t.Fatalf("Failed to seek temp file: %v", err)
+func TestDefaultsFileModeArgs(t *testing.T) {
+	defer func() { countRows = false; rootCmd.SetArgs(nil) }()
+	dir := t.TempDir()
+	var inputs []string
+	for i := range 2 {
+		path := filepath.Join(dir, fmt.Sprintf("in%d.parquet", i))
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parqat.ToParquet(file, strings.NewReader(`{"id": 1}`)); err != nil {
+			t.Fatalf("ToParquet() error = %v", err)
+		}
+		file.Close()
+		inputs = append(inputs, path)
 	}
+	defaults := filepath.Join(dir, "defaults.json")
+	if err := os.WriteFile(defaults, []byte(`{"count": true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PARQAT_CONFIG", defaults)
 
-	return file
+	// --count from the defaults file takes several files, as it does on the command line
+	rootCmd.SetArgs(inputs)
+	if err := rootCmd.Execute(); err != nil {
+		t.Errorf("Execute() with count from the defaults file error = %v", err)
+	}
 }
 
-func TestFromParquetFile(t *testing.T) {
-	// Create test data
-	testData := []map[string]any{
-		{"name": "Alice", "score": 95.5},
-		{"name": "Bob", "score": 87.2},
+func TestProcessTempDir(t *testing.T) {
+	defer func() { keepTemp = false }()
+	parent := t.TempDir()
+
+	for _, keep := range []bool{false, true} {
+		keepTemp = keep
+		dir, cleanup, err := processTempDir(parent)
+		if err != nil {
+			t.Fatalf("processTempDir() error = %v", err)
+		}
+		if prefix := fmt.Sprintf("parqat-%d-", os.Getpid()); filepath.Dir(dir) != parent || !strings.HasPrefix(filepath.Base(dir), prefix) {
+			t.Errorf("processTempDir() = %s, want %s/%s*", dir, parent, prefix)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "spool.json"), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cleanup()
+		if _, err := os.Stat(dir); keep != (err == nil) {
+			t.Errorf("with keepTemp %v, after cleanup Stat(%s) error = %v", keep, dir, err)
+		}
 	}
 
-	// Create a temporary parquet file
-	tempFile := createTempFile(t, "")
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
+	if _, _, err := processTempDir(filepath.Join(parent, "missing")); err == nil {
+		t.Error("processTempDir() under a missing directory error = nil, want error")
+	}
+}
 
-	schema := parquet.NewSchema("test", parquet.Group{
-		"name":  parquet.Optional(parquet.String()),
-		"score": parquet.Optional(parquet.Leaf(parquet.DoubleType)),
+func TestReadEach(t *testing.T) {
+	defer func() { maxOpenFiles = 0 }()
+	paths := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+
+	for _, limit := range []int{0, 1, 2} {
+		maxOpenFiles = limit
+		got, err := readEach(paths, func(path string) (int, error) { return len(path), nil })
+		if err != nil {
+			t.Fatalf("readEach() error = %v", err)
+		}
+		if want := []int{1, 2, 3, 4, 5}; !slices.Equal(got, want) {
+			t.Errorf("with --max-open-files %d, readEach() = %v, want %v", limit, got, want)
+		}
+	}
+
+	// The first failing path in argument order wins, whichever read finished first
+	maxOpenFiles = 1
+	_, err := readEach(paths, func(path string) (int, error) {
+		if len(path) > 2 {
+			return 0, fmt.Errorf("bad %s", path)
+		}
+		return len(path), nil
 	})
+	if err == nil || err.Error() != "bad ccc" {
+		t.Errorf("readEach() error = %v, want bad ccc", err)
+	}
+}
 
-	err := parquet.Write(tempFile, testData, schema)
-	if err != nil {
-		t.Fatalf("Failed to write test parquet file: %v", err)
+func TestCodecNames(t *testing.T) {
+	want := []string{"auto", "gzip", "none", "snappy", "zstd"}
+	if got := codecNames(); !slices.Equal(got, want) {
+		t.Errorf("codecNames() = %v, want %v", got, want)
 	}
+	for _, name := range want[1:] {
+		if codecs[name] == nil {
+			t.Errorf("no codec for %s", name)
+		}
+	}
+}
 
-	// Test reading from file
-	output := &bytes.Buffer{}
-	err = FromParquetFile(output, tempFile.Name(), 0, 0)
-	if err != nil {
-		t.Errorf("FromParquetFile() error = %v, want nil", err)
+func TestApplyFlagDefaults(t *testing.T) {
+	var (
+		compression string
+		streaming   bool
+		columns     []string
+		limit       int64
+	)
+	cmd := &cobra.Command{Use: "test", RunE: func(*cobra.Command, []string) error { return nil }}
+	cmd.Flags().StringVar(&compression, "compression", "zstd", "")
+	cmd.Flags().BoolVar(&streaming, "streaming", false, "")
+	cmd.Flags().StringSliceVar(&columns, "columns", nil, "")
+	cmd.Flags().Int64Var(&limit, "limit", 0, "")
+	if err := cmd.ParseFlags([]string{"--compression", "snappy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeDefaults := func(content string) string {
+		path := filepath.Join(dir, "defaults.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
 	}
 
-	// Verify output
-	outputStr := strings.TrimSpace(output.String())
-	lines := strings.Split(outputStr, "\n")
-	if len(lines) != 2 {
-		t.Errorf("FromParquetFile() returned %d lines, want 2", len(lines))
+	path := writeDefaults(`{"compression": "gzip", "streaming": true, "columns": ["a", "b"], "limit": 5}`)
+	if err := applyFlagDefaults(cmd, path, true); err != nil {
+		t.Fatalf("applyFlagDefaults() error = %v", err)
+	}
+	if compression != "snappy" {
+		t.Errorf("compression = %q, want the command line's snappy", compression)
+	}
+	if !streaming || limit != 5 || !reflect.DeepEqual(columns, []string{"a", "b"}) {
+		t.Errorf("streaming, limit, columns = %t, %d, %v; want true, 5, [a b]", streaming, limit, columns)
+	}
+	if cmd.Flags().Changed("streaming") {
+		t.Error("a flag set from the defaults file reports being changed on the command line")
+	}
+
+	for _, bad := range []string{`{"stream": true}`, `{"limit": [1, 2]}`, `{"limit": "many"}`, `{"limit": {"n": 1}}`, `not json`} {
+		if err := applyFlagDefaults(cmd, writeDefaults(bad), true); err == nil {
+			t.Errorf("applyFlagDefaults(%s) error = nil, want error", bad)
+		}
+	}
+
+	missing := filepath.Join(dir, "missing.json")
+	if err := applyFlagDefaults(cmd, missing, false); err != nil {
+		t.Errorf("applyFlagDefaults() with an optional missing file error = %v", err)
+	}
+	if err := applyFlagDefaults(cmd, missing, true); err == nil {
+		t.Error("applyFlagDefaults() with a required missing file error = nil, want error")
 	}
 }
@@ -0,0 +1,577 @@
+package parqat
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+)
+
+/*
+Arrow output is written as an Arrow IPC stream: a Schema message, one RecordBatch message per
+arrowBatchRows rows and an end-of-stream marker, each message a flatbuffer followed by its
+body. There is no Arrow library among the dependencies, so the few flatbuffer tables the
+stream needs are built by hand below, following Schema.fbs and Message.fbs of the Arrow format.
+*/
+
+// arrowBatchRows is the number of rows in each record batch.
+const arrowBatchRows = 65536
+
+// Type ids of the Arrow Type union, and message header ids of the MessageHeader union.
+const (
+	arrowTypeInt           = 2
+	arrowTypeFloatingPoint = 3
+	arrowTypeBinary        = 4
+	arrowTypeUtf8          = 5
+	arrowTypeBool          = 6
+	arrowTypeDecimal       = 7
+	arrowTypeDate          = 8
+	arrowTypeTimestamp     = 10
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowMetadataV5 = 4
+)
+
+// arrowContinuation starts every message of an IPC stream.
+const arrowContinuation = 0xFFFFFFFF
+
+/*
+fbTable is a flatbuffer table under construction: its fields, each in a vtable slot, are
+inline little-endian scalars or references to other flatbuffer objects.
+*/
+type fbTable []fbField
+
+type fbField struct {
+	slot   int
+	scalar []byte
+	ref    fbObject
+}
+
+// fbObject is a flatbuffer object referenced by offset, written by fbWrite at the position it returns.
+type fbObject interface {
+	fbWrite(b *fbBuffer) int
+}
+
+func fbUint8(slot int, v uint8) fbField  { return fbField{slot: slot, scalar: []byte{v}} }
+func fbRef(slot int, v fbObject) fbField { return fbField{slot: slot, ref: v} }
+
+func fbBool(slot int, v bool) fbField {
+	if v {
+		return fbUint8(slot, 1)
+	}
+	return fbUint8(slot, 0)
+}
+
+func fbInt16(slot int, v int16) fbField {
+	return fbField{slot: slot, scalar: binary.LittleEndian.AppendUint16(nil, uint16(v))}
+}
+
+func fbInt32(slot int, v int32) fbField {
+	return fbField{slot: slot, scalar: binary.LittleEndian.AppendUint32(nil, uint32(v))}
+}
+
+func fbInt64(slot int, v int64) fbField {
+	return fbField{slot: slot, scalar: binary.LittleEndian.AppendUint64(nil, uint64(v))}
+}
+
+// size is the number of bytes the field takes inline; references are 32-bit offsets.
+func (f fbField) size() int {
+	if f.ref != nil {
+		return 4
+	}
+	return len(f.scalar)
+}
+
+/*
+fbBuffer holds a flatbuffer being written front to back. Objects always come after whatever
+refers to them, so every offset is positive as flatbuffers require, and are placed at absolute
+alignments, so the buffer must itself start 8-byte aligned.
+*/
+type fbBuffer struct {
+	data []byte
+}
+
+// align pads the buffer to a multiple of n bytes.
+func (b *fbBuffer) align(n int) {
+	for len(b.data)%n != 0 {
+		b.data = append(b.data, 0)
+	}
+}
+
+// link points the offset at pos to the object at target.
+func (b *fbBuffer) link(pos, target int) {
+	binary.LittleEndian.PutUint32(b.data[pos:], uint32(target-pos))
+}
+
+/*
+fbWrite writes the table's vtable and then the table, whose fields are laid out largest first
+so each is aligned to its size, followed by the objects the fields refer to.
+*/
+func (t fbTable) fbWrite(b *fbBuffer) int {
+	fields := slices.Clone(t)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].size() > fields[j].size() })
+	offsets := make([]int, len(fields))
+	size, alignment, slots := 4, 4, 0
+	for i, field := range fields {
+		for size%field.size() != 0 {
+			size++
+		}
+		offsets[i] = size
+		size += field.size()
+		alignment = max(alignment, field.size())
+		slots = max(slots, field.slot+1)
+	}
+
+	b.align(2)
+	vtable := len(b.data)
+	b.data = append(b.data, make([]byte, 4+2*slots)...)
+	binary.LittleEndian.PutUint16(b.data[vtable:], uint16(4+2*slots))
+	binary.LittleEndian.PutUint16(b.data[vtable+2:], uint16(size))
+	for i, field := range fields {
+		binary.LittleEndian.PutUint16(b.data[vtable+4+2*field.slot:], uint16(offsets[i]))
+	}
+
+	b.align(alignment)
+	table := len(b.data)
+	b.data = append(b.data, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.data[table:], uint32(int32(table-vtable)))
+	for i, field := range fields {
+		copy(b.data[table+offsets[i]:], field.scalar)
+	}
+	for i, field := range fields {
+		if field.ref != nil {
+			b.link(table+offsets[i], field.ref.fbWrite(b))
+		}
+	}
+	return table
+}
+
+// fbString is a flatbuffer string: its length, its bytes and a terminating zero.
+type fbString string
+
+func (s fbString) fbWrite(b *fbBuffer) int {
+	b.align(4)
+	pos := len(b.data)
+	b.data = binary.LittleEndian.AppendUint32(b.data, uint32(len(s)))
+	b.data = append(append(b.data, s...), 0)
+	return pos
+}
+
+// fbTables is a flatbuffer vector of tables.
+type fbTables []fbTable
+
+func (v fbTables) fbWrite(b *fbBuffer) int {
+	b.align(4)
+	pos := len(b.data)
+	b.data = binary.LittleEndian.AppendUint32(b.data, uint32(len(v)))
+	b.data = append(b.data, make([]byte, 4*len(v))...)
+	for i, table := range v {
+		b.link(pos+4+4*i, table.fbWrite(b))
+	}
+	return pos
+}
+
+// fbInt64Pairs is a flatbuffer vector of structs of two int64s, like FieldNode and Buffer.
+type fbInt64Pairs [][2]int64
+
+func (v fbInt64Pairs) fbWrite(b *fbBuffer) int {
+	// The elements, which follow the length, need 8-byte alignment
+	b.align(4)
+	if len(b.data)%8 == 0 {
+		b.data = append(b.data, 0, 0, 0, 0)
+	}
+	pos := len(b.data)
+	b.data = binary.LittleEndian.AppendUint32(b.data, uint32(len(v)))
+	for _, pair := range v {
+		b.data = binary.LittleEndian.AppendUint64(b.data, uint64(pair[0]))
+		b.data = binary.LittleEndian.AppendUint64(b.data, uint64(pair[1]))
+	}
+	return pos
+}
+
+// fbFinish returns the flatbuffer with root as its root table, padded to a multiple of 8 bytes.
+func fbFinish(root fbTable) []byte {
+	b := &fbBuffer{data: make([]byte, 4)}
+	b.link(0, root.fbWrite(b))
+	b.align(8)
+	return b.data
+}
+
+// writeArrowMessage writes one encapsulated IPC message: its header flatbuffer and its body.
+func writeArrowMessage(w io.Writer, headerType uint8, header fbTable, body []byte) error {
+	metadata := fbFinish(fbTable{
+		fbInt16(0, arrowMetadataV5),
+		fbUint8(1, headerType),
+		fbRef(2, header),
+		fbInt64(3, int64(len(body))),
+	})
+	prefix := binary.LittleEndian.AppendUint32(nil, arrowContinuation)
+	prefix = binary.LittleEndian.AppendUint32(prefix, uint32(len(metadata)))
+	for _, part := range [][]byte{prefix, metadata, body} {
+		if _, err := w.Write(part); err != nil {
+			return fmt.Errorf("writing arrow stream: %w", err)
+		}
+	}
+	return nil
+}
+
+/*
+arrowColumn converts the values of one Parquet column to an Arrow array, a record batch at a
+time. Fixed-width types have a value buffer of width bytes per row, booleans a bitmap, and
+variable-length types (width 0) an offset buffer and a data buffer.
+*/
+type arrowColumn struct {
+	name     string
+	field    string // the Parquet field the values come from
+	nullable bool
+	typeType uint8
+	typ      fbTable
+	width    int
+	bitmap   bool
+	// encode appends the bytes of a non-null value: width bytes, one 0/1 byte for bitmaps, or
+	// the value's data for variable-length types
+	encode func(dst []byte, value any) ([]byte, error)
+
+	length, nulls int
+	validity      []byte
+	values        []byte
+	data          []byte
+}
+
+// arrowColumnFor returns the Arrow column for a top-level Parquet field, output as name.
+func arrowColumnFor(field parquet.Field, name string) *arrowColumn {
+	column := &arrowColumn{name: name, field: field.Name(), nullable: !field.Required()}
+	utf8 := func(encode func(dst []byte, value any) ([]byte, error)) *arrowColumn {
+		column.typeType, column.typ, column.encode = arrowTypeUtf8, fbTable{}, encode
+		return column
+	}
+	fixed := func(typeType uint8, typ fbTable, width int, encode func(dst []byte, value any) ([]byte, error)) *arrowColumn {
+		column.typeType, column.typ, column.width, column.encode = typeType, typ, width, encode
+		return column
+	}
+
+	if !field.Leaf() || field.Repeated() {
+		// Groups, lists and maps have no primitive Arrow type; they are written as JSON text
+		return utf8(func(dst []byte, value any) ([]byte, error) {
+			encoded, err := json.Marshal(value)
+			return append(dst, encoded...), err
+		})
+	}
+
+	kind, lt := field.Type().Kind(), field.Type().LogicalType()
+	switch {
+	case kind == parquet.Int96:
+		return fixed(arrowTypeTimestamp, arrowTimestamp(3, true), 8, func(dst []byte, value any) ([]byte, error) {
+			v, ok := value.(deprecated.Int96)
+			if !ok {
+				return nil, fmt.Errorf("unexpected %T value", value)
+			}
+			nanos, err := unixNano(int96ToTime(v))
+			if err != nil {
+				return nil, err
+			}
+			return binary.LittleEndian.AppendUint64(dst, uint64(nanos)), nil
+		})
+	case lt != nil && lt.Decimal != nil:
+		typ := fbTable{fbInt32(0, lt.Decimal.Precision), fbInt32(1, lt.Decimal.Scale), fbInt32(2, 128)}
+		return fixed(arrowTypeDecimal, typ, 16, appendDecimal128)
+	case lt != nil && lt.Timestamp != nil:
+		unit := int16(3)
+		switch {
+		case lt.Timestamp.Unit.Millis != nil:
+			unit = 1
+		case lt.Timestamp.Unit.Micros != nil:
+			unit = 2
+		}
+		return fixed(arrowTypeTimestamp, arrowTimestamp(unit, lt.Timestamp.IsAdjustedToUTC), 8, appendInteger)
+	case lt != nil && lt.Date != nil:
+		return fixed(arrowTypeDate, fbTable{fbInt16(0, 0)}, 4, appendInteger)
+	case lt != nil && lt.UUID != nil:
+		return utf8(func(dst []byte, value any) ([]byte, error) {
+			id, ok := value.([]byte)
+			if !ok || len(id) != 16 {
+				return nil, fmt.Errorf("unexpected %T value", value)
+			}
+			return append(dst, formatUUID(id)...), nil
+		})
+	case kind == parquet.Boolean:
+		column.bitmap = true
+		return fixed(arrowTypeBool, fbTable{}, 0, func(dst []byte, value any) ([]byte, error) {
+			v, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("unexpected %T value", value)
+			}
+			if v {
+				return append(dst, 1), nil
+			}
+			return append(dst, 0), nil
+		})
+	case kind == parquet.Int32 || kind == parquet.Int64:
+		width := 4
+		if kind == parquet.Int64 {
+			width = 8
+		}
+		signed := lt == nil || lt.Integer == nil || lt.Integer.IsSigned
+		return fixed(arrowTypeInt, fbTable{fbInt32(0, int32(8*width)), fbBool(1, signed)}, width, appendInteger)
+	case kind == parquet.Float:
+		return fixed(arrowTypeFloatingPoint, fbTable{fbInt16(0, 1)}, 4, func(dst []byte, value any) ([]byte, error) {
+			v, ok := value.(float32)
+			if !ok {
+				return nil, fmt.Errorf("unexpected %T value", value)
+			}
+			return binary.LittleEndian.AppendUint32(dst, math.Float32bits(v)), nil
+		})
+	case kind == parquet.Double:
+		return fixed(arrowTypeFloatingPoint, fbTable{fbInt16(0, 2)}, 8, func(dst []byte, value any) ([]byte, error) {
+			v, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("unexpected %T value", value)
+			}
+			return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v)), nil
+		})
+	}
+
+	// Byte arrays: text when annotated as such, raw bytes otherwise
+	column.typeType, column.typ, column.encode = arrowTypeBinary, fbTable{}, appendBytes
+	if lt != nil && (lt.UTF8 != nil || lt.Enum != nil || lt.Json != nil) {
+		column.typeType = arrowTypeUtf8
+	}
+	return column
+}
+
+// arrowTimestamp returns the Arrow Timestamp type in unit (0-3 for seconds to nanoseconds).
+func arrowTimestamp(unit int16, utc bool) fbTable {
+	typ := fbTable{fbInt16(0, unit)}
+	if utc {
+		typ = append(typ, fbRef(1, fbString("UTC")))
+	}
+	return typ
+}
+
+// appendInteger appends an integer value with the byte width of its Go type.
+func appendInteger(dst []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case int32:
+		return binary.LittleEndian.AppendUint32(dst, uint32(v)), nil
+	case uint32:
+		return binary.LittleEndian.AppendUint32(dst, v), nil
+	case int64:
+		return binary.LittleEndian.AppendUint64(dst, uint64(v)), nil
+	case uint64:
+		return binary.LittleEndian.AppendUint64(dst, v), nil
+	}
+	return nil, fmt.Errorf("unexpected %T value", value)
+}
+
+// appendBytes appends the bytes of a string or byte slice value.
+func appendBytes(dst []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return append(dst, v...), nil
+	case []byte:
+		return append(dst, v...), nil
+	}
+	return nil, fmt.Errorf("unexpected %T value", value)
+}
+
+/*
+appendDecimal128 appends the unscaled value of a decimal as a 128-bit little-endian two's
+complement integer, from either integer storage or big-endian bytes.
+*/
+func appendDecimal128(dst []byte, value any) ([]byte, error) {
+	var unscaled [16]byte
+	switch v := value.(type) {
+	case int32:
+		return appendDecimal128(dst, int64(v))
+	case int64:
+		binary.LittleEndian.PutUint64(unscaled[:], uint64(v))
+		if v < 0 {
+			binary.LittleEndian.PutUint64(unscaled[8:], math.MaxUint64)
+		}
+	case string:
+		return appendDecimal128(dst, []byte(v))
+	case []byte:
+		if len(v) == 0 || len(v) > 16 {
+			return nil, fmt.Errorf("decimal of %d bytes does not fit in 128 bits", len(v))
+		}
+		if v[0]&0x80 != 0 {
+			for i := range unscaled {
+				unscaled[i] = 0xFF
+			}
+		}
+		for i, b := range v {
+			unscaled[len(v)-1-i] = b
+		}
+	default:
+		return nil, fmt.Errorf("unexpected %T value", value)
+	}
+	return append(dst, unscaled[:]...), nil
+}
+
+// add appends one value to the column, null included.
+func (c *arrowColumn) add(value any) error {
+	if c.length%8 == 0 {
+		c.validity = append(c.validity, 0)
+		if c.bitmap {
+			c.values = append(c.values, 0)
+		}
+	}
+	if c.width == 0 && !c.bitmap && c.length == 0 {
+		c.values = binary.LittleEndian.AppendUint32(c.values, 0)
+	}
+
+	switch {
+	case value == nil:
+		c.nulls++
+		if c.width > 0 {
+			c.values = append(c.values, make([]byte, c.width)...)
+		}
+	case c.bitmap:
+		encoded, err := c.encode(nil, value)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", c.name, err)
+		}
+		c.validity[c.length/8] |= 1 << (c.length % 8)
+		c.values[c.length/8] |= encoded[0] << (c.length % 8)
+	case c.width > 0:
+		var err error
+		if c.values, err = c.encode(c.values, value); err != nil {
+			return fmt.Errorf("column %s: %w", c.name, err)
+		}
+		c.validity[c.length/8] |= 1 << (c.length % 8)
+	default:
+		var err error
+		if c.data, err = c.encode(c.data, value); err != nil {
+			return fmt.Errorf("column %s: %w", c.name, err)
+		}
+		if len(c.data) > math.MaxInt32 {
+			return fmt.Errorf("column %s: more than 2 GiB of data in one record batch", c.name)
+		}
+		c.validity[c.length/8] |= 1 << (c.length % 8)
+	}
+	if c.width == 0 && !c.bitmap {
+		c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(c.data)))
+	}
+	c.length++
+	return nil
+}
+
+// buffers returns the column's Arrow buffers, in layout order, and resets it for the next batch.
+func (c *arrowColumn) buffers() [][]byte {
+	buffers := [][]byte{c.validity, c.values}
+	if c.width == 0 && !c.bitmap {
+		buffers = append(buffers, c.data)
+	}
+	c.length, c.nulls = 0, 0
+	c.validity, c.values, c.data = nil, nil, nil
+	return buffers
+}
+
+// arrowField returns the Field table describing the column in the Schema message.
+func (c *arrowColumn) arrowField() fbTable {
+	return fbTable{
+		fbRef(0, fbString(c.name)),
+		fbBool(1, c.nullable),
+		fbUint8(2, c.typeType),
+		fbRef(3, c.typ),
+		fbRef(5, fbTables{}),
+	}
+}
+
+// writeRecordBatch writes the values added to columns as one RecordBatch message.
+func writeRecordBatch(w io.Writer, columns []*arrowColumn) error {
+	length := columns[0].length
+	var nodes, buffers fbInt64Pairs
+	var body []byte
+	for _, column := range columns {
+		nodes = append(nodes, [2]int64{int64(column.length), int64(column.nulls)})
+		for _, buffer := range column.buffers() {
+			buffers = append(buffers, [2]int64{int64(len(body)), int64(len(buffer))})
+			body = append(body, buffer...)
+			for len(body)%8 != 0 {
+				body = append(body, 0)
+			}
+		}
+	}
+	header := fbTable{fbInt64(0, int64(length)), fbRef(1, nodes), fbRef(2, buffers)}
+	return writeArrowMessage(w, arrowHeaderRecordBatch, header, body)
+}
+
+/*
+writeArrow writes the rows of pr selected by config to bw as an Arrow IPC stream with the
+columns of schema, the projection of pr's schema. Values keep their Parquet types where Arrow
+has a matching one; nested columns are written as JSON strings.
+*/
+func writeArrow(ctx context.Context, bw *bufio.Writer, pr *parquet.File, schema *parquet.Schema, config ReaderConfig) error {
+	switch {
+	case config.Flatten:
+		return fmt.Errorf("flattening only applies to json, csv and tsv output")
+	case config.NullAs != nil || config.OmitNulls || config.FloatPrecision > 0 || config.Delimiter != 0:
+		return fmt.Errorf("null tokens, omitted nulls, float precision and delimiters only apply to text output, not arrow")
+	}
+
+	var names []string
+	for _, field := range schema.Fields() {
+		names = append(names, field.Name())
+	}
+	renamed, err := renameColumns(names, config.Rename)
+	if err != nil {
+		return err
+	}
+	columns := make([]*arrowColumn, len(names))
+	fields := make(fbTables, len(names))
+	for i, field := range schema.Fields() {
+		columns[i] = arrowColumnFor(field, renamed[i])
+		fields[i] = columns[i].arrowField()
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("arrow output needs at least one column")
+	}
+	if err := writeArrowMessage(bw, arrowHeaderSchema, fbTable{fbInt16(0, 0), fbRef(1, fields)}, nil); err != nil {
+		return err
+	}
+
+	err = readRows(ctx, pr, config, func(row any) error {
+		values, _ := row.(map[string]any)
+		for _, column := range columns {
+			if err := column.add(values[column.field]); err != nil {
+				return err
+			}
+		}
+		if columns[0].length < arrowBatchRows {
+			return nil
+		}
+		if err := writeRecordBatch(bw, columns); err != nil {
+			return err
+		}
+		if config.LineBuffered {
+			return bw.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if columns[0].length > 0 {
+		if err := writeRecordBatch(bw, columns); err != nil {
+			return err
+		}
+	}
+
+	// End of stream: a continuation marker with an empty message
+	eos := binary.LittleEndian.AppendUint32(nil, arrowContinuation)
+	if _, err := bw.Write(append(eos, 0, 0, 0, 0)); err != nil {
+		return fmt.Errorf("writing arrow stream: %w", err)
+	}
+	return bw.Flush()
+}
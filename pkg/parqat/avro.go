@@ -0,0 +1,157 @@
+package parqat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// AvroSchema is an Avro record schema, as written by WriterConfig.AvroSchema.
+type AvroSchema struct {
+	Type   string      `json:"type"`
+	Name   string      `json:"name"`
+	Fields []AvroField `json:"fields"`
+}
+
+// AvroField is one field of an AvroSchema. Nullable fields are a union with null, which is also
+// their default.
+type AvroField struct {
+	Name    string          `json:"name"`
+	Type    any             `json:"type"`
+	Default json.RawMessage `json:"default,omitempty"`
+}
+
+// avroName is the syntax Avro requires of record and field names.
+var avroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// avroTypes maps SchemaField types to Avro types, with logical types where Avro has one.
+var avroTypes = map[string]any{
+	"boolean":          "boolean",
+	"int32":            "int",
+	"int64":            "long",
+	"float":            "float",
+	"double":           "double",
+	"string":           "string",
+	"binary":           "bytes",
+	"enum":             "string", // Avro enums need their symbols, which Parquet doesn't keep
+	"date":             map[string]string{"type": "int", "logicalType": "date"},
+	"uuid":             map[string]string{"type": "string", "logicalType": "uuid"},
+	"timestamp_millis": map[string]string{"type": "long", "logicalType": "timestamp-millis"},
+	"timestamp_micros": map[string]string{"type": "long", "logicalType": "timestamp-micros"},
+	"timestamp_nanos":  map[string]string{"type": "long", "logicalType": "timestamp-nanos"},
+	"timestamp_int96":  map[string]string{"type": "long", "logicalType": "timestamp-nanos"},
+}
+
+/*
+DescribeAvroSchema translates a schema built by this package, or a nested one, into the equivalent
+Avro record schema named name. Only the schema is translated; Parquet output is unaffected. Avro is stricter
+about names than JSON, so fields that aren't valid Avro names are an error rather than renamed.
+*/
+func DescribeAvroSchema(schema *parquet.Schema, name string) (*AvroSchema, error) {
+	if !avroName.MatchString(name) {
+		return nil, fmt.Errorf("schema name %q is not a valid Avro name", name)
+	}
+	described, err := DescribeSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := avroFields(described.Fields, name)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroSchema{Type: "record", Name: name, Fields: fields}, nil
+}
+
+// avroFields translates fields into the fields of the Avro record named record.
+func avroFields(fields []SchemaField, record string) ([]AvroField, error) {
+	avroFields := []AvroField{}
+	for _, field := range fields {
+		if !avroName.MatchString(field.Name) {
+			return nil, fmt.Errorf("field %q is not a valid Avro name", field.Name)
+		}
+		avroType, err := avroFieldType(field, record)
+		if err != nil {
+			return nil, err
+		}
+
+		avroField := AvroField{Name: field.Name, Type: avroType}
+		if field.Nullable {
+			avroField.Type = []any{"null", avroType}
+			avroField.Default = json.RawMessage("null")
+		}
+		avroFields = append(avroFields, avroField)
+	}
+	return avroFields, nil
+}
+
+/*
+avroFieldType returns the Avro type of the values of field, a field of the record named record.
+Groups become records named after the path to them, since Avro names must be unique; lists and
+repeated fields become arrays, and maps with string keys become maps.
+*/
+func avroFieldType(field SchemaField, record string) (any, error) {
+	if field.Repeated {
+		field.Repeated, field.Nullable = false, false
+		items, err := avroFieldType(field, record)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	}
+
+	switch field.Type {
+	case "decimal":
+		return map[string]any{"type": "bytes", "logicalType": "decimal", "precision": field.Precision, "scale": field.Scale}, nil
+	case "group":
+		name := record + "_" + field.Name
+		fields, err := avroFields(field.Fields, name)
+		if err != nil {
+			return nil, err
+		}
+		return AvroSchema{Type: "record", Name: name, Fields: fields}, nil
+	case "list", "map":
+		values := field.Fields[len(field.Fields)-1]
+		if field.Type == "map" && field.Fields[0].Type != "string" {
+			return nil, fmt.Errorf("field %s: Avro map keys are strings, not %s", field.Name, field.Fields[0].Type)
+		}
+		valueType, err := avroFieldType(values, record+"_"+field.Name)
+		if err != nil {
+			return nil, err
+		}
+		if values.Nullable {
+			valueType = []any{"null", valueType}
+		}
+		if field.Type == "map" {
+			return map[string]any{"type": "map", "values": valueType}, nil
+		}
+		return map[string]any{"type": "array", "items": valueType}, nil
+	}
+	avroType, ok := avroTypes[field.Type]
+	if !ok {
+		return nil, fmt.Errorf("field %s: no Avro type for %s", field.Name, field.Type)
+	}
+	return avroType, nil
+}
+
+// dumpAvroSchema writes the Avro form of schema to config.AvroSchema, if set, as indented JSON.
+func dumpAvroSchema(schema *parquet.Schema, config WriterConfig) error {
+	if config.AvroSchema == "" {
+		return nil
+	}
+	record, err := DescribeAvroSchema(schema, schemaName(config))
+	if err != nil {
+		return fmt.Errorf("describing avro schema: %w", err)
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding avro schema: %w", err)
+	}
+	if err := os.WriteFile(config.AvroSchema, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing avro schema file: %w", err)
+	}
+	return nil
+}
@@ -1,7 +1,8 @@
-package main
+package parqat
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -33,7 +34,7 @@ func BenchmarkOptimizedToParquet(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		var buf bytes.Buffer
-		err := toParquetOptimized(&buf, strings.NewReader(data), config)
+		err := toParquetOptimized(context.Background(), &buf, strings.NewReader(data), config)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -88,7 +89,7 @@ func BenchmarkCompressionComparison(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				var buf bytes.Buffer
-				err := toParquetOptimized(&buf, strings.NewReader(data), config)
+				err := toParquetOptimized(context.Background(), &buf, strings.NewReader(data), config)
 				if err != nil {
 					b.Fatal(err)
 				}
@@ -131,7 +132,7 @@ func TestCompressionRatio(t *testing.T) {
 		config := configFunc()
 		var buf bytes.Buffer
 		start := time.Now()
-		err := toParquetOptimized(&buf, strings.NewReader(data), config)
+		err := toParquetOptimized(context.Background(), &buf, strings.NewReader(data), config)
 		duration := time.Since(start)
 
 		if err != nil {
@@ -172,7 +173,7 @@ func TestSchemaInference(t *testing.T) {
 	// Test with optimized schema inference
 	var buf bytes.Buffer
 	config := DefaultWriterConfig()
-	err := toParquetOptimized(&buf, strings.NewReader(data), config)
+	err := toParquetOptimized(context.Background(), &buf, strings.NewReader(data), config)
 	if err != nil {
 		t.Fatalf("Schema inference failed: %v", err)
 	}
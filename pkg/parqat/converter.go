@@ -0,0 +1,125 @@
+package parqat
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+/*
+Converter converts many JSON inputs to Parquet files that all share one schema and one set of
+writer settings. The schema is either pinned up front or inferred from the first input that has
+rows, and AutoCodec and AutoTune are settled on that input too, as is the parquet-go writer
+config built from them; later inputs skip all of it. Later rows are checked against the schema
+directly: a field it doesn't have or a required field left null refuses the input, and a value of
+the wrong type fails when it is written. A Converter is not safe for concurrent use.
+*/
+type Converter struct {
+	config       WriterConfig
+	schema       *parquet.Schema
+	writerConfig *parquet.WriterConfig
+	prepared     bool
+}
+
+/*
+NewConverter returns a Converter writing with config. If schema is not nil, every file is written
+with it; otherwise the schema is inferred from the first input with rows, as ToParquetWithConfig
+would infer it. The parts of config that name columns are checked against a pinned schema here.
+*/
+func NewConverter(config WriterConfig, schema *parquet.Schema) (*Converter, error) {
+	c := &Converter{config: config, schema: schema}
+	if schema != nil {
+		var err error
+		if c.writerConfig, err = newParquetWriterConfig(schema, config); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Schema returns the schema the converter writes with, or nil before it has seen any rows.
+func (c *Converter) Schema() *parquet.Schema {
+	return c.schema
+}
+
+// Convert writes the JSON rows read from r to w as one Parquet file with the converter's schema.
+func (c *Converter) Convert(w io.Writer, r io.Reader) error {
+	return c.ConvertContext(context.Background(), w, r)
+}
+
+/*
+ConvertContext is Convert with cancellation: it returns ctx's error once ctx is done. An empty
+input is written as a file with no rows once the schema is known, and as nothing before that.
+*/
+func (c *Converter) ConvertContext(ctx context.Context, w io.Writer, r io.Reader) error {
+	// Every row is held in memory, so there's no streaming fallback past MaxMemory
+	rows, records, order, err := readAllRows(ctx, r, c.config, nil)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 && c.schema == nil {
+		return nil
+	}
+
+	inferred := c.schema == nil
+	if inferred {
+		if c.schema, err = buildOptimizedSchema(rows, order, c.config); err != nil {
+			return fmt.Errorf("building schema: %w", err)
+		}
+	}
+
+	if rows, records, err = admitRows(rows, records, c.schema, c.config); err != nil {
+		return err
+	}
+	if !inferred {
+		if err := c.checkRows(rows, records); err != nil {
+			return fmt.Errorf("input doesn't match the converter's schema: %w", err)
+		}
+	}
+	if !c.prepared && len(rows) > 0 {
+		if err := dumpSchema(c.schema, c.config); err != nil {
+			return err
+		}
+		if c.config, err = chooseWriterSettings(rows, c.schema, c.config); err != nil {
+			return err
+		}
+		if c.writerConfig, err = newParquetWriterConfig(c.schema, c.config); err != nil {
+			return err
+		}
+		c.prepared = true
+	}
+	if c.writerConfig == nil {
+		// An empty input after an inferred schema but before any rows were admitted
+		if c.writerConfig, err = newParquetWriterConfig(c.schema, c.config); err != nil {
+			return err
+		}
+	}
+	return writeVerifiedRows(ctx, w, rows, records, c.schema, c.writerConfig, c.config)
+}
+
+/*
+checkRows reports whether rows fit the converter's schema: every field must be a leaf column of
+it, and no required column may be null or missing. Value types are left to the row coercer.
+*/
+func (c *Converter) checkRows(rows []map[string]any, records []int) error {
+	fields := c.schema.Fields()
+	for i, row := range rows {
+		for name := range row {
+			field, ok := c.schema.Lookup(name)
+			if !ok {
+				return fmt.Errorf("record %d: field %q is not in the schema", recordNumber(records, i), name)
+			}
+			if !field.Node.Leaf() {
+				return fmt.Errorf("record %d: field %q is a nested group in the schema", recordNumber(records, i), name)
+			}
+		}
+		for _, field := range fields {
+			if field.Required() && row[field.Name()] == nil {
+				return fmt.Errorf("record %d: required field %q is null or missing", recordNumber(records, i), field.Name())
+			}
+		}
+	}
+	return nil
+}
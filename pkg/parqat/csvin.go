@@ -0,0 +1,168 @@
+package parqat
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+/*
+CSVInputConfig controls how CSVToJSON turns CSV cells into JSON values. Tokens are matched
+case-insensitively against whole cells; a cell matching none of them is a number when it is
+a valid JSON number and a string otherwise.
+*/
+type CSVInputConfig struct {
+	// Delimiter separates fields; zero means a comma.
+	Delimiter rune
+	// TrueTokens and FalseTokens are the cells read as booleans, so all-boolean columns are
+	// written as BOOLEAN instead of strings.
+	TrueTokens  []string
+	FalseTokens []string
+	// NullTokens are the cells read as null.
+	NullTokens []string
+	// NoHeader reads the first record as data rather than column names. The columns are then
+	// named by Names, in order, or col0, col1 and so on if Names is empty.
+	NoHeader bool
+	Names    []string
+}
+
+// DefaultCSVInputConfig reads true/false as booleans and empty cells and null as nulls.
+func DefaultCSVInputConfig() CSVInputConfig {
+	return CSVInputConfig{
+		TrueTokens:  []string{"true"},
+		FalseTokens: []string{"false"},
+		NullTokens:  []string{"", "null"},
+	}
+}
+
+/*
+CSVToJSON returns a reader of newline-delimited JSON objects, one per record of the CSV in r,
+keyed by the header row, or the names config gives for headerless CSV, and in their column
+order. Records are converted as they are read, so the result streams into any of the JSON
+writers. A record with another number of fields than there are columns is an error.
+*/
+func CSVToJSON(r io.Reader, config CSVInputConfig) io.Reader {
+	cr := csv.NewReader(r)
+	if config.Delimiter != 0 {
+		cr.Comma = config.Delimiter
+	}
+	cr.FieldsPerRecord = -1 // Checked against the columns, to name the record
+	cr.ReuseRecord = true
+	return &csvInput{r: cr, config: config}
+}
+
+// csvInput converts CSV records to JSON lines on demand.
+type csvInput struct {
+	r      *csv.Reader
+	config CSVInputConfig
+	header [][]byte // JSON-encoded column names
+	record int      // 1-based index of the last data record read
+	buf    bytes.Buffer
+	err    error
+}
+
+func (c *csvInput) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.err = c.next()
+	}
+	return c.buf.Read(p)
+}
+
+// next converts the next record into buf, reading the header row first.
+func (c *csvInput) next() error {
+	if c.header == nil && !c.config.NoHeader {
+		names, err := c.r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return io.EOF // Empty input
+			}
+			return fmt.Errorf("reading csv header: %w", err)
+		}
+		if err := c.setHeader(names); err != nil {
+			return err
+		}
+	}
+
+	record, err := c.r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return fmt.Errorf("reading csv: %w", err)
+	}
+	c.record++
+	if c.header == nil {
+		names := c.config.Names
+		if len(names) == 0 {
+			for i := range record {
+				names = append(names, fmt.Sprintf("col%d", i))
+			}
+		}
+		if err := c.setHeader(names); err != nil {
+			return err
+		}
+	}
+	if len(record) != len(c.header) {
+		return fmt.Errorf("csv record %d has %d fields, want %d", c.record, len(record), len(c.header))
+	}
+
+	c.buf.WriteByte('{')
+	for i, cell := range record {
+		if i > 0 {
+			c.buf.WriteByte(',')
+		}
+		c.buf.Write(c.header[i])
+		c.buf.WriteByte(':')
+		c.writeValue(cell)
+	}
+	c.buf.WriteString("}\n")
+	return nil
+}
+
+// setHeader sets the names of the columns, which must differ.
+func (c *csvInput) setHeader(names []string) error {
+	for i, name := range names {
+		if slices.Contains(names[:i], name) {
+			return fmt.Errorf("duplicate csv column %q", name)
+		}
+		encoded, _ := json.Marshal(name)
+		c.header = append(c.header, encoded)
+	}
+	return nil
+}
+
+// writeValue writes the JSON form of one cell to buf.
+func (c *csvInput) writeValue(cell string) {
+	matches := func(tokens []string) bool {
+		return slices.ContainsFunc(tokens, func(token string) bool { return strings.EqualFold(cell, token) })
+	}
+	switch {
+	case matches(c.config.NullTokens):
+		c.buf.WriteString("null")
+	case matches(c.config.TrueTokens):
+		c.buf.WriteString("true")
+	case matches(c.config.FalseTokens):
+		c.buf.WriteString("false")
+	case isJSONNumber(cell):
+		c.buf.WriteString(cell)
+	default:
+		encoded, _ := json.Marshal(cell)
+		c.buf.Write(encoded)
+	}
+}
+
+// isJSONNumber reports whether s is a number in JSON syntax, which rules out forms like
+// 0123 or +1 whose leading characters would be lost.
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
@@ -0,0 +1,6 @@
+/*
+Package parqat converts between newline-delimited JSON and Parquet.
+It holds the conversion logic behind the parqat CLI so it can be used from other Go programs
+without pulling in the command-line interface.
+*/
+package parqat
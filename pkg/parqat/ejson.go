@@ -0,0 +1,203 @@
+package parqat
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Values unwrapped from MongoDB Extended JSON keep a type of their own until the schema is built,
+so a column of $numberLong values is inferred as INT64 rather than DOUBLE and so on. Each holds
+the plain JSON form of its value, which is what the row coercer (through plainEJSON) and
+encoding/json (for values nested in objects and arrays) see.
+*/
+type (
+	ejsonLong    string // the digits of a $numberLong
+	ejsonDecimal string // the text of a $numberDecimal
+	ejsonDate    string // a $date as an RFC 3339 UTC timestamp
+	ejsonBinary  string // the base64 payload of a $binary
+)
+
+// Types of the values above, for schema inference.
+var (
+	ejsonLongType    = reflect.TypeOf(ejsonLong(""))
+	ejsonDecimalType = reflect.TypeOf(ejsonDecimal(""))
+	ejsonDateType    = reflect.TypeOf(ejsonDate(""))
+	ejsonBinaryType  = reflect.TypeOf(ejsonBinary(""))
+)
+
+func (v ejsonLong) MarshalJSON() ([]byte, error)    { return []byte(v), nil }
+func (v ejsonDecimal) MarshalJSON() ([]byte, error) { return json.Marshal(json.Number(v)) }
+func (v ejsonDate) MarshalJSON() ([]byte, error)    { return json.Marshal(string(v)) }
+func (v ejsonBinary) MarshalJSON() ([]byte, error)  { return json.Marshal(string(v)) }
+
+// plainEJSON returns the value an unwrapped Extended JSON value stands for in plain JSON.
+func plainEJSON(value any) any {
+	switch v := value.(type) {
+	case ejsonLong:
+		return json.Number(v)
+	case ejsonDecimal:
+		return json.Number(v)
+	case ejsonDate:
+		return string(v)
+	case ejsonBinary:
+		return string(v)
+	}
+	return value
+}
+
+// unwrapEJSONRow replaces the Extended JSON wrappers in row, at any depth, in place.
+func unwrapEJSONRow(row map[string]any) error {
+	for key, value := range row {
+		unwrapped, err := unwrapEJSON(value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", key, err)
+		}
+		row[key] = unwrapped
+	}
+	return nil
+}
+
+/*
+unwrapEJSON converts the MongoDB Extended JSON wrappers $numberLong, $numberInt, $numberDouble,
+$numberDecimal, $date, $oid and $binary (both its canonical and legacy forms) into values of
+the types above, or plain numbers and strings where JSON inference already does the right
+thing. Objects that aren't wrappers are searched recursively.
+*/
+func unwrapEJSON(value any) (any, error) {
+	switch v := value.(type) {
+	case []any:
+		for i, elem := range v {
+			unwrapped, err := unwrapEJSON(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = unwrapped
+		}
+	case map[string]any:
+		if unwrapped, ok, err := unwrapWrapper(v); ok || err != nil {
+			return unwrapped, err
+		}
+		for key, field := range v {
+			unwrapped, err := unwrapEJSON(field)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = unwrapped
+		}
+	}
+	return value, nil
+}
+
+// unwrapWrapper converts object if it is an Extended JSON wrapper, reporting whether it was one.
+func unwrapWrapper(object map[string]any) (any, bool, error) {
+	if wrapped, ok := object["$binary"]; ok && (len(object) == 1 || len(object) == 2 && object["$type"] != nil) {
+		unwrapped, err := unwrapBinary(wrapped)
+		return unwrapped, true, err
+	}
+	if len(object) != 1 {
+		return nil, false, nil
+	}
+
+	for key, wrapped := range object {
+		text, isString := wrapped.(string)
+		switch key {
+		case "$numberLong":
+			if _, err := strconv.ParseInt(text, 10, 64); !isString || err != nil {
+				return nil, true, fmt.Errorf("invalid $numberLong %v", wrapped)
+			}
+			return ejsonLong(text), true, nil
+		case "$numberInt", "$numberDouble":
+			n, err := strconv.ParseFloat(text, 64)
+			if !isString || err != nil {
+				return nil, true, fmt.Errorf("invalid %s %v", key, wrapped)
+			}
+			if math.IsInf(n, 0) || math.IsNaN(n) {
+				// Rows are JSON throughout, which has no number for them
+				return nil, true, fmt.Errorf("unsupported %s %q: Infinity, -Infinity and NaN can't be converted", key, text)
+			}
+			return json.Number(text), true, nil
+		case "$numberDecimal":
+			if !isString {
+				return nil, true, fmt.Errorf("invalid $numberDecimal %v", wrapped)
+			}
+			return ejsonDecimal(text), true, nil
+		case "$oid":
+			if _, err := hex.DecodeString(text); !isString || err != nil || len(text) != 24 {
+				return nil, true, fmt.Errorf("invalid $oid %v", wrapped)
+			}
+			return text, true, nil
+		case "$date":
+			unwrapped, err := unwrapDate(wrapped)
+			return unwrapped, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// unwrapDate converts the relaxed ISO-8601 string, canonical {"$numberLong": millis} or legacy
+// millisecond forms of a $date.
+func unwrapDate(wrapped any) (any, error) {
+	var millis int64
+	switch v := wrapped.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $date %q: %w", v, err)
+		}
+		return ejsonDate(t.UTC().Format(time.RFC3339Nano)), nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid $date %s: %w", v, err)
+		}
+		millis = n
+	case map[string]any:
+		long, err := unwrapEJSON(v)
+		text, ok := long.(ejsonLong)
+		if err != nil || !ok {
+			return nil, fmt.Errorf("invalid $date %v", v)
+		}
+		millis, _ = strconv.ParseInt(string(text), 10, 64)
+	default:
+		return nil, fmt.Errorf("invalid $date %v", wrapped)
+	}
+	return ejsonDate(time.UnixMilli(millis).UTC().Format(time.RFC3339Nano)), nil
+}
+
+// unwrapBinary converts the canonical {"base64": ..., "subType": ...} or legacy string payload
+// of a $binary. The subtype is dropped; only the bytes are kept.
+func unwrapBinary(wrapped any) (any, error) {
+	payload, ok := wrapped.(string)
+	if object, isObject := wrapped.(map[string]any); isObject {
+		payload, ok = object["base64"].(string)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid $binary %v", wrapped)
+	}
+	if _, err := base64.StdEncoding.DecodeString(payload); err != nil {
+		return nil, fmt.Errorf("invalid $binary: %w", err)
+	}
+	return ejsonBinary(payload), nil
+}
+
+/*
+decimalShape returns the precision and scale a DECIMAL needs to hold the $numberDecimal text
+exactly. Exponents, NaN and infinities have no such shape.
+*/
+func decimalShape(text string) (precision, scale int, ok bool) {
+	digits := strings.TrimPrefix(text, "-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" || strings.Trim(whole+fraction, "0123456789") != "" {
+		return 0, 0, false
+	}
+	whole = strings.TrimLeft(whole, "0")
+	return len(whole) + len(fraction), len(fraction), true
+}
@@ -0,0 +1,73 @@
+package parqat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+/*
+Parquet modular encryption is not supported: parquet-go has the footer structures but no way
+to decrypt footers or pages. What this file does is recognize encrypted files, so reading one
+fails with an error saying so rather than a bad magic header or pages that decode to garbage.
+*/
+
+// encryptedMagic replaces parquetMagic in files whose footer is encrypted.
+var encryptedMagic = []byte("PARE")
+
+// openParquet is parquet.OpenFile, explaining the failure when the footer is encrypted.
+func openParquet(r io.ReaderAt, size int64, options ...parquet.FileOption) (*parquet.File, error) {
+	pr, err := parquet.OpenFile(r, size, options...)
+	if err != nil {
+		magic := make([]byte, len(encryptedMagic))
+		if _, readErr := r.ReadAt(magic, 0); readErr == nil && bytes.Equal(magic, encryptedMagic) {
+			return nil, fmt.Errorf("the file uses Parquet modular encryption with an encrypted footer, which parqat can't decrypt")
+		}
+		return nil, err
+	}
+	return pr, nil
+}
+
+// encryptedColumns returns the dotted paths of the columns of pr with encrypted chunks.
+func encryptedColumns(pr *parquet.File) []string {
+	var encrypted []string
+	columns := pr.Schema().Columns()
+	for _, rowGroup := range pr.Metadata().RowGroups {
+		for j, chunk := range rowGroup.Columns {
+			crypto := chunk.CryptoMetadata
+			if crypto.EncryptionWithFooterKey == nil && crypto.EncryptionWithColumnKey == nil || j >= len(columns) {
+				continue
+			}
+			if path := strings.Join(columns[j], "."); !slices.Contains(encrypted, path) {
+				encrypted = append(encrypted, path)
+			}
+		}
+	}
+	return encrypted
+}
+
+/*
+checkDecryptable reports an error when any column of schema, the projection of pr's schema that
+is about to be decoded, is encrypted. Files with a plaintext footer can still be read without
+their encrypted columns, and their footer metadata (row counts, layout) is readable as usual.
+*/
+func checkDecryptable(pr *parquet.File, schema *parquet.Schema) error {
+	encrypted := encryptedColumns(pr)
+	if len(encrypted) == 0 {
+		return nil
+	}
+	var selected []string
+	for _, path := range schema.Columns() {
+		if column := strings.Join(path, "."); slices.Contains(encrypted, column) {
+			selected = append(selected, column)
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	return fmt.Errorf("column %s is encrypted with Parquet modular encryption, which parqat can't decrypt; leave it out with --exclude to read the rest", strings.Join(selected, ", "))
+}
@@ -0,0 +1,63 @@
+package parqat_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+
+	"parqat/pkg/parqat"
+)
+
+// Example converts JSON rows to Parquet with the default configuration and reads them back.
+func Example() {
+	input := `{"name": "John", "age": 30, "active": true}
+{"name": "Jane", "age": 25, "active": false}
+`
+	var buf bytes.Buffer
+	if err := parqat.ToParquet(&buf, strings.NewReader(input)); err != nil {
+		panic(err)
+	}
+	if err := parqat.FromParquet(os.Stdout, bytes.NewReader(buf.Bytes()), 0, 0); err != nil {
+		panic(err)
+	}
+	// Output:
+	// {"active":true,"age":30,"name":"John"}
+	// {"active":false,"age":25,"name":"Jane"}
+}
+
+// ExampleToParquetWithConfig writes with a custom codec and row group size.
+func ExampleToParquetWithConfig() {
+	config := parqat.DefaultWriterConfig()
+	config.Codec = &parquet.Snappy
+	config.MaxRowsPerRowGroup = 2
+
+	var buf bytes.Buffer
+	input := `{"id": 1}` + "\n" + `{"id": 2}` + "\n" + `{"id": 3}` + "\n"
+	if err := parqat.ToParquetWithConfig(&buf, strings.NewReader(input), config); err != nil {
+		panic(err)
+	}
+	if err := parqat.FromParquet(os.Stdout, bytes.NewReader(buf.Bytes()), 0, 0); err != nil {
+		panic(err)
+	}
+	// Output:
+	// {"id":1}
+	// {"id":2}
+	// {"id":3}
+}
+
+// ExampleStreamingToParquet converts input too large to hold in memory, inferring the schema
+// from its first rows.
+func ExampleStreamingToParquet() {
+	var buf bytes.Buffer
+	input := `{"name": "Bob", "scores": [82, 87]}` + "\n"
+	if err := parqat.StreamingToParquet(&buf, strings.NewReader(input), parqat.DefaultWriterConfig()); err != nil {
+		panic(err)
+	}
+	if err := parqat.FromParquet(os.Stdout, bytes.NewReader(buf.Bytes()), 0, 0); err != nil {
+		panic(err)
+	}
+	// Output:
+	// {"name":"Bob","scores":"[82,87]"}
+}
@@ -0,0 +1,105 @@
+package parqat
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// FileLayout is the physical layout of a Parquet file, as DescribeLayout reads it from the footer.
+type FileLayout struct {
+	RowGroups []RowGroupLayout
+}
+
+// RowGroupLayout describes one row group and its column chunks.
+type RowGroupLayout struct {
+	Rows    int64
+	Columns []ColumnChunkLayout
+}
+
+// ColumnChunkLayout describes one column chunk. Pages is -1 when the file has no page index.
+type ColumnChunkLayout struct {
+	Path              string
+	Codec             string
+	Pages             int
+	CompressedBytes   int64
+	UncompressedBytes int64
+}
+
+/*
+DescribeLayout reads the row group and column chunk sizes of the Parquet file at filePath. Like
+DescribeParquetFile it only reads the footer (and the page index, for page counts), so no data
+pages are decoded.
+*/
+func DescribeLayout(filePath string) (*FileLayout, error) {
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	offsetIndexes := pr.OffsetIndexes()
+	layout := &FileLayout{}
+	for i, rowGroup := range pr.Metadata().RowGroups {
+		described := RowGroupLayout{Rows: rowGroup.NumRows}
+		for j, chunk := range rowGroup.Columns {
+			column := ColumnChunkLayout{
+				Path:              strings.Join(chunk.MetaData.PathInSchema, "."),
+				Codec:             strings.ToLower(chunk.MetaData.Codec.String()),
+				Pages:             -1,
+				CompressedBytes:   chunk.MetaData.TotalCompressedSize,
+				UncompressedBytes: chunk.MetaData.TotalUncompressedSize,
+			}
+			if index := i*len(rowGroup.Columns) + j; index < len(offsetIndexes) {
+				column.Pages = len(offsetIndexes[index].PageLocations)
+			}
+			described.Columns = append(described.Columns, column)
+		}
+		layout.RowGroups = append(layout.RowGroups, described)
+	}
+	return layout, nil
+}
+
+// Sizes returns the compressed and uncompressed bytes of every column chunk in the row group.
+func (g RowGroupLayout) Sizes() (compressed, uncompressed int64) {
+	for _, column := range g.Columns {
+		compressed += column.CompressedBytes
+		uncompressed += column.UncompressedBytes
+	}
+	return compressed, uncompressed
+}
+
+/*
+Describe writes a human-readable table of the layout: a line per row group followed by a line
+per column chunk, then the totals with the overall compression ratio (uncompressed / compressed).
+*/
+func (l *FileLayout) Describe(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "row group\tcolumn\tcodec\tpages\trows\tcompressed\tuncompressed\tratio")
+	var rows, compressed, uncompressed int64
+	for i, rowGroup := range l.RowGroups {
+		groupCompressed, groupUncompressed := rowGroup.Sizes()
+		fmt.Fprintf(tw, "%d\t\t\t\t%d\t%d\t%d\t%s\n", i, rowGroup.Rows, groupCompressed, groupUncompressed, ratio(groupUncompressed, groupCompressed))
+		for _, column := range rowGroup.Columns {
+			pages := "-"
+			if column.Pages >= 0 {
+				pages = fmt.Sprint(column.Pages)
+			}
+			fmt.Fprintf(tw, "\t%s\t%s\t%s\t\t%d\t%d\t%s\n", column.Path, column.Codec, pages, column.CompressedBytes, column.UncompressedBytes, ratio(column.UncompressedBytes, column.CompressedBytes))
+		}
+		rows += rowGroup.Rows
+		compressed += groupCompressed
+		uncompressed += groupUncompressed
+	}
+	fmt.Fprintf(tw, "total\t\t\t\t%d\t%d\t%d\t%s\n", rows, compressed, uncompressed, ratio(uncompressed, compressed))
+	return tw.Flush()
+}
+
+// ratio formats uncompressed/compressed with two decimals, or "-" when nothing was compressed.
+func ratio(uncompressed, compressed int64) string {
+	if compressed == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", float64(uncompressed)/float64(compressed))
+}
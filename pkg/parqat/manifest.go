@@ -0,0 +1,85 @@
+package parqat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Manifest summarizes a written Parquet file for data catalogs, as WriteManifest saves it.
+type Manifest struct {
+	Schema    SchemaFile `json:"schema"`
+	Rows      int64      `json:"rows"`
+	RowGroups int        `json:"row_groups"`
+	// Codec is the compression codec of the column chunks, empty when there are none.
+	Codec    string `json:"codec,omitempty"`
+	FileSize int64  `json:"file_size"`
+	// NullCounts maps each column to its number of null values across all row groups.
+	NullCounts map[string]int64 `json:"null_counts"`
+}
+
+/*
+DescribeParquetFile builds the Manifest of the Parquet file at filePath. Everything comes from
+the footer metadata, so no data pages are decoded.
+*/
+func DescribeParquetFile(filePath string) (*Manifest, error) {
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	schema, err := DescribeSchema(pr.Schema())
+	if err != nil {
+		return nil, fmt.Errorf("describing schema of %s: %w", filePath, err)
+	}
+	unmarkBinary(schema.Fields, fileBinaryColumns(pr, nil))
+	manifest := &Manifest{
+		Schema:     schema,
+		Rows:       pr.NumRows(),
+		RowGroups:  len(pr.RowGroups()),
+		FileSize:   pr.Size(),
+		NullCounts: make(map[string]int64),
+	}
+
+	for _, rowGroup := range pr.Metadata().RowGroups {
+		for _, chunk := range rowGroup.Columns {
+			name := strings.Join(chunk.MetaData.PathInSchema, ".")
+			manifest.NullCounts[name] += chunk.MetaData.Statistics.NullCount
+			if manifest.Codec == "" {
+				manifest.Codec = strings.ToLower(chunk.MetaData.Codec.String())
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// WriteManifest saves the Manifest of the Parquet file at filePath to manifestPath as indented JSON.
+func WriteManifest(manifestPath, filePath string) error {
+	manifest, err := DescribeParquetFile(filePath)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestPath, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
+/*
+unmarkBinary describes the binary fields that aren't in binary as strings, since other writers
+leave text unannotated too. Only top-level columns are ever marked, so nested ones are all text.
+*/
+func unmarkBinary(fields []SchemaField, binary map[string]bool) {
+	for i, field := range fields {
+		if field.Type == "binary" && !binary[field.Name] {
+			fields[i].Type = "string"
+		}
+		unmarkBinary(field.Fields, nil)
+	}
+}
@@ -0,0 +1,224 @@
+package parqat
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+/*
+MergeParquetFiles writes the rows of the Parquet files at filePaths, in order, to w as a single
+Parquet file with the first file's schema. Rows are copied row group by row group as Parquet
+values, never going through JSON, though every page is decoded and encoded again with the
+compression and encodings of config. Row groups of files whose schema matches exactly are
+written as they are read; other files must have a compatible schema (see checkMergeSchema) and
+have their row groups converted, filling columns they lack with nulls. Besides the first file, only one
+input is open at a time, so any number of files can be merged.
+*/
+func MergeParquetFiles(w io.Writer, filePaths []string, config WriterConfig) error {
+	if len(filePaths) == 0 {
+		return fmt.Errorf("no files to merge")
+	}
+
+	first, closer, err := openParquetFile(filePaths[0])
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	schema := first.Schema()
+	recoded, err := recodedSchema(schema, config)
+	if err != nil {
+		return err
+	}
+	writerConfig, err := newParquetWriterConfig(recoded, config)
+	if err != nil {
+		return err
+	}
+	keepBinaryMeta(writerConfig, first, config.BinaryColumns)
+
+	// Check every file before writing anything
+	for i, filePath := range filePaths {
+		err := withMergeInput(first, filePath, i, func(pr *parquet.File) error {
+			if !parquet.EqualNodes(schema, pr.Schema()) {
+				if err := checkMergeSchema(schema, pr.Schema()); err != nil {
+					return fmt.Errorf("cannot merge %s into %s: %w", filePath, filePaths[0], err)
+				}
+			}
+			keepColumnMeta(writerConfig, pr)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer := parquet.NewWriter(w, writerConfig)
+	for i, filePath := range filePaths {
+		err := withMergeInput(first, filePath, i, func(pr *parquet.File) error {
+			var conv parquet.Conversion
+			if !parquet.EqualNodes(schema, pr.Schema()) {
+				var err error
+				if conv, err = parquet.Convert(schema, pr.Schema()); err != nil {
+					return fmt.Errorf("cannot merge %s into %s: %w", filePath, filePaths[0], err)
+				}
+			}
+			for j, rowGroup := range pr.RowGroups() {
+				if conv != nil {
+					rowGroup = parquet.ConvertRowGroup(rowGroup, conv)
+				}
+				if _, err := writer.WriteRowGroup(rowGroup); err != nil {
+					return fmt.Errorf("copying row group %d of %s: %w", j, filePath, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// withMergeInput passes the i-th input of a merge to fn: first, which stays open, or filePath opened for the call.
+func withMergeInput(first *parquet.File, filePath string, i int, fn func(pr *parquet.File) error) error {
+	if i == 0 {
+		return fn(first)
+	}
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	return fn(pr)
+}
+
+/*
+checkMergeSchema reports why the rows of a file with schema other can't be written with schema
+base: a column base lacks, a column of another type, nulls in a column base requires, or a
+required base column other lacks.
+*/
+func checkMergeSchema(base, other *parquet.Schema) error {
+	for _, field := range other.Fields() {
+		target, ok := base.Lookup(field.Name())
+		if !ok {
+			return fmt.Errorf("field %q is not in the first file's schema", field.Name())
+		}
+		if field.Leaf() != target.Node.Leaf() || field.Repeated() != target.Node.Repeated() {
+			return fmt.Errorf("field %q has a different structure", field.Name())
+		}
+		if !field.Leaf() {
+			if !parquet.EqualNodes(parquet.Required(field), parquet.Required(target.Node)) {
+				return fmt.Errorf("field %q has a different structure", field.Name())
+			}
+		} else if have, want := field.Type(), target.Node.Type(); have.Kind() != want.Kind() || fmt.Sprint(have.LogicalType()) != fmt.Sprint(want.LogicalType()) {
+			return fmt.Errorf("field %q is %s but %s in the first file", field.Name(), have, want)
+		}
+		if field.Optional() && target.Node.Required() {
+			return fmt.Errorf("field %q has nulls but is required in the first file", field.Name())
+		}
+	}
+
+	for _, field := range base.Fields() {
+		if _, ok := other.Lookup(field.Name()); !ok && field.Required() {
+			return fmt.Errorf("required field %q is missing", field.Name())
+		}
+	}
+	return nil
+}
+
+/*
+CompactParquetFile rewrites the Parquet file at filePath to w with the compression, encodings,
+statistics and bloom filters in config, coalescing its row groups into row groups of up to
+config.MaxRowsPerRowGroup rows. The schema stays the same and rows are copied as Parquet values,
+never going through JSON.
+*/
+func CompactParquetFile(w io.Writer, filePath string, config WriterConfig) error {
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	schema, err := recodedSchema(pr.Schema(), config)
+	if err != nil {
+		return err
+	}
+	writerConfig, err := newParquetWriterConfig(schema, config)
+	if err != nil {
+		return err
+	}
+	keepColumnMeta(writerConfig, pr)
+	keepBinaryMeta(writerConfig, pr, config.BinaryColumns)
+	writer := parquet.NewWriter(w, writerConfig)
+	for i, rowGroup := range pr.RowGroups() {
+		// Copying rows rather than the row group lets the writer fill its own row groups
+		rows := rowGroup.Rows()
+		_, err := parquet.CopyRows(writer, rows)
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("copying row group %d of %s: %w", i, filePath, err)
+		}
+	}
+	return writer.Close()
+}
+
+/*
+recodedField is a field of an existing schema written with the compression and encoding config
+asks for. parquet-go keeps the codec and encoding a file was written with on its schema nodes,
+and a writer would otherwise reuse them.
+*/
+type recodedField struct {
+	parquet.Field
+	compression compress.Codec
+	encoding    encoding.Encoding
+	fields      []parquet.Field
+}
+
+func (f *recodedField) Compression() compress.Codec { return f.compression }
+func (f *recodedField) Encoding() encoding.Encoding { return f.encoding }
+func (f *recodedField) Fields() []parquet.Field     { return f.fields }
+
+// recodedSchema returns schema with every column recoded as config asks.
+func recodedSchema(schema *parquet.Schema, config WriterConfig) (*parquet.Schema, error) {
+	recoded, err := recodeFields(schema.Fields(), nil, config)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(parquet.Group, len(recoded))
+	order := make([]string, len(recoded))
+	for i, field := range recoded {
+		fields[field.Name()] = field
+		order[i] = field.Name()
+	}
+	return parquet.NewSchema(schema.Name(), orderedGroup{Group: fields, order: order}), nil
+}
+
+// recodeFields recodes fields, found below the group at prefix, and everything nested in them.
+func recodeFields(fields []parquet.Field, prefix []string, config WriterConfig) ([]parquet.Field, error) {
+	recoded := make([]parquet.Field, len(fields))
+	for i, field := range fields {
+		path := append(slices.Clone(prefix), field.Name())
+		f := &recodedField{Field: field, compression: config.Codec}
+		if field.Leaf() {
+			// Nested columns are configured by their dotted path
+			name := strings.Join(path, ".")
+			node, err := encodeNode(parquet.Leaf(field.Type()), name, config)
+			if err != nil {
+				return nil, fmt.Errorf("building node for field %s: %w", name, err)
+			}
+			f.encoding = node.Encoding()
+		} else {
+			var err error
+			if f.fields, err = recodeFields(field.Fields(), path, config); err != nil {
+				return nil, err
+			}
+		}
+		recoded[i] = f
+	}
+	return recoded, nil
+}
@@ -0,0 +1,183 @@
+package parqat
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+/*
+Column descriptions are stored in the key-value metadata of the file footer, one entry per
+column keyed by columnMetaPrefix and the column name, where data catalogs that show file
+metadata pick them up.
+*/
+const columnMetaPrefix = "parqat.column."
+
+/*
+columnDescriptions merges the descriptions declared in config.Schema with config.ColumnMeta,
+which wins for columns described in both, and checks that every described column is in schema.
+*/
+func columnDescriptions(schema *parquet.Schema, config WriterConfig) (map[string]string, error) {
+	descriptions := make(map[string]string)
+	if config.Schema != nil {
+		for _, field := range config.Schema.Fields {
+			if field.Description != "" {
+				descriptions[field.Name] = field.Description
+			}
+		}
+	}
+	for name, description := range config.ColumnMeta {
+		descriptions[name] = description
+	}
+	for name := range descriptions {
+		if _, ok := schema.Lookup(name); !ok {
+			return nil, fmt.Errorf("described column %q not found in inferred schema", name)
+		}
+	}
+	return descriptions, nil
+}
+
+// setColumnMeta adds the descriptions to the key-value metadata of writerConfig.
+func setColumnMeta(writerConfig *parquet.WriterConfig, descriptions map[string]string) {
+	for name, description := range descriptions {
+		if writerConfig.KeyValueMetadata == nil {
+			writerConfig.KeyValueMetadata = make(map[string]string)
+		}
+		writerConfig.KeyValueMetadata[columnMetaPrefix+name] = description
+	}
+}
+
+/*
+keepColumnMeta carries the column descriptions of pr, a file being rewritten, over to
+writerConfig, except for columns writerConfig already describes or no longer has. Other
+key-value metadata is left behind, since it may describe the old file rather than its columns.
+*/
+func keepColumnMeta(writerConfig *parquet.WriterConfig, pr *parquet.File) {
+	kept := make(map[string]string)
+	for name, description := range fileColumnMeta(pr) {
+		_, described := writerConfig.KeyValueMetadata[columnMetaPrefix+name]
+		if _, ok := writerConfig.Schema.Lookup(name); ok && !described {
+			kept[name] = description
+		}
+	}
+	setColumnMeta(writerConfig, kept)
+}
+
+// fileColumnMeta returns the column descriptions in the footer of pr, by column name.
+func fileColumnMeta(pr *parquet.File) map[string]string {
+	descriptions := make(map[string]string)
+	for _, kv := range pr.Metadata().KeyValueMetadata {
+		if name, ok := strings.CutPrefix(kv.Key, columnMetaPrefix); ok {
+			descriptions[name] = kv.Value
+		}
+	}
+	return descriptions
+}
+
+/*
+Columns of raw bytes are stored as unannotated BYTE_ARRAY values, which other writers use for
+text as well. The writer marks each one in the key-value metadata with binaryMetaPrefix and the
+column name, and only marked columns are read back as base64; other unannotated byte arrays are
+text.
+*/
+const binaryMetaPrefix = "parqat.binary."
+
+// isRawBytes reports whether t is an unannotated BYTE_ARRAY.
+func isRawBytes(t parquet.Type) bool {
+	return t.Kind() == parquet.ByteArray && t.LogicalType() == nil
+}
+
+// rawByteColumns returns the top-level leaves of schema that are unannotated byte arrays.
+func rawByteColumns(schema *parquet.Schema) map[string]bool {
+	columns := make(map[string]bool)
+	for _, field := range schema.Fields() {
+		if field.Leaf() && isRawBytes(field.Type()) {
+			columns[field.Name()] = true
+		}
+	}
+	return columns
+}
+
+// setBinaryMeta marks columns as binary in the key-value metadata of writerConfig.
+func setBinaryMeta(writerConfig *parquet.WriterConfig, columns map[string]bool) {
+	for name := range columns {
+		if writerConfig.KeyValueMetadata == nil {
+			writerConfig.KeyValueMetadata = make(map[string]string)
+		}
+		writerConfig.KeyValueMetadata[binaryMetaPrefix+name] = "base64"
+	}
+}
+
+/*
+keepBinaryMeta replaces the binary marks of writerConfig, which newParquetWriterConfig puts on
+every unannotated byte array, with those of pr, a file being rewritten, and the columns listed
+in binary.
+*/
+func keepBinaryMeta(writerConfig *parquet.WriterConfig, pr *parquet.File, binary []string) {
+	for key := range writerConfig.KeyValueMetadata {
+		if strings.HasPrefix(key, binaryMetaPrefix) {
+			delete(writerConfig.KeyValueMetadata, key)
+		}
+	}
+	setBinaryMeta(writerConfig, fileBinaryColumns(pr, binary))
+}
+
+/*
+fileBinaryColumns returns the unannotated byte array columns of pr that are marked as binary in
+its footer or listed in binary.
+*/
+func fileBinaryColumns(pr *parquet.File, binary []string) map[string]bool {
+	marked := make(map[string]bool)
+	for _, kv := range pr.Metadata().KeyValueMetadata {
+		if name, ok := strings.CutPrefix(kv.Key, binaryMetaPrefix); ok {
+			marked[name] = true
+		}
+	}
+	columns := rawByteColumns(pr.Schema())
+	for name := range columns {
+		columns[name] = marked[name] || slices.Contains(binary, name)
+	}
+	maps.DeleteFunc(columns, func(_ string, binary bool) bool { return !binary })
+	return columns
+}
+
+// ColumnDescription is the description of one column, as ColumnMeta reads it.
+type ColumnDescription struct {
+	Name        string
+	Description string
+}
+
+/*
+ColumnMeta reads the column descriptions of the Parquet file at filePath, as written with
+WriterConfig.ColumnMeta, from its footer. They are returned in schema order; columns without a
+description are left out.
+*/
+func ColumnMeta(filePath string) ([]ColumnDescription, error) {
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	descriptions := fileColumnMeta(pr)
+	var described []ColumnDescription
+	for _, field := range pr.Schema().Fields() {
+		if description, ok := descriptions[field.Name()]; ok {
+			described = append(described, ColumnDescription{Name: field.Name(), Description: description})
+		}
+	}
+	return described, nil
+}
+
+// CreatedBy reads the created_by string from the footer of the Parquet file at filePath, which is empty if the writer left it out.
+func CreatedBy(filePath string) (string, error) {
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close()
+	return pr.Metadata().CreatedBy, nil
+}
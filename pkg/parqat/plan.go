@@ -0,0 +1,146 @@
+package parqat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// WritePlan describes what a conversion would write, as worked out by PlanParquet.
+type WritePlan struct {
+	Schema *parquet.Schema
+	// Rows is the number of rows that would be written. It is estimated from the input size
+	// when only a sample was decoded (see Estimated).
+	Rows      int64
+	Estimated bool
+	Codec     compress.Codec
+}
+
+/*
+PlanParquet infers the schema and settles the codec for converting the JSON rows of r, without
+writing any Parquet. With streaming set it decodes only the schema sample the streaming writer
+uses, estimating the row count from the size of the rest of the input; otherwise it decodes
+every row, as ToParquetWithConfig would.
+*/
+func PlanParquet(r io.Reader, config WriterConfig, streaming bool) (*WritePlan, error) {
+	if !streaming {
+		// Input that outgrows config.MaxMemory would be written by the streaming writer
+		var streamed *WritePlan
+		rows, _, order, err := readAllRows(context.Background(), r, config, func(replay io.Reader, config WriterConfig) error {
+			var err error
+			streamed, err = PlanParquet(replay, config, true)
+			return err
+		})
+		if err != nil || streamed != nil {
+			return streamed, err
+		}
+		return planRows(rows, order, int64(len(rows)), false, config)
+	}
+
+	if config.Tail > 0 {
+		return nil, fmt.Errorf("keeping the last rows requires reading to the end of the input first and cannot be used in streaming mode")
+	}
+
+	const sampleSize = 1024 // the streaming writer's schema sample
+	counter := &countingReader{r: r}
+	dec := newRowDecoder(counter, config.InvalidRow, config)
+	order := newFieldOrder()
+	limit := config.Limit
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+
+	var sampleRows []map[string]any
+	for len(sampleRows) < sampleSize && int64(len(sampleRows)) < limit {
+		row, err := decodeOrderedRow(dec, order)
+		if err != nil {
+			if err == io.EOF {
+				// The sample is the whole input
+				return planRows(sampleRows, order.names, int64(len(sampleRows)), false, config)
+			}
+			return nil, decodeError(dec, err)
+		}
+		sampleRows = append(sampleRows, convertArraysToStrings(row))
+	}
+	if int64(len(sampleRows)) == limit {
+		return planRows(sampleRows, order.names, limit, false, config)
+	}
+
+	// Scale the sample by the share of the input it took up
+	sampleBytes := dec.InputOffset()
+	if _, err := io.Copy(io.Discard, counter); err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	estimate := int64(float64(len(sampleRows)) * float64(counter.n) / float64(max(sampleBytes, 1)))
+	return planRows(sampleRows, order.names, min(estimate, limit), true, config)
+}
+
+// planRows builds the plan for rows, reporting total as the row count.
+func planRows(rows []map[string]any, order []string, total int64, estimated bool, config WriterConfig) (*WritePlan, error) {
+	plan := &WritePlan{Rows: total, Estimated: estimated, Codec: config.Codec}
+	if len(rows) == 0 {
+		return plan, nil // Empty input is valid, and writes nothing
+	}
+
+	schema, err := buildOptimizedSchema(rows, order, config)
+	if err != nil {
+		return nil, fmt.Errorf("building schema: %w", err)
+	}
+	if config, err = chooseWriterSettings(rows, schema, config); err != nil {
+		return nil, err
+	}
+	plan.Schema, plan.Codec = schema, config.Codec
+	return plan, nil
+}
+
+// Describe writes a human-readable summary of the plan: one line per column, then the totals.
+func (p *WritePlan) Describe(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if p.Schema != nil {
+		described, err := DescribeSchema(p.Schema)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(tw, "column\ttype\tnullable\tencoding")
+		for i, field := range p.Schema.Fields() {
+			encoding := "default"
+			if enc := field.Encoding(); enc != nil {
+				encoding = enc.String()
+			}
+			typ := described.Fields[i].Type
+			if typ == "decimal" {
+				typ = fmt.Sprintf("decimal(%d,%d)", described.Fields[i].Precision, described.Fields[i].Scale)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n", field.Name(), typ, field.Optional(), encoding)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	rows := fmt.Sprint(p.Rows)
+	if p.Estimated {
+		rows = "~" + rows + " (estimated from the schema sample)"
+	}
+	fmt.Fprintf(tw, "rows:\t%s\n", rows)
+	if p.Codec != nil {
+		fmt.Fprintf(tw, "codec:\t%s\n", strings.ToLower(p.Codec.String()))
+	}
+	return tw.Flush()
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
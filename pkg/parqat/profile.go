@@ -0,0 +1,348 @@
+package parqat
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// ProfileSampleSize is how many rows ProfileParquetFile samples unless told otherwise.
+const ProfileSampleSize = 10000
+
+// FileProfile summarizes the numeric columns of a Parquet file, as ProfileParquetFile works it out.
+type FileProfile struct {
+	File        string          `json:"file"`
+	Rows        int64           `json:"rows"`
+	SampledRows int64           `json:"sampled_rows"`
+	Columns     []ColumnProfile `json:"columns"`
+}
+
+/*
+ColumnProfile summarizes one numeric column. Min, Max and NullFraction are exact when Source is
+"statistics", taken from the statistics of every column chunk, and come from the sampled rows
+when it is "sample". Mean always comes from the sample, and DistinctCount is estimated from it
+unless the file stores a distinct count for its only row group. Min, Max and Mean are null when
+no value was seen.
+*/
+type ColumnProfile struct {
+	Column        string   `json:"column"`
+	Type          string   `json:"type"`
+	Min           any      `json:"min"`
+	Max           any      `json:"max"`
+	Mean          *float64 `json:"mean"`
+	NullFraction  float64  `json:"null_fraction"`
+	DistinctCount int64    `json:"distinct_count"`
+	Source        string   `json:"source"`
+}
+
+/*
+ProfileParquetFile summarizes every top-level numeric column of the Parquet file at filePath: its
+min, max, mean, null fraction and number of distinct values, for data-quality checks. What the
+footer's statistics hold is read from there; the rest comes from config.Sample rows picked as
+--sample picks them, ProfileSampleSize if it's zero, with config.Seed. Only the numeric columns
+are decoded. Dates and timestamps aren't profiled; decimals are, scaled to their values.
+*/
+func ProfileParquetFile(filePath string, config ReaderConfig) (profile *FileProfile, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("profiling %s: %v", filePath, r)
+		}
+	}()
+
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	profile = &FileProfile{File: filePath, Rows: pr.NumRows(), Columns: []ColumnProfile{}}
+	var profilers []*columnProfiler
+	for _, field := range pr.Schema().Fields() {
+		if !field.Leaf() || !numericType(field.Type()) {
+			continue
+		}
+		leaf, _ := pr.Schema().Lookup(field.Name())
+		profilers = append(profilers, &columnProfiler{name: field.Name(), index: leaf.ColumnIndex, typ: field.Type()})
+	}
+	if len(profilers) == 0 {
+		return profile, nil
+	}
+
+	columns := make([]string, len(profilers))
+	for i, p := range profilers {
+		columns[i] = p.name
+	}
+	config = ReaderConfig{Columns: columns, Sample: config.Sample, Seed: config.Seed}
+	if config.Sample <= 0 {
+		config.Sample = ProfileSampleSize
+	}
+	schema, err := projectSchema(pr.Schema(), config)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDecryptable(pr, schema); err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	if profile.Rows > 0 {
+		reader := parquet.NewGenericReader[any](pr, schema)
+		defer reader.Close()
+		err := sampleRows(context.Background(), reader, config, func(row any) error {
+			values, _ := row.(map[string]any)
+			for _, p := range profilers {
+				p.sampled(values[p.name])
+			}
+			profile.SampledRows++
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+	}
+
+	for _, p := range profilers {
+		column, err := p.profile(pr, profile.Rows, profile.SampledRows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: column %s: %w", filePath, p.name, err)
+		}
+		profile.Columns = append(profile.Columns, column)
+	}
+	return profile, nil
+}
+
+// numericType reports whether t holds numbers ProfileParquetFile profiles: integers, floats and decimals.
+func numericType(t parquet.Type) bool {
+	switch t.Kind() {
+	case parquet.Int32, parquet.Int64, parquet.Float, parquet.Double:
+	default:
+		return false
+	}
+	lt := t.LogicalType()
+	return lt == nil || lt.Integer != nil || lt.Decimal != nil
+}
+
+// columnProfiler gathers the sampled values of one column.
+type columnProfiler struct {
+	name  string
+	index int // of the column's chunks within a row group
+	typ   parquet.Type
+
+	nulls  int64
+	sum    float64
+	values map[float64]int64 // how often each sampled value was seen
+	min    any
+	max    any
+}
+
+// sampled accounts for the value of the column in a sampled row.
+func (p *columnProfiler) sampled(value any) {
+	n, ok := p.number(value)
+	if !ok {
+		p.nulls++
+		return
+	}
+	if p.values == nil {
+		p.values = make(map[float64]int64)
+	}
+	p.values[n]++
+	p.sum += n
+	if p.min == nil || n < p.float(p.min) {
+		p.min = p.exact(value)
+	}
+	if p.max == nil || n > p.float(p.max) {
+		p.max = p.exact(value)
+	}
+}
+
+/*
+profile completes the column's profile from the file's statistics, where every row group has
+them, and from the sampled values: sampled rows out of rows.
+*/
+func (p *columnProfiler) profile(pr *parquet.File, rows, sampled int64) (ColumnProfile, error) {
+	column := ColumnProfile{Column: p.name, Type: strings.ToLower(p.typ.Kind().String()), Source: "sample"}
+	if lt := p.typ.LogicalType(); lt != nil && lt.Decimal != nil {
+		column.Type = fmt.Sprintf("decimal(%d,%d)", lt.Decimal.Precision, lt.Decimal.Scale)
+	}
+
+	seen := sampled - p.nulls
+	if seen > 0 {
+		mean := p.sum / float64(seen)
+		column.Mean = &mean
+	}
+	column.DistinctCount = estimateDistinct(p.values, rows, sampled)
+	column.Min, column.Max = p.min, p.max
+	if sampled > 0 {
+		column.NullFraction = float64(p.nulls) / float64(sampled)
+	}
+
+	chunks := make([]format.ColumnMetaData, len(pr.Metadata().RowGroups))
+	for i, rowGroup := range pr.Metadata().RowGroups {
+		chunks[i] = rowGroup.Columns[p.index].MetaData
+		if !hasStatistics(chunks[i].Statistics) {
+			return column, nil
+		}
+	}
+	if len(chunks) == 0 {
+		return column, nil
+	}
+
+	v := statsVerifier{typ: p.typ}
+	var min, max parquet.Value
+	var nulls int64
+	for _, chunk := range chunks {
+		s := chunk.Statistics
+		nulls += s.NullCount
+		storedMin, storedMax := s.MinValue, s.MaxValue
+		if storedMin == nil && storedMax == nil && v.signedOrder() {
+			storedMin, storedMax = s.Min, s.Max
+		}
+		if len(storedMin) == 0 || len(storedMax) == 0 {
+			if s.NullCount < chunk.NumValues {
+				return column, nil // Values but no bounds for them
+			}
+			continue // Every value is null
+		}
+		chunkMin, err := v.value(storedMin)
+		if err != nil {
+			return column, fmt.Errorf("min: %w", err)
+		}
+		chunkMax, err := v.value(storedMax)
+		if err != nil {
+			return column, fmt.Errorf("max: %w", err)
+		}
+		if min.IsNull() || p.typ.Compare(chunkMin, min) < 0 {
+			min = chunkMin
+		}
+		if max.IsNull() || p.typ.Compare(chunkMax, max) > 0 {
+			max = chunkMax
+		}
+	}
+
+	column.Source = "statistics"
+	column.Min, column.Max = nil, nil
+	if !min.IsNull() {
+		column.Min, column.Max = p.exact(p.goValue(min)), p.exact(p.goValue(max))
+	}
+	if rows > 0 {
+		column.NullFraction = float64(nulls) / float64(rows)
+	}
+	if len(chunks) == 1 && chunks[0].Statistics.DistinctCount > 0 {
+		column.DistinctCount = chunks[0].Statistics.DistinctCount
+	}
+	return column, nil
+}
+
+// hasStatistics reports whether a writer stored statistics for a column chunk at all.
+func hasStatistics(stats format.Statistics) bool {
+	return stats.Min != nil || stats.Max != nil || stats.MinValue != nil || stats.MaxValue != nil || stats.NullCount != 0
+}
+
+// goValue returns value as the Go value the generic reader would read it as.
+func (p *columnProfiler) goValue(value parquet.Value) any {
+	unsigned := false
+	if lt := p.typ.LogicalType(); lt != nil && lt.Integer != nil {
+		unsigned = !lt.Integer.IsSigned
+	}
+	switch p.typ.Kind() {
+	case parquet.Int32:
+		if unsigned {
+			return uint32(value.Int32())
+		}
+		return value.Int32()
+	case parquet.Int64:
+		if unsigned {
+			return uint64(value.Int64())
+		}
+		return value.Int64()
+	case parquet.Float:
+		return value.Float()
+	default:
+		return value.Double()
+	}
+}
+
+// number returns a value read from the column as a float64, scaled if the column is a decimal.
+func (p *columnProfiler) number(value any) (float64, bool) {
+	var n float64
+	switch v := value.(type) {
+	case int32:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case uint32:
+		n = float64(v)
+	case uint64:
+		n = float64(v)
+	case float32:
+		n = float64(v)
+	case float64:
+		n = v
+	default:
+		return 0, false
+	}
+	if lt := p.typ.LogicalType(); lt != nil && lt.Decimal != nil {
+		n /= math.Pow10(int(lt.Decimal.Scale))
+	}
+	return n, true
+}
+
+// float returns a value made by exact as a float64.
+func (p *columnProfiler) float(value any) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return 0
+}
+
+/*
+exact returns a value read from the column for JSON: integers as int64 or uint64, so large ones
+keep every digit, and floats and decimals as float64.
+*/
+func (p *columnProfiler) exact(value any) any {
+	if lt := p.typ.LogicalType(); lt == nil || lt.Decimal == nil {
+		switch v := value.(type) {
+		case int32:
+			return int64(v)
+		case int64:
+			return v
+		case uint32:
+			return uint64(v)
+		case uint64:
+			return v
+		}
+	}
+	n, _ := p.number(value)
+	return n
+}
+
+/*
+estimateDistinct estimates how many distinct values a column of rows rows holds from the counts
+of the values in a uniform sample of sampled of them, with the Haas-Stokes estimator PostgreSQL's
+ANALYZE uses: d / (1 - (1-q)*f1/n) for d distinct values in a sample of n = sampled rows, q of
+the whole, f1 of them seen once. A sample of every row counts exactly, and a sample of values all
+seen once estimates every row distinct.
+*/
+func estimateDistinct(values map[float64]int64, rows, sampled int64) int64 {
+	if sampled == 0 {
+		return 0
+	}
+	var once int64
+	for _, count := range values {
+		if count == 1 {
+			once++
+		}
+	}
+	distinct, n := float64(len(values)), float64(sampled)
+	q := n / float64(rows)
+	estimate := distinct / (1 - (1-q)*float64(once)/n)
+	return int64(math.Round(min(max(estimate, distinct), float64(rows))))
+}
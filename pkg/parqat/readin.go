@@ -0,0 +1,1470 @@
+package parqat
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+)
+
+// ReaderConfig holds configuration for converting Parquet to JSON.
+// It controls which rows are emitted and how values are rendered.
+type ReaderConfig struct {
+	Head int
+	Tail int
+	// Sample picks this many rows uniformly at random instead of head/tail.
+	Sample int
+	// Seed seeds the sampler so a sample can be reproduced.
+	Seed int64
+	// Offset skips this many rows, and Length (when positive) stops after this many more, so
+	// workers can each take a disjoint slice. Ranges past the end are truncated.
+	Offset int64
+	Length int64
+	// RangeTruncated, if set, is called with the number of rows there are when the range of
+	// Offset and a positive Length ends past the last row.
+	RangeTruncated func(numRows int64)
+	// NullAs, if set, is the token written for null leaf values, even "null" or "". Unset keeps
+	// JSON null, or an empty cell in CSV and TSV.
+	NullAs *string
+	// OmitNulls leaves top-level fields that are null out of JSON rows; a row with nothing but
+	// nulls is written as {}. Only for JSON output.
+	OmitNulls bool
+	// LineBuffered flushes the output after every row, trading throughput for latency.
+	LineBuffered bool
+	// OutputBufferSize is how many bytes of output are buffered between writes to the
+	// destination: larger means fewer system calls, smaller means rows arrive sooner. Zero uses
+	// bufio's default of 4096.
+	OutputBufferSize int
+	// Format is the output format: FormatJSON (default), FormatColumnar, FormatCSV, FormatTSV or
+	// FormatArrow.
+	Format string
+	// ColumnarBuffered, if set, is called once FormatColumnar output has buffered
+	// ColumnarWarnRows rows, since it holds every row in memory until the last one is read.
+	ColumnarBuffered func(rows int64)
+	// Delimiter separates fields in delimited output; zero uses the format's default.
+	Delimiter rune
+	// RowGroups restricts reading to the row groups with these 0-based indexes; nil reads all.
+	// Head, tail and sample then apply to the rows of the selected groups.
+	RowGroups []int
+	// Where, if set, outputs only the rows that satisfy it. Row groups whose statistics show that
+	// none of their rows can are skipped without being decoded, and Head counts matching rows.
+	// It cannot be combined with Tail, Sample, Offset or Length.
+	Where *Predicate
+	// RowGroupsSkipped, if set, is told how many of the total row groups read Where skipped.
+	RowGroupsSkipped func(skipped, total int)
+	// Columns restricts output to these top-level columns, in this order; nil keeps all.
+	Columns []string
+	// ExcludeColumns drops these top-level columns from the output. It cannot be combined with Columns.
+	ExcludeColumns []string
+	// Flatten expands nested groups into top-level columns named by their dotted path
+	// (addr.city). Lists and maps are written as JSON strings.
+	Flatten bool
+	// Rename maps column names (dotted paths with Flatten) to the names they are output under.
+	// Columns and ExcludeColumns still take the names in the file.
+	Rename map[string]string
+	// SchemaKeyOrder writes the keys of JSON rows in schema (output column) order. Otherwise
+	// they are sorted, as encoding/json sorts map keys; nested objects are always sorted.
+	SchemaKeyOrder bool
+	// Location is the time zone TIMESTAMP columns adjusted to UTC are rendered in; nil means UTC.
+	Location *time.Location
+	// FloatPrecision rounds FLOAT and DOUBLE values to at most this many significant digits, so
+	// 95.50000000000001 is written as 95.5; zero keeps full precision.
+	FloatPrecision int
+	// Cast maps top-level column names (as in the file) to the representation their values are
+	// output in instead: CastString, or one of the epoch casts for TIMESTAMP, INT96 and DATE
+	// columns. Casts of columns that aren't output are ignored.
+	Cast map[string]string
+	// Explode names a column of arrays (lists, or strings holding JSON arrays as parqat writes
+	// them) to output one row per element of, with the other columns repeated. Head, tail and
+	// sample still count the rows in the file. A null or empty array yields no row, or one
+	// with a null in the column if ExplodeKeepEmpty is set. Not for FormatArrow.
+	Explode          string
+	ExplodeKeepEmpty bool
+	// SpoolThreshold is how many bytes of Parquet data read from a stream FromParquetWithConfig
+	// holds in memory; larger data is spooled to a temp file in TempDir instead. Zero means
+	// DefaultSpoolThreshold.
+	SpoolThreshold int64
+	// TempDir is the directory spooled Parquet data is written to (default: the OS temp directory).
+	TempDir string
+	// CountBy outputs, instead of the rows, each distinct value of this column with the number
+	// of selected rows holding it, most common first. Only that column is decoded, and nulls are
+	// counted as a value of their own. It cannot be combined with column selection, Flatten or
+	// Explode.
+	CountBy string
+}
+
+// Output formats for ReaderConfig.Format.
+const (
+	FormatJSON     = "json"     // newline-delimited JSON objects
+	FormatColumnar = "columnar" // one JSON object holding an array of values per column
+	FormatCSV      = "csv"      // comma-separated values with a header row
+	FormatTSV      = "tsv"      // tab-separated values with a header row
+	FormatArrow    = "arrow"    // an Apache Arrow IPC stream of record batches
+)
+
+// DefaultSpoolThreshold is the ReaderConfig.SpoolThreshold used when it is zero.
+const DefaultSpoolThreshold = 64 << 20 // 64MB = 2^26
+
+// ColumnarWarnRows is how many rows FormatColumnar output buffers before ColumnarBuffered is called.
+const ColumnarWarnRows = 1 << 20 // 1048576 = 2^20
+
+// Column casts for ReaderConfig.Cast.
+const (
+	CastString       = "string"        // the value as text, e.g. a big INT64 ID JavaScript would round
+	CastEpochSeconds = "epoch_seconds" // a time as whole seconds since the Unix epoch
+	CastEpochMillis  = "epoch_millis"  // a time as milliseconds since the Unix epoch
+	CastEpochMicros  = "epoch_micros"  // a time as microseconds since the Unix epoch
+)
+
+// DefaultReaderConfig returns a configuration that emits every row unchanged.
+func DefaultReaderConfig() ReaderConfig {
+	return ReaderConfig{}
+}
+
+/*
+FromParquet reads Parquet data from an io.Reader and writes JSON rows to the provided io.Writer.
+Supports optional head/tail arguments to limit output rows.
+*/
+func FromParquet(w io.Writer, r io.Reader, head, tail int) error {
+	config := DefaultReaderConfig()
+	config.Head, config.Tail = head, tail
+	return FromParquetWithConfig(w, r, config)
+}
+
+/*
+FromParquetWithConfig reads Parquet data from an io.Reader and writes JSON rows to the provided
+io.Writer, applying the row selection and rendering options in config. A regular file is read in
+place; other input, like a pipe, is read into memory up to config.SpoolThreshold bytes and
+spooled to a temp file beyond that, as the writers spool JSON.
+*/
+func FromParquetWithConfig(w io.Writer, r io.Reader, config ReaderConfig) error {
+	pr, closer, err := openParquetStream(r, config)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	return fromParquet(context.Background(), w, pr, config)
+}
+
+// openParquetStream opens the Parquet data read from r as FromParquetWithConfig describes. The closer removes any temp file.
+func openParquetStream(r io.Reader, config ReaderConfig) (*parquet.File, io.Closer, error) {
+	var closer io.Closer = io.NopCloser(nil)
+	if file, ok := r.(*os.File); ok {
+		info, err := file.Stat()
+		if start, seekErr := file.Seek(0, io.SeekCurrent); err == nil && seekErr == nil && info.Mode().IsRegular() {
+			size := info.Size() - start
+			if size <= 0 {
+				return nil, nil, fmt.Errorf("empty input")
+			}
+			pr, err := openParquet(io.NewSectionReader(file, start, size), size)
+			if err != nil {
+				return nil, nil, fmt.Errorf("opening parquet data: %w", err)
+			}
+			return pr, closer, nil
+		}
+	}
+
+	threshold := config.SpoolThreshold
+	if threshold <= 0 {
+		threshold = DefaultSpoolThreshold
+	}
+	data, err := io.ReadAll(io.LimitReader(r, threshold+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading input: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("empty input")
+	}
+	var (
+		input io.ReaderAt = bytes.NewReader(data)
+		size              = int64(len(data))
+	)
+	if size > threshold {
+		tempFile, err := os.CreateTemp(config.TempDir, "parqat_read_*.parquet")
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating temp file: %w", err)
+		}
+		closer = spoolFile{tempFile}
+		rest, err := io.Copy(tempFile, io.MultiReader(bytes.NewReader(data), r))
+		if err != nil {
+			closer.Close()
+			return nil, nil, fmt.Errorf("spooling input: %w", err)
+		}
+		input, size = tempFile, rest
+	}
+
+	pr, err := openParquet(input, size)
+	if err != nil {
+		closer.Close()
+		return nil, nil, fmt.Errorf("opening parquet data: %w", err)
+	}
+	return pr, closer, nil
+}
+
+// spoolFile is a temp file that is removed when it is closed.
+type spoolFile struct {
+	*os.File
+}
+
+func (f spoolFile) Close() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// parquetMagic is the header every Parquet file starts with.
+var parquetMagic = []byte("PAR1")
+
+/*
+SniffParquet reports whether r starts with the Parquet magic bytes, so a stream of unknown
+content can be routed to the reader or the writers. The returned reader yields all of r,
+sniffed bytes included; a seekable r is rewound and returned as it is.
+*/
+func SniffParquet(r io.Reader) (io.Reader, bool, error) {
+	if rs, start, ok := seekableStart(r); ok {
+		magic := make([]byte, len(parquetMagic))
+		n, _ := io.ReadFull(rs, magic)
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, false, fmt.Errorf("seeking input: %w", err)
+		}
+		return rs, n == len(magic) && bytes.Equal(magic, parquetMagic), nil
+	}
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(parquetMagic))
+	if err != nil && err != io.EOF {
+		return nil, false, fmt.Errorf("reading input: %w", err)
+	}
+	return br, bytes.Equal(magic, parquetMagic), nil
+}
+
+/*
+FromParquetFile opens a Parquet file from disk and writes JSON rows to the provided io.Writer.
+Supports optional head/tail arguments to limit output rows.
+*/
+func FromParquetFile(w io.Writer, filePath string, head, tail int) error {
+	config := DefaultReaderConfig()
+	config.Head, config.Tail = head, tail
+	return FromParquetFileWithConfig(w, filePath, config)
+}
+
+/*
+FromParquetFileWithConfig opens a Parquet file from disk (or an http(s) URL) and writes JSON rows
+to the provided io.Writer, applying the row selection and rendering options in config.
+*/
+func FromParquetFileWithConfig(w io.Writer, filePath string, config ReaderConfig) error {
+	if info, err := os.Stat(filePath); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		// A named pipe can't be read at random, so it is read as a stream
+		file, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("opening file %s: %w", filePath, err)
+		}
+		defer file.Close()
+		return FromParquetWithConfig(w, file, config)
+	}
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	return fromParquet(context.Background(), w, pr, config)
+}
+
+/*
+CountParquetFiles returns the total number of rows in the given Parquet files.
+Row counts are read from the footer metadata, so no data pages are decoded.
+*/
+func CountParquetFiles(filePaths ...string) (int64, error) {
+	var total int64
+	for _, filePath := range filePaths {
+		pr, closer, err := openParquetFile(filePath, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+		if err != nil {
+			return 0, err
+		}
+		closer.Close()
+		total += pr.NumRows()
+	}
+	return total, nil
+}
+
+/*
+openParquetFile opens the Parquet file at filePath, which may also be an http(s) URL read
+through range requests. The closer releases the underlying file once reading is done.
+*/
+func openParquetFile(filePath string, options ...parquet.FileOption) (*parquet.File, io.Closer, error) {
+	var (
+		r      io.ReaderAt
+		size   int64
+		closer io.Closer = io.NopCloser(nil)
+	)
+
+	if IsURL(filePath) {
+		var err error
+		if r, size, err = openURL(filePath); err != nil {
+			return nil, nil, err
+		}
+		options = append(options, parquet.ReadBufferSize(remoteReadBufferSize))
+	} else {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening file %s: %w", filePath, err)
+		}
+
+		fileInfo, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("getting file info for %s: %w", filePath, err)
+		}
+		r, size, closer = file, fileInfo.Size(), file
+	}
+
+	pr, err := openParquet(r, size, options...)
+	if err != nil {
+		closer.Close()
+		return nil, nil, fmt.Errorf("opening parquet file %s: %w", filePath, err)
+	}
+	return pr, closer, nil
+}
+
+/*
+FromParquetContext writes the rows of an opened Parquet file as JSON, applying config.
+It returns ctx's error once ctx is done, checking between row batches.
+*/
+func FromParquetContext(ctx context.Context, w io.Writer, pr *parquet.File, config ReaderConfig) error {
+	return fromParquet(ctx, w, pr, config)
+}
+
+/*
+FromParquetFunc hands the rows of an opened Parquet file to fn one at a time, as the
+map[string]any values the JSON output is encoded from, with the same head/tail selection as
+FromParquet. Rows are decoded in batches and never all held in memory. If fn returns an error,
+reading stops and that error is returned unchanged.
+*/
+func FromParquetFunc(pr *parquet.File, head, tail int, fn func(row any) error) error {
+	config := DefaultReaderConfig()
+	config.Head, config.Tail = head, tail
+	return fromParquetFunc(context.Background(), pr, config, fn)
+}
+
+/*
+ValidateParquetFile checks that the file at filePath is well-formed Parquet: the footer and schema
+must parse and every page of every column chunk must decode. With deep set, every row is also
+reassembled from its columns. Panics raised by the Parquet reader are reported as errors.
+*/
+func ValidateParquetFile(filePath string, deep bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("validating %s: %v", filePath, r)
+		}
+	}()
+
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	if err := checkDecryptable(pr, pr.Schema()); err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	columns := pr.Schema().Columns()
+	for i, rowGroup := range pr.RowGroups() {
+		for j, chunk := range rowGroup.ColumnChunks() {
+			if err := validateColumnChunk(chunk); err != nil {
+				return fmt.Errorf("%s: row group %d, column %s: %w", filePath, i, strings.Join(columns[j], "."), err)
+			}
+		}
+	}
+
+	if deep {
+		err := readRows(context.Background(), pr, DefaultReaderConfig(), func(any) error { return nil })
+		if err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+	}
+	return nil
+}
+
+// validateColumnChunk decodes every page of chunk, discarding the values.
+func validateColumnChunk(chunk parquet.ColumnChunk) error {
+	pages := chunk.Pages()
+	defer pages.Close()
+
+	for {
+		page, err := pages.ReadPage()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("reading page: %w", err)
+		}
+		parquet.Release(page)
+	}
+}
+
+/*
+fromParquet handles the core logic for converting a parquet.File to JSON output.
+It applies head/tail logic and writes each row as JSON.
+*/
+func fromParquet(ctx context.Context, w io.Writer, pr *parquet.File, config ReaderConfig) error {
+	// Use buffered writer for better performance
+	if config.OutputBufferSize < 0 {
+		return fmt.Errorf("output buffer size must not be negative")
+	}
+	bw := bufio.NewWriterSize(w, config.OutputBufferSize) // Zero is bufio's default size
+	defer bw.Flush()
+
+	if config.CountBy != "" {
+		return writeValueCounts(ctx, bw, pr, config)
+	}
+	schema, err := projectSchema(pr.Schema(), config)
+	if err != nil {
+		return err
+	}
+	if config.Format == FormatArrow {
+		if config.Explode != "" {
+			return fmt.Errorf("exploding a column doesn't apply to arrow output")
+		}
+		if len(config.Cast) > 0 {
+			return fmt.Errorf("casting columns doesn't apply to arrow output")
+		}
+		return writeArrow(ctx, bw, pr, schema, config)
+	}
+	columns := make([]string, 0, len(schema.Fields()))
+	for _, field := range schema.Fields() {
+		columns = append(columns, field.Name())
+	}
+	if config.Flatten {
+		columns = columns[:0]
+		for _, column := range flatColumns(schema.Fields(), nil) {
+			columns = append(columns, column.name)
+		}
+	}
+	if columns, err = renameColumns(columns, config.Rename); err != nil {
+		return err
+	}
+	enc, err := newRowEncoder(bw, columns, config)
+	if err != nil {
+		return err
+	}
+
+	// Write each row in the requested format
+	err = fromParquetFunc(ctx, pr, config, func(row any) error {
+		if err := enc.encode(row); err != nil {
+			return err
+		}
+		if config.LineBuffered {
+			return enc.flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return enc.flush()
+}
+
+// fromParquetFunc passes the rows of pr selected by config to fn, with logical types rendered.
+func fromParquetFunc(ctx context.Context, pr *parquet.File, config ReaderConfig, fn func(row any) error) error {
+	schema, err := projectSchema(pr.Schema(), config)
+	if err != nil {
+		return err
+	}
+	formatter := newRowFormatter(schema, fileBinaryColumns(pr, nil), config)
+	if err := formatter.cast(pr.Schema(), config.Cast); err != nil {
+		return err
+	}
+	emit := func(row map[string]any) error {
+		if err := renameFields(row, config.Rename); err != nil {
+			return err
+		}
+		return fn(row)
+	}
+	if !config.Flatten {
+		if err := checkExplodeColumn(config.Explode, fieldNames(schema.Fields())); err != nil {
+			return err
+		}
+		return readRows(ctx, pr, config, func(row any) error {
+			row = roundFloats(formatter.format(row), config.FloatPrecision)
+			if m, ok := row.(map[string]any); ok {
+				return explodeRow(m, config, emit)
+			}
+			return fn(row)
+		})
+	}
+
+	columns := flatColumns(schema.Fields(), nil)
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+	if err := checkExplodeColumn(config.Explode, names); err != nil {
+		return err
+	}
+	return readRows(ctx, pr, config, func(row any) error {
+		flat, err := flattenRow(roundFloats(formatter.format(row), config.FloatPrecision), columns)
+		if err != nil {
+			return err
+		}
+		return explodeRow(flat, config, emit)
+	})
+}
+
+// fieldNames returns the names of fields, in order.
+func fieldNames(fields []parquet.Field) []string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name()
+	}
+	return names
+}
+
+// checkExplodeColumn checks that the column to explode, if any, is one of the output columns.
+func checkExplodeColumn(column string, columns []string) error {
+	if column != "" && !slices.Contains(columns, column) {
+		return fmt.Errorf("unknown column %q to explode (columns: %s)", column, strings.Join(columns, ", "))
+	}
+	return nil
+}
+
+/*
+explodeRow passes row to emit once per element of the array in config.Explode, with the element
+in place of the array, or unchanged when nothing is exploded. The array is a list value or a
+string holding a JSON array; anything else in the column is an error.
+*/
+func explodeRow(row map[string]any, config ReaderConfig, emit func(row map[string]any) error) error {
+	column := config.Explode
+	if column == "" {
+		return emit(row)
+	}
+
+	var elements []any
+	switch value := row[column].(type) {
+	case nil:
+	case string:
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		if err := dec.Decode(&elements); err != nil || dec.More() {
+			return fmt.Errorf("exploding column %s: %q is not a JSON array", column, value)
+		}
+	default:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Errorf("exploding column %s: %v is not an array", column, value)
+		}
+		elements = make([]any, v.Len())
+		for i := range elements {
+			elements[i] = v.Index(i).Interface()
+		}
+	}
+
+	if len(elements) == 0 {
+		if !config.ExplodeKeepEmpty {
+			return nil
+		}
+		elements = []any{nil}
+	}
+	for _, element := range elements {
+		exploded := maps.Clone(row)
+		exploded[column] = element
+		if err := emit(exploded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueCount is a distinct value of a column and the number of rows holding it.
+type valueCount struct {
+	value any
+	count int64
+}
+
+/*
+writeValueCounts writes a row per distinct value of config.CountBy with its count, in the output
+format of config. The count is keyed count, or rows when the column itself is named count.
+*/
+func writeValueCounts(ctx context.Context, bw *bufio.Writer, pr *parquet.File, config ReaderConfig) error {
+	if len(config.Columns) > 0 || len(config.ExcludeColumns) > 0 || config.Flatten || config.Explode != "" {
+		return fmt.Errorf("counting by a column cannot be combined with column selection, flatten or explode")
+	}
+	if config.Format == FormatArrow {
+		return fmt.Errorf("counting by a column doesn't apply to arrow output")
+	}
+	column := config.CountBy
+	if names := fieldNames(pr.Schema().Fields()); !slices.Contains(names, column) {
+		return fmt.Errorf("unknown column %q to count by (columns: %s)", column, strings.Join(names, ", "))
+	}
+
+	name := column
+	if renamed, ok := config.Rename[column]; ok {
+		name = renamed
+	}
+	countName := "count"
+	if name == countName {
+		countName = "rows"
+	}
+
+	// Only the counted column is decoded
+	config.Columns = []string{column}
+	counts := make(map[string]*valueCount)
+	err := fromParquetFunc(ctx, pr, config, func(row any) error {
+		value := row.(map[string]any)[name]
+		key, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("counting column %s: %w", column, err)
+		}
+		if counted, ok := counts[string(key)]; ok {
+			counted.count++
+		} else {
+			counts[string(key)] = &valueCount{value: value, count: 1}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := slices.Collect(maps.Keys(counts))
+	slices.SortFunc(keys, func(a, b string) int {
+		if byCount := cmp.Compare(counts[b].count, counts[a].count); byCount != 0 {
+			return byCount
+		}
+		return strings.Compare(a, b)
+	})
+	enc, err := newRowEncoder(bw, []string{name, countName}, config)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := enc.encode(map[string]any{name: counts[key].value, countName: counts[key].count}); err != nil {
+			return err
+		}
+	}
+	return enc.flush()
+}
+
+// flatColumn is one column of flattened output: a leaf, list or map reached through nested groups.
+type flatColumn struct {
+	name string
+	path []string
+}
+
+// flatColumns lists the flattened columns of fields, in schema order, below the group at prefix.
+func flatColumns(fields []parquet.Field, prefix []string) []flatColumn {
+	var columns []flatColumn
+	for _, field := range fields {
+		path := append(slices.Clone(prefix), field.Name())
+		if field.Leaf() || field.Repeated() || field.Type().LogicalType() != nil {
+			columns = append(columns, flatColumn{name: strings.Join(path, "."), path: path})
+			continue
+		}
+		columns = append(columns, flatColumns(field.Fields(), path)...)
+	}
+	return columns
+}
+
+/*
+flattenRow picks the value of every column out of the nested row. A null group makes all of
+its columns null; list and map values are encoded as JSON strings.
+*/
+func flattenRow(row any, columns []flatColumn) (map[string]any, error) {
+	flat := make(map[string]any, len(columns))
+	for _, column := range columns {
+		value := row
+		for _, name := range column.path {
+			m, _ := value.(map[string]any)
+			value = m[name]
+		}
+
+		switch v := reflect.ValueOf(value); {
+		case value == nil:
+		case v.Kind() == reflect.Map, v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+			text, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("encoding column %s: %w", column.name, err)
+			}
+			value = string(text)
+		}
+		flat[column.name] = value
+	}
+	return flat, nil
+}
+
+// rowEncoder writes rows read from a Parquet file in one output format.
+type rowEncoder interface {
+	encode(row any) error
+	flush() error
+}
+
+// newRowEncoder returns the encoder for config's output format, writing to bw.
+func newRowEncoder(bw *bufio.Writer, columns []string, config ReaderConfig) (rowEncoder, error) {
+	switch config.Format {
+	case "", FormatJSON:
+		if config.Delimiter != 0 {
+			return nil, fmt.Errorf("a delimiter only applies to csv and tsv output")
+		}
+		enc := &jsonRowEncoder{enc: json.NewEncoder(bw), bw: bw, nullAs: config.NullAs, omitNulls: config.OmitNulls}
+		if config.SchemaKeyOrder {
+			enc.columns = columns
+		}
+		return enc, nil
+	case FormatColumnar:
+		switch {
+		case config.Delimiter != 0:
+			return nil, fmt.Errorf("a delimiter only applies to csv and tsv output")
+		case config.OmitNulls:
+			return nil, fmt.Errorf("omitting nulls doesn't apply to columnar output, where every column holds a value per row")
+		case config.LineBuffered:
+			return nil, fmt.Errorf("line buffering doesn't apply to columnar output, which is written once every row is read")
+		}
+		return newColumnarRowEncoder(bw, columns, config), nil
+	case FormatCSV, FormatTSV:
+		comma := config.Delimiter
+		if comma == 0 {
+			comma = ','
+			if config.Format == FormatTSV {
+				comma = '\t'
+			}
+		}
+		if comma == '"' || comma == '\r' || comma == '\n' || comma == utf8.RuneError {
+			return nil, fmt.Errorf("invalid delimiter %q", comma)
+		}
+		if config.OmitNulls {
+			return nil, fmt.Errorf("omitting nulls only applies to json output, where rows have keys")
+		}
+		return newDelimitedRowEncoder(bw, columns, comma, config.NullAs)
+	}
+	return nil, fmt.Errorf("unknown output format %q (valid: json, columnar, csv, tsv, arrow)", config.Format)
+}
+
+/*
+jsonRowEncoder writes each row as one JSON object per line. Keys are sorted unless columns is
+set, in which case the keys of each row are written in that order.
+*/
+type jsonRowEncoder struct {
+	enc       *json.Encoder
+	bw        *bufio.Writer
+	nullAs    *string
+	omitNulls bool
+	columns   []string
+}
+
+func (e *jsonRowEncoder) encode(row any) error {
+	if m, ok := row.(map[string]any); ok && e.omitNulls {
+		for key, value := range m {
+			if value == nil {
+				delete(m, key)
+			}
+		}
+	}
+	if e.nullAs != nil {
+		row = replaceNulls(row, *e.nullAs)
+	}
+	if m, ok := row.(map[string]any); ok && e.columns != nil {
+		return e.encodeOrdered(m)
+	}
+	if err := e.enc.Encode(row); err != nil {
+		return fmt.Errorf("encoding json: %w", err)
+	}
+	return nil
+}
+
+// encodeOrdered writes row with its keys in column order.
+func (e *jsonRowEncoder) encodeOrdered(row map[string]any) error {
+	e.bw.WriteByte('{')
+	written := 0
+	for _, column := range e.columns {
+		value, ok := row[column]
+		if !ok {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("encoding json: %w", err)
+		}
+		if written > 0 {
+			e.bw.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		e.bw.Write(key)
+		e.bw.WriteByte(':')
+		e.bw.Write(encoded)
+		written++
+	}
+	if written != len(row) {
+		return fmt.Errorf("encoding json: row has fields outside the output columns")
+	}
+	_, err := e.bw.WriteString("}\n")
+	return err
+}
+
+func (e *jsonRowEncoder) flush() error {
+	if err := e.bw.Flush(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+/*
+columnarRowEncoder collects the value of every column of each row and writes them, once all rows
+are encoded, as a single JSON object with an array per column: {"id": [1, 2], "name": ["a", "b"]}.
+Keys are sorted unless schemaKeyOrder is set, in which case they are written in column order.
+*/
+type columnarRowEncoder struct {
+	bw             *bufio.Writer
+	columns        []string
+	values         map[string][]any
+	nullAs         *string
+	schemaKeyOrder bool
+	rows           int64
+	buffered       func(rows int64)
+}
+
+func newColumnarRowEncoder(bw *bufio.Writer, columns []string, config ReaderConfig) *columnarRowEncoder {
+	values := make(map[string][]any, len(columns))
+	for _, column := range columns {
+		values[column] = []any{} // No rows is written as empty arrays, not nulls
+	}
+	return &columnarRowEncoder{
+		bw:             bw,
+		columns:        columns,
+		values:         values,
+		nullAs:         config.NullAs,
+		schemaKeyOrder: config.SchemaKeyOrder,
+		buffered:       config.ColumnarBuffered,
+	}
+}
+
+func (e *columnarRowEncoder) encode(row any) error {
+	if e.nullAs != nil {
+		row = replaceNulls(row, *e.nullAs)
+	}
+	m, ok := row.(map[string]any)
+	if !ok || len(m) != len(e.columns) {
+		return fmt.Errorf("encoding json: row has fields outside the output columns")
+	}
+	for _, column := range e.columns {
+		value, ok := m[column]
+		if !ok {
+			return fmt.Errorf("encoding json: row has fields outside the output columns")
+		}
+		e.values[column] = append(e.values[column], value)
+	}
+	if e.rows++; e.rows == ColumnarWarnRows && e.buffered != nil {
+		e.buffered(e.rows)
+	}
+	return nil
+}
+
+func (e *columnarRowEncoder) flush() error {
+	keys := e.columns
+	if !e.schemaKeyOrder {
+		keys = slices.Sorted(slices.Values(keys))
+	}
+	e.bw.WriteByte('{')
+	for i, column := range keys {
+		encoded, err := json.Marshal(e.values[column])
+		if err != nil {
+			return fmt.Errorf("encoding json: %w", err)
+		}
+		if i > 0 {
+			e.bw.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		e.bw.Write(key)
+		e.bw.WriteByte(':')
+		e.bw.Write(encoded)
+	}
+	e.bw.WriteString("}\n")
+	if err := e.bw.Flush(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+/*
+delimitedRowEncoder writes rows as delimiter-separated values, one column per output
+column in order, preceded by a header row. CSV and TSV share this encoder.
+*/
+type delimitedRowEncoder struct {
+	w       *csv.Writer
+	bw      *bufio.Writer
+	columns []string
+	record  []string
+	nullAs  *string
+}
+
+// newDelimitedRowEncoder writes the header row and returns the encoder.
+func newDelimitedRowEncoder(bw *bufio.Writer, columns []string, comma rune, nullAs *string) (*delimitedRowEncoder, error) {
+	e := &delimitedRowEncoder{w: csv.NewWriter(bw), bw: bw, columns: columns, nullAs: nullAs}
+	e.w.Comma = comma
+	e.record = make([]string, len(e.columns))
+
+	if err := e.w.Write(e.columns); err != nil {
+		return nil, fmt.Errorf("writing header: %w", err)
+	}
+	return e, nil
+}
+
+func (e *delimitedRowEncoder) encode(row any) error {
+	m, _ := row.(map[string]any)
+	for i, name := range e.columns {
+		text, err := e.formatValue(m[name])
+		if err != nil {
+			return fmt.Errorf("formatting field %s: %w", name, err)
+		}
+		e.record[i] = text
+	}
+	if err := e.w.Write(e.record); err != nil {
+		return fmt.Errorf("writing row: %w", err)
+	}
+	return nil
+}
+
+// formatValue renders a single field; nulls become empty unless a null token was requested.
+func (e *delimitedRowEncoder) formatValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		if e.nullAs == nil {
+			return "", nil
+		}
+		return *e.nullAs, nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	text, err := json.Marshal(value)
+	return string(text), err
+}
+
+func (e *delimitedRowEncoder) flush() error {
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	if err := e.bw.Flush(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+// readBatchSize is the number of rows decoded per read call (2^10 - SIMD-optimized).
+const readBatchSize = 1024
+
+/*
+readRows streams the rows of pr selected by config's head/tail/sample options to fn,
+decoding readBatchSize rows at a time so the whole file is never held in memory.
+*/
+func readRows(ctx context.Context, pr *parquet.File, config ReaderConfig, fn func(row any) error) error {
+	if config.Sample > 0 && (config.Head > 0 || config.Tail > 0) {
+		return fmt.Errorf("sample cannot be combined with head or tail")
+	}
+	if (config.Offset > 0 || config.Length > 0) && (config.Head > 0 || config.Tail > 0 || config.Sample > 0) {
+		return fmt.Errorf("offset and length cannot be combined with head, tail or sample")
+	}
+	if config.Offset < 0 || config.Length < 0 {
+		return fmt.Errorf("offset and length must not be negative")
+	}
+	if config.Where != nil && (config.Tail > 0 || config.Sample > 0 || config.Offset > 0 || config.Length > 0) {
+		return fmt.Errorf("a filter cannot be combined with tail, sample, offset or length")
+	}
+
+	schema, err := projectSchema(pr.Schema(), config)
+	if err != nil {
+		return err
+	}
+	var filter *rowFilter
+	if config.Where != nil {
+		if filter, err = newRowFilter(pr.Schema(), config.Where); err != nil {
+			return err
+		}
+		if _, ok := schema.Lookup(config.Where.Column); !ok {
+			// The column is decoded for the filter alone
+			filter.drop = true
+			widened := config
+			if len(config.Columns) > 0 {
+				widened.Columns = append(slices.Clone(config.Columns), config.Where.Column)
+			}
+			widened.ExcludeColumns = slices.DeleteFunc(slices.Clone(config.ExcludeColumns), func(name string) bool { return name == config.Where.Column })
+			if schema, err = projectSchema(pr.Schema(), widened); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkDecryptable(pr, schema); err != nil {
+		return err
+	}
+	var options []parquet.ReaderOption
+	if schema != pr.Schema() {
+		// Only the projected columns are decoded
+		options = append(options, schema)
+	}
+
+	var rowGroup parquet.RowGroup
+	if len(config.RowGroups) > 0 {
+		var err error
+		if rowGroup, err = selectRowGroups(pr, config.RowGroups); err != nil {
+			return err
+		}
+	}
+	if filter != nil {
+		indexes := config.RowGroups
+		if len(indexes) == 0 {
+			indexes = make([]int, len(pr.RowGroups()))
+			for i := range indexes {
+				indexes[i] = i
+			}
+		}
+		matching := filter.matchingRowGroups(pr, indexes)
+		if config.RowGroupsSkipped != nil {
+			config.RowGroupsSkipped(len(indexes)-len(matching), len(indexes))
+		}
+		if len(matching) == 0 {
+			return nil // No row group can hold a matching row
+		}
+		if len(matching) < len(indexes) {
+			if rowGroup, err = selectRowGroups(pr, matching); err != nil {
+				return err
+			}
+		}
+	}
+
+	numRows := pr.NumRows()
+	if rowGroup != nil {
+		numRows = rowGroup.NumRows()
+	}
+	if numRows == 0 {
+		return nil // No rows to process
+	}
+
+	// Use GenericReader with any type, like in the test examples
+	var reader *parquet.GenericReader[any]
+	if rowGroup != nil {
+		reader = parquet.NewGenericRowGroupReader[any](rowGroup, options...)
+	} else {
+		reader = parquet.NewGenericReader[any](pr, options...)
+	}
+	defer reader.Close()
+
+	// Apply head/tail logic
+	limit := numRows
+	if head, tail := config.Head, config.Tail; head > 0 && filter == nil {
+		limit = min(int64(head), numRows)
+	} else if tail > 0 && int64(tail) < numRows {
+		// Skip straight to the tail instead of decoding the leading rows
+		if err := reader.SeekToRow(numRows - int64(tail)); err != nil {
+			return fmt.Errorf("seeking to row %d: %w", numRows-int64(tail), err)
+		}
+		limit = int64(tail)
+	} else if config.Offset > 0 || config.Length > 0 {
+		if config.Length > 0 && config.Offset+config.Length > numRows && config.RangeTruncated != nil {
+			config.RangeTruncated(numRows)
+		}
+		if config.Offset >= numRows {
+			return nil // The range starts past the last row
+		}
+		// Row groups that end before the offset are skipped without being decoded
+		if err := reader.SeekToRow(config.Offset); err != nil {
+			return fmt.Errorf("seeking to row %d: %w", config.Offset, err)
+		}
+		limit = numRows - config.Offset
+		if config.Length > 0 {
+			limit = min(limit, config.Length)
+		}
+	}
+
+	if config.Sample > 0 {
+		return sampleRows(ctx, reader, config, fn)
+	}
+
+	batch := make([]any, readBatchSize)
+	var matched int64
+	for limit > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		clear(batch)
+		n, err := reader.Read(batch[:min(int64(len(batch)), limit)])
+		for _, row := range batch[:n] {
+			if filter != nil && !filter.match(row) {
+				continue
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+			if matched++; filter != nil && config.Head > 0 && matched == int64(config.Head) {
+				return nil // Head counts the matching rows
+			}
+		}
+		limit -= int64(n)
+
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("reading parquet data: %w", err)
+		}
+	}
+	return nil
+}
+
+/*
+projectSchema returns schema restricted to config.Columns, or without config.ExcludeColumns.
+Without either it returns schema itself. Naming a column the schema lacks is an error.
+*/
+func projectSchema(schema *parquet.Schema, config ReaderConfig) (*parquet.Schema, error) {
+	if len(config.Columns) == 0 && len(config.ExcludeColumns) == 0 {
+		return schema, nil
+	}
+	if len(config.Columns) > 0 && len(config.ExcludeColumns) > 0 {
+		return nil, fmt.Errorf("columns and excluded columns cannot be combined")
+	}
+
+	fields := make(map[string]parquet.Field)
+	var names []string
+	for _, field := range schema.Fields() {
+		fields[field.Name()] = field
+		names = append(names, field.Name())
+	}
+	for _, name := range append(slices.Clone(config.Columns), config.ExcludeColumns...) {
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("unknown column %q (columns: %s)", name, strings.Join(names, ", "))
+		}
+	}
+
+	keep := config.Columns
+	if len(config.ExcludeColumns) > 0 {
+		keep = slices.DeleteFunc(names, func(name string) bool { return slices.Contains(config.ExcludeColumns, name) })
+		if len(keep) == 0 {
+			return nil, fmt.Errorf("every column is excluded")
+		}
+	}
+
+	group := make(parquet.Group, len(keep))
+	for _, name := range keep {
+		group[name] = fields[name]
+	}
+	return parquet.NewSchema(schema.Name(), orderedGroup{Group: group, order: keep}), nil
+}
+
+// selectRowGroups returns the row groups of pr at indexes, in that order, as one row group.
+func selectRowGroups(pr *parquet.File, indexes []int) (parquet.RowGroup, error) {
+	rowGroups := pr.RowGroups()
+	selected := make([]parquet.RowGroup, len(indexes))
+	for i, index := range indexes {
+		if len(rowGroups) == 0 {
+			return nil, fmt.Errorf("row group %d out of range: the file has no row groups", index)
+		}
+		if index < 0 || index >= len(rowGroups) {
+			return nil, fmt.Errorf("row group %d out of range: the file has %d row groups (0-%d)", index, len(rowGroups), len(rowGroups)-1)
+		}
+		selected[i] = rowGroups[index]
+	}
+	if len(selected) == 1 {
+		return selected[0], nil
+	}
+	return parquet.MultiRowGroup(selected...), nil
+}
+
+/*
+sampleRows picks config.Sample rows uniformly at random in a single pass using reservoir
+sampling, then hands them to fn in file order. Only the reservoir is kept in memory.
+*/
+func sampleRows(ctx context.Context, reader *parquet.GenericReader[any], config ReaderConfig, fn func(row any) error) error {
+	type sampledRow struct {
+		index int64
+		row   any
+	}
+
+	rng := rand.New(rand.NewSource(config.Seed))
+	reservoir := make([]sampledRow, 0, min(int64(config.Sample), reader.NumRows())) // A sample bigger than the file holds it all
+	var seen int64
+
+	batch := make([]any, readBatchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		clear(batch)
+		n, err := reader.Read(batch)
+		for _, row := range batch[:n] {
+			if len(reservoir) < config.Sample {
+				reservoir = append(reservoir, sampledRow{index: seen, row: row})
+			} else if j := rng.Int63n(seen + 1); j < int64(config.Sample) {
+				reservoir[j] = sampledRow{index: seen, row: row}
+			}
+			seen++
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("reading parquet data: %w", err)
+		}
+	}
+
+	sort.Slice(reservoir, func(i, j int) bool { return reservoir[i].index < reservoir[j].index })
+	for _, sampled := range reservoir {
+		if err := fn(sampled.row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowFormatter renders leaf values that have no natural JSON representation, like raw bytes or timestamps.
+type rowFormatter map[string]func(value any) any
+
+// newRowFormatter builds a formatter for the top-level leaves of schema, rendering those in binary as base64.
+func newRowFormatter(schema *parquet.Schema, binary map[string]bool, config ReaderConfig) rowFormatter {
+	loc := config.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	f := make(rowFormatter)
+	for _, field := range schema.Fields() {
+		if !field.Leaf() {
+			continue
+		}
+		lt := field.Type().LogicalType()
+		switch {
+		case field.Type().Kind() == parquet.Int96:
+			f[field.Name()] = func(value any) any {
+				if v, ok := value.(deprecated.Int96); ok {
+					return int96ToTime(v).In(loc).Format(time.RFC3339Nano)
+				}
+				return value
+			}
+		case binary[field.Name()]:
+			// Raw bytes can only travel through JSON encoded
+			f[field.Name()] = func(value any) any {
+				switch v := value.(type) {
+				case string:
+					return base64.StdEncoding.EncodeToString([]byte(v))
+				case []byte:
+					return base64.StdEncoding.EncodeToString(v)
+				}
+				return value
+			}
+		case lt == nil:
+		case lt.Timestamp != nil:
+			unit, zone := lt.Timestamp.Unit, loc
+			if !lt.Timestamp.IsAdjustedToUTC {
+				// Local timestamps are wall-clock readings, not instants to move between zones
+				zone = time.UTC
+			}
+			f[field.Name()] = func(value any) any {
+				if v, ok := value.(int64); ok {
+					return formatTimestamp(v, unit, zone)
+				}
+				return value
+			}
+		case lt.UUID != nil:
+			f[field.Name()] = func(value any) any {
+				if id, ok := value.([]byte); ok && len(id) == 16 {
+					return formatUUID(id)
+				}
+				return value
+			}
+		case lt.Date != nil:
+			f[field.Name()] = func(value any) any {
+				if days, ok := value.(int32); ok {
+					return formatDate(days)
+				}
+				return value
+			}
+		case lt.Decimal != nil:
+			scale := int(lt.Decimal.Scale)
+			f[field.Name()] = func(value any) any {
+				// Render decimals as fixed-point strings so floats never creep back in
+				switch v := value.(type) {
+				case int64:
+					return formatDecimal(v, scale)
+				case int32:
+					return formatDecimal(int64(v), scale)
+				}
+				return value
+			}
+		}
+	}
+	return f
+}
+
+/*
+cast replaces the formatting of the columns in casts with their cast, checking each against its
+column in schema. A column to cast to a string is first formatted as it would be otherwise.
+*/
+func (f rowFormatter) cast(schema *parquet.Schema, casts map[string]string) error {
+	fields := make(map[string]parquet.Field)
+	for _, field := range schema.Fields() {
+		fields[field.Name()] = field
+	}
+	for _, name := range slices.Sorted(maps.Keys(casts)) {
+		cast := casts[name]
+		field, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("unknown column %q to cast (columns: %s)", name, strings.Join(fieldNames(schema.Fields()), ", "))
+		}
+		if !field.Leaf() {
+			return fmt.Errorf("cannot cast column %s: it is a nested group, not a single value", name)
+		}
+
+		switch cast {
+		case CastString:
+			format := f[name]
+			f[name] = func(value any) any {
+				if format != nil {
+					value = format(value)
+				}
+				switch v := value.(type) {
+				case string:
+					return v
+				case []byte:
+					return base64.StdEncoding.EncodeToString(v)
+				}
+				return fmt.Sprint(value)
+			}
+		case CastEpochSeconds, CastEpochMillis, CastEpochMicros:
+			toTime, ok := timeOfColumn(field)
+			if !ok {
+				return fmt.Errorf("cannot cast column %s to %s: it is %s, not a TIMESTAMP, INT96 or DATE", name, cast, field.Type())
+			}
+			f[name] = func(value any) any {
+				t, ok := toTime(value)
+				if !ok {
+					return value
+				}
+				switch cast {
+				case CastEpochSeconds:
+					return t.Unix()
+				case CastEpochMillis:
+					return t.UnixMilli()
+				}
+				return t.UnixMicro()
+			}
+		default:
+			return fmt.Errorf("unknown cast %q for column %s (valid: %s, %s, %s, %s)", cast, name, CastString, CastEpochSeconds, CastEpochMillis, CastEpochMicros)
+		}
+	}
+	return nil
+}
+
+// timeOfColumn returns a func turning the values of a TIMESTAMP, INT96 or DATE field into instants.
+func timeOfColumn(field parquet.Field) (func(value any) (time.Time, bool), bool) {
+	if field.Type().Kind() == parquet.Int96 {
+		return func(value any) (time.Time, bool) {
+			v, ok := value.(deprecated.Int96)
+			return int96ToTime(v), ok
+		}, true
+	}
+	lt := field.Type().LogicalType()
+	switch {
+	case lt == nil:
+	case lt.Timestamp != nil:
+		unit := lt.Timestamp.Unit
+		return func(value any) (time.Time, bool) {
+			v, ok := value.(int64)
+			return timestampTime(v, unit), ok
+		}, true
+	case lt.Date != nil:
+		return func(value any) (time.Time, bool) {
+			days, ok := value.(int32)
+			return time.Unix(int64(days)*86400, 0).UTC(), ok
+		}, true
+	}
+	return nil, false
+}
+
+// format applies the formatter to a row read by the generic reader.
+func (f rowFormatter) format(row any) any {
+	m, ok := row.(map[string]any)
+	if !ok || len(f) == 0 {
+		return row
+	}
+	for name, fn := range f {
+		if value, ok := m[name]; ok && value != nil {
+			m[name] = fn(value)
+		}
+	}
+	return m
+}
+
+/*
+roundFloats rounds every float leaf of value to digits significant digits. The result is parsed
+back to a float64 rather than kept as text, so encoding/json still writes the shortest form and
+trailing zeros are dropped. Values other than floats are returned as they are.
+*/
+func roundFloats(value any, digits int) any {
+	if digits <= 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case float64:
+		return roundFloat(v, digits)
+	case float32:
+		return roundFloat(float64(v), digits)
+	case map[string]any:
+		for key, elem := range v {
+			v[key] = roundFloats(elem, digits)
+		}
+	case []any:
+		for i, elem := range v {
+			v[i] = roundFloats(elem, digits)
+		}
+	}
+	return value
+}
+
+// roundFloat rounds v to digits significant digits; NaN and infinities are kept.
+func roundFloat(v float64, digits int) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return v
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(v, 'g', digits, 64), 64)
+	if err != nil {
+		return v
+	}
+	return rounded
+}
+
+// replaceNulls substitutes token for every null leaf value, keeping the keys that hold them.
+func replaceNulls(value any, token string) any {
+	switch v := value.(type) {
+	case nil:
+		return token
+	case map[string]any:
+		for key, elem := range v {
+			v[key] = replaceNulls(elem, token)
+		}
+		return v
+	case []any:
+		for i, elem := range v {
+			v[i] = replaceNulls(elem, token)
+		}
+		return v
+	}
+	return value
+}
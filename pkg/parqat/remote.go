@@ -0,0 +1,111 @@
+package parqat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// remoteTimeout bounds each request to a remote file, so a stalled server fails the read
+	// instead of hanging it. It includes the download of a whole file from a server without
+	// range support.
+	remoteTimeout = 5 * time.Minute
+	// remoteReadBufferSize is the read buffer remote files are opened with. parquet-go reads
+	// pages through a buffer of 4KiB by default, which would be a range request every 4KiB.
+	remoteReadBufferSize = 1 << 20
+)
+
+// remoteClient fetches remote files.
+var remoteClient = &http.Client{Timeout: remoteTimeout}
+
+// IsURL reports whether path names a remote http(s) file rather than a local one.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+/*
+httpReaderAt reads a remote file through HTTP range requests, so parquet.OpenFile only
+fetches the footer and the column chunks it actually decodes. Each ReadAt is a request of its
+own; the file is opened with a read buffer of remoteReadBufferSize so there are few of them.
+*/
+type httpReaderAt struct {
+	client *http.Client
+	url    string
+	size   int64
+}
+
+/*
+openURL returns an io.ReaderAt over the file at url and its size. It probes for range support
+with a one-byte request; servers that ignore ranges answer with the whole file, which is then
+downloaded into memory instead.
+*/
+func openURL(url string) (io.ReaderAt, int64, error) {
+	client := remoteClient
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating request for %s: %w", url, err)
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-0/SIZE
+		_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		size, err := strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("fetching %s: unusable Content-Range %q", url, resp.Header.Get("Content-Range"))
+		}
+		return &httpReaderAt{client: client, url: url, size: size}, size, nil
+	case http.StatusOK:
+		// No range support - fall back to downloading the whole file
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, 0, fmt.Errorf("downloading %s: %w", url, err)
+		}
+		return bytes.NewReader(data), int64(len(data)), nil
+	}
+	return nil, 0, fmt.Errorf("fetching %s: %s", url, resp.Status)
+}
+
+// ReadAt fetches len(p) bytes starting at off with a single range request.
+func (h *httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= h.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), h.size)
+
+	req, err := http.NewRequest(http.MethodGet, h.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("fetching %s: %w", h.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("fetching range of %s: %s", h.url, resp.Status)
+	}
+
+	n, err := io.ReadFull(resp.Body, p[:end-off])
+	if err != nil {
+		return n, fmt.Errorf("reading range of %s: %w", h.url, err)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,473 @@
+package parqat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/encoding/thrift"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// RepairReport describes what RepairParquetFile recovered from a file.
+type RepairReport struct {
+	// FooterIntact is set when the file opened normally, so nothing needed repairing.
+	FooterIntact bool
+	RowGroups    int
+	Rows         int64
+	// RecoveredBytes is how far into the file the recovered row groups reach.
+	RecoveredBytes int64
+	FileSize       int64
+}
+
+/*
+RepairParquetFile writes the rows of a Parquet file whose footer is missing or corrupt, such as
+an upload cut off partway, applying config as FromParquetFileWithConfig does. The footer holds
+the schema and the location of every column chunk, so without it the file is scanned page by
+page from the start and complete row groups are pieced back together from the page headers,
+with the columns of schema, which must be the schema the file was written with. Scanning stops
+at the first page that is damaged or cut off, and the row group it belongs to is lost.
+
+Repair is best-effort: pages are matched to columns and row groups by their row counts and
+encodings, which a file with several undictionaried pages per column chunk can leave ambiguous.
+A file whose footer reads fine is read as usual, and schema may then be nil.
+*/
+func RepairParquetFile(w io.Writer, filePath string, schema *SchemaFile, config ReaderConfig) (RepairReport, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return RepairReport{}, fmt.Errorf("opening file %s: %w", filePath, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return RepairReport{}, fmt.Errorf("getting file info for %s: %w", filePath, err)
+	}
+
+	report := RepairReport{FileSize: info.Size()}
+	pr, openErr := openParquet(file, info.Size())
+	if openErr == nil {
+		report.FooterIntact = true
+		report.RowGroups, report.Rows, report.RecoveredBytes = len(pr.RowGroups()), pr.NumRows(), info.Size()
+		return report, fromParquet(context.Background(), w, pr, config)
+	}
+	if schema == nil {
+		return report, fmt.Errorf("opening parquet file %s: %w (repairing it needs the schema it was written with)", filePath, openErr)
+	}
+
+	parquetSchema, err := schemaFromFile(schema, DefaultWriterConfig())
+	if err != nil {
+		return report, err
+	}
+	pr, report, err = recoverParquet(file, info.Size(), parquetSchema)
+	if err != nil {
+		return report, fmt.Errorf("repairing %s: %w", filePath, err)
+	}
+	return report, fromParquet(context.Background(), w, pr, config)
+}
+
+/*
+recoverParquet rebuilds the footer of the Parquet data of the given size in r from its pages
+and opens the complete row groups it finds as a file with the given schema.
+*/
+func recoverParquet(r io.ReaderAt, size int64, schema *parquet.Schema) (*parquet.File, RepairReport, error) {
+	report := RepairReport{FileSize: size}
+	magic := make([]byte, len(parquetMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, parquetMagic) {
+		return nil, report, fmt.Errorf("not a parquet file: it doesn't start with %s", parquetMagic)
+	}
+
+	elements, err := schemaElements(schema)
+	if err != nil {
+		return nil, report, err
+	}
+	if len(elements)-1 != len(schema.Columns()) {
+		return nil, report, fmt.Errorf("only flat schemas can be repaired")
+	}
+
+	pages := scanPages(r, size)
+	var rowGroups []format.RowGroup
+	for start := 0; start < len(pages); {
+		rowGroup, next, ok := nextRowGroup(r, pages, start, elements)
+		if !ok {
+			break
+		}
+		rowGroups = append(rowGroups, rowGroup)
+		start = next
+		report.RowGroups++
+		report.Rows += rowGroup.NumRows
+		report.RecoveredBytes = pages[next-1].end()
+	}
+	if len(rowGroups) == 0 {
+		return nil, report, fmt.Errorf("no complete row groups found")
+	}
+
+	pr, err := openRecovered(r, report.RecoveredBytes, elements, rowGroups)
+	if err != nil {
+		return nil, report, err
+	}
+	return pr, report, nil
+}
+
+// schemaElements returns the footer form of schema, taken from an empty file written with it.
+func schemaElements(schema *parquet.Schema) ([]format.SchemaElement, error) {
+	var buf bytes.Buffer
+	if err := parquet.NewGenericWriter[any](&buf, schema).Close(); err != nil {
+		return nil, fmt.Errorf("writing schema: %w", err)
+	}
+	pr, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return nil, fmt.Errorf("reading schema: %w", err)
+	}
+	return pr.Metadata().Schema, nil
+}
+
+// scannedPage is a page found by scanPages, at offset in the file.
+type scannedPage struct {
+	offset     int64
+	headerSize int64
+	header     format.PageHeader
+}
+
+// end returns the offset just past the page.
+func (p scannedPage) end() int64 {
+	return p.offset + p.headerSize + int64(p.header.CompressedPageSize)
+}
+
+// rows returns the number of rows the page holds values for, in a flat schema.
+func (p scannedPage) rows() int64 {
+	if v2 := p.header.DataPageHeaderV2; v2 != nil {
+		return int64(v2.NumRows)
+	}
+	return p.values()
+}
+
+// values returns the number of values in the page, nulls included.
+func (p scannedPage) values() int64 {
+	switch {
+	case p.header.DataPageHeaderV2 != nil:
+		return int64(p.header.DataPageHeaderV2.NumValues)
+	case p.header.DataPageHeader != nil:
+		return int64(p.header.DataPageHeader.NumValues)
+	}
+	return 0
+}
+
+func (p scannedPage) dictionary() bool {
+	return p.header.Type == format.DictionaryPage
+}
+
+// encoding returns the encoding of the values in the page.
+func (p scannedPage) encoding() format.Encoding {
+	switch {
+	case p.header.DataPageHeaderV2 != nil:
+		return p.header.DataPageHeaderV2.Encoding
+	case p.header.DataPageHeader != nil:
+		return p.header.DataPageHeader.Encoding
+	}
+	return p.header.DictionaryPageHeader.Encoding
+}
+
+/*
+scanPages reads the pages of the file one after the other, from just past the magic bytes to
+the first bytes that aren't an intact page. Bloom filters between row groups are skipped.
+*/
+func scanPages(r io.ReaderAt, size int64) []scannedPage {
+	var pages []scannedPage
+	offset := int64(len(parquetMagic))
+	for offset < size {
+		page, err := readPage(r, offset, size)
+		if err != nil {
+			next, ok := skipBloomFilter(r, offset, size)
+			if !ok {
+				break
+			}
+			offset = next
+			continue
+		}
+		pages = append(pages, page)
+		offset = page.end()
+	}
+	return pages
+}
+
+// readPage decodes the page header at offset and checks that the page is whole.
+func readPage(r io.ReaderAt, offset, size int64) (scannedPage, error) {
+	page := scannedPage{offset: offset}
+	headerSize, err := decodeThriftAt(r, offset, size, &page.header)
+	if err != nil {
+		return page, fmt.Errorf("decoding page header at %d: %w", offset, err)
+	}
+	page.headerSize = headerSize
+
+	header := page.header
+	switch {
+	case header.CompressedPageSize < 0 || header.UncompressedPageSize < 0:
+		return page, fmt.Errorf("page at %d has a negative size", offset)
+	case header.Type == format.DataPage && header.DataPageHeader == nil,
+		header.Type == format.DataPageV2 && header.DataPageHeaderV2 == nil,
+		header.Type == format.DictionaryPage && header.DictionaryPageHeader == nil:
+		return page, fmt.Errorf("page at %d has no %s header", offset, header.Type)
+	case header.Type != format.DataPage && header.Type != format.DataPageV2 && header.Type != format.DictionaryPage:
+		return page, fmt.Errorf("page at %d has unexpected type %s", offset, header.Type)
+	case page.end() > size:
+		return page, fmt.Errorf("page at %d is cut off", offset)
+	}
+
+	if header.CRC != 0 {
+		data := make([]byte, header.CompressedPageSize)
+		if _, err := r.ReadAt(data, offset+page.headerSize); err != nil {
+			return page, fmt.Errorf("reading page at %d: %w", offset, err)
+		}
+		if int32(crc32.ChecksumIEEE(data)) != header.CRC {
+			return page, fmt.Errorf("page at %d fails its checksum", offset)
+		}
+	}
+	return page, nil
+}
+
+// skipBloomFilter returns the offset past the bloom filter at offset, if there is one.
+func skipBloomFilter(r io.ReaderAt, offset, size int64) (int64, bool) {
+	var header format.BloomFilterHeader
+	headerSize, err := decodeThriftAt(r, offset, size, &header)
+	if err != nil || header.NumBytes <= 0 || header.Algorithm.Block == nil {
+		return 0, false
+	}
+	next := offset + headerSize + int64(header.NumBytes)
+	return next, next <= size
+}
+
+/*
+decodeThriftAt decodes the Thrift struct at offset into v, returning its encoded size. Whatever
+is at offset may be garbage, so type mismatches are errors and panics raised by the decoder are
+reported as errors too.
+*/
+func decodeThriftAt(r io.ReaderAt, offset, size int64, v any) (n int64, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%v", recovered)
+		}
+	}()
+
+	counter := &countingReader{r: bufio.NewReader(io.NewSectionReader(r, offset, size-offset))}
+	decoder := thrift.NewDecoder(new(thrift.CompactProtocol).NewReader(counter))
+	decoder.SetStrict(true)
+	if err := decoder.Decode(v); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+/*
+nextRowGroup pieces together the row group whose first column chunk starts with pages[start],
+returning it with the index of the page after it. The first chunk's row count isn't known, so
+the shortest run of its pages that the other columns can match, and whose chunks all decode, is
+taken.
+*/
+func nextRowGroup(r io.ReaderAt, pages []scannedPage, start int, elements []format.SchemaElement) (format.RowGroup, int, bool) {
+	leaves := elements[1:]
+	first := start
+	if pages[first].dictionary() {
+		first++
+	}
+	var rows int64
+	for end := first; end < len(pages) && !pages[end].dictionary(); end++ {
+		rows += pages[end].rows()
+
+		chunks := [][]scannedPage{pages[start : end+1]}
+		next := end + 1
+		for range leaves[1:] {
+			chunkEnd, ok := chunkOf(pages, next, rows)
+			if !ok {
+				break
+			}
+			chunks = append(chunks, pages[next:chunkEnd])
+			next = chunkEnd
+		}
+		if len(chunks) < len(leaves) || !usesOwnDictionary(chunks[0]) {
+			continue
+		}
+
+		rowGroup, err := buildRowGroup(r, chunks, leaves, rows)
+		if err != nil {
+			continue
+		}
+		if pr, err := openRecovered(r, pages[next-1].end(), elements, []format.RowGroup{rowGroup}); err == nil && validRowGroup(pr) {
+			return rowGroup, next, true
+		}
+	}
+	return format.RowGroup{}, 0, false
+}
+
+/*
+chunkOf returns the index of the page after the column chunk that starts with pages[start] and
+holds the given number of rows: an optional dictionary page and the data pages after it.
+*/
+func chunkOf(pages []scannedPage, start int, rows int64) (int, bool) {
+	i := start
+	if i < len(pages) && pages[i].dictionary() {
+		i++
+	}
+	var n int64
+	for ; i < len(pages) && n < rows && !pages[i].dictionary(); i++ {
+		n += pages[i].rows()
+	}
+	return i, n == rows && usesOwnDictionary(pages[start:i])
+}
+
+// usesOwnDictionary reports whether the chunk starts with a dictionary page if it needs one.
+func usesOwnDictionary(chunk []scannedPage) bool {
+	if chunk[0].dictionary() {
+		return true
+	}
+	for _, page := range chunk {
+		if encoding := page.encoding(); encoding == format.RLEDictionary || encoding == format.PlainDictionary {
+			return false
+		}
+	}
+	return true
+}
+
+// buildRowGroup describes the column chunks made of the given pages as the footer would.
+func buildRowGroup(r io.ReaderAt, chunks [][]scannedPage, leaves []format.SchemaElement, rows int64) (format.RowGroup, error) {
+	rowGroup := format.RowGroup{NumRows: rows, FileOffset: chunks[0][0].offset}
+	for i, chunk := range chunks {
+		codec, err := detectCodec(r, chunk)
+		if err != nil {
+			return rowGroup, err
+		}
+		metadata := format.ColumnMetaData{
+			Type:           *leaves[i].Type,
+			Encoding:       []format.Encoding{format.RLE},
+			PathInSchema:   []string{leaves[i].Name},
+			Codec:          codec,
+			DataPageOffset: chunk[0].offset,
+		}
+		for _, page := range chunk {
+			if page.dictionary() {
+				metadata.DictionaryPageOffset = page.offset
+				metadata.DataPageOffset = page.end()
+			}
+			metadata.NumValues += page.values()
+			if encoding := page.encoding(); !slices.Contains(metadata.Encoding, encoding) {
+				metadata.Encoding = append(metadata.Encoding, encoding)
+			}
+			metadata.TotalCompressedSize += page.headerSize + int64(page.header.CompressedPageSize)
+			metadata.TotalUncompressedSize += page.headerSize + int64(page.header.UncompressedPageSize)
+		}
+		rowGroup.Columns = append(rowGroup.Columns, format.ColumnChunk{FileOffset: chunk[0].offset, MetaData: metadata})
+		rowGroup.TotalByteSize += metadata.TotalUncompressedSize
+		rowGroup.TotalCompressedSize += metadata.TotalCompressedSize
+	}
+	return rowGroup, nil
+}
+
+// repairCodecs are the codecs detectCodec tries, most common first.
+var repairCodecs = []format.CompressionCodec{format.Zstd, format.Snappy, format.Gzip, format.Lz4Raw, format.Brotli}
+
+/*
+detectCodec works out the compression codec of a column chunk, which only the footer records,
+by decompressing its first compressed page with each codec in turn until one yields the page's
+uncompressed size.
+*/
+func detectCodec(r io.ReaderAt, chunk []scannedPage) (format.CompressionCodec, error) {
+	for _, page := range chunk {
+		header := page.header
+		levels := int32(0)
+		if v2 := header.DataPageHeaderV2; v2 != nil {
+			if v2.IsCompressed != nil && !*v2.IsCompressed {
+				continue
+			}
+			levels = v2.DefinitionLevelsByteLength + v2.RepetitionLevelsByteLength
+		}
+		if header.CompressedPageSize == header.UncompressedPageSize || levels > header.CompressedPageSize {
+			continue
+		}
+
+		data := make([]byte, header.CompressedPageSize-levels)
+		if _, err := r.ReadAt(data, page.offset+page.headerSize+int64(levels)); err != nil {
+			return 0, fmt.Errorf("reading page at %d: %w", page.offset, err)
+		}
+		for _, codec := range repairCodecs {
+			decoded, err := parquet.LookupCompressionCodec(codec).Decode(nil, data)
+			if err == nil && len(decoded) == int(header.UncompressedPageSize-levels) {
+				return codec, nil
+			}
+		}
+		return 0, fmt.Errorf("page at %d is compressed with an unknown codec", page.offset)
+	}
+	return format.Uncompressed, nil
+}
+
+/*
+openRecovered opens the first size bytes of r as a Parquet file with the given row groups,
+behind a footer written for them.
+*/
+func openRecovered(r io.ReaderAt, size int64, elements []format.SchemaElement, rowGroups []format.RowGroup) (*parquet.File, error) {
+	metadata := format.FileMetaData{Version: 1, Schema: elements, RowGroups: rowGroups, CreatedBy: "parqat repair"}
+	for i := range metadata.RowGroups {
+		metadata.RowGroups[i].Ordinal = int16(i)
+		metadata.NumRows += metadata.RowGroups[i].NumRows
+	}
+	footer, err := thrift.Marshal(new(thrift.CompactProtocol), &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("writing footer: %w", err)
+	}
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, parquetMagic...)
+
+	spliced := &splicedFile{r: r, size: size, footer: footer}
+	return parquet.OpenFile(spliced, size+int64(len(footer)), parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+}
+
+// validRowGroup reports whether every page of the only row group of pr decodes.
+func validRowGroup(pr *parquet.File) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	for _, chunk := range pr.RowGroups()[0].ColumnChunks() {
+		if validateColumnChunk(chunk) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// splicedFile reads as the first size bytes of r followed by footer.
+type splicedFile struct {
+	r      io.ReaderAt
+	size   int64
+	footer []byte
+}
+
+func (f *splicedFile) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < f.size {
+		want := min(int64(len(p)), f.size-off)
+		read, err := f.r.ReadAt(p[:want], off)
+		n = read
+		if int64(read) < want {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		start := off + int64(n) - f.size
+		if start >= int64(len(f.footer)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], f.footer[start:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
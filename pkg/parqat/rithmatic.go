@@ -0,0 +1,522 @@
+package parqat
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// numberType is the type of the numbers produced by newJSONDecoder.
+var numberType = reflect.TypeOf(json.Number(""))
+
+// maxExactFloatInt is 2^53, past which float64 can no longer represent every integer.
+const maxExactFloatInt = 1 << 53
+
+/*
+classifyNumber reports whether n is written as an integer that fits in INT64, and whether
+that integer is too large in magnitude to survive a round trip through float64.
+*/
+func classifyNumber(n json.Number) (integer, beyondFloat bool) {
+	i, err := strconv.ParseInt(n.String(), 10, 64)
+	if err != nil {
+		return false, false
+	}
+	return true, i > maxExactFloatInt || i < -maxExactFloatInt
+}
+
+// valueCoercer converts a single decoded JSON value into the Go value a Parquet leaf expects.
+type valueCoercer func(value any) (any, error)
+
+/*
+rowCoercer converts decoded JSON rows into the Go types required by the output schema.
+parquet-go panics when a leaf receives a value of the wrong kind, so every row passes
+through the coercer right before it is handed to the writer.
+*/
+type rowCoercer struct {
+	fields map[string]valueCoercer
+}
+
+/*
+newRowCoercer builds a coercer for the top-level leaves of schema. Unannotated byte array columns
+take base64 if they are in binary, and text otherwise.
+*/
+func newRowCoercer(schema *parquet.Schema, binary map[string]bool, config WriterConfig) *rowCoercer {
+	c := &rowCoercer{fields: make(map[string]valueCoercer)}
+	for _, field := range schema.Fields() {
+		if !field.Leaf() {
+			continue
+		}
+		if fn := columnCoercer(field.Name(), field.Type(), binary, config); fn != nil {
+			c.fields[field.Name()] = fn
+		}
+	}
+	return c
+}
+
+// coerce converts the values of row in place and returns it.
+func (c *rowCoercer) coerce(row map[string]any) (map[string]any, error) {
+	for name, fn := range c.fields {
+		value, ok := row[name]
+		if !ok || value == nil {
+			continue
+		}
+		converted, err := fn(plainEJSON(value))
+		if err != nil {
+			return nil, fmt.Errorf("converting field %s: %w", name, err)
+		}
+		row[name] = converted
+	}
+	return row, nil
+}
+
+// columnCoercer is coercerForType for the column name, which is binary if it is in binary and a raw byte array.
+func columnCoercer(name string, t parquet.Type, binary map[string]bool, config WriterConfig) valueCoercer {
+	if isRawBytes(t) && !binary[name] {
+		t = parquet.String().Type()
+	}
+	return coercerForType(t, config)
+}
+
+// coercerForType returns the conversion needed for a leaf type, or nil if values pass through unchanged.
+func coercerForType(t parquet.Type, config WriterConfig) valueCoercer {
+	if lt := t.LogicalType(); lt != nil && lt.Decimal != nil {
+		precision, scale := int(lt.Decimal.Precision), int(lt.Decimal.Scale)
+		return func(value any) (any, error) {
+			return decimalToUnscaled(value, precision, scale)
+		}
+	}
+
+	if lt := t.LogicalType(); lt != nil && lt.UUID != nil {
+		return func(value any) (any, error) {
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert %T to UUID", value)
+			}
+			return parseUUID(str)
+		}
+	}
+
+	if lt := t.LogicalType(); lt != nil && lt.Timestamp != nil {
+		unit := lt.Timestamp.Unit
+		return func(value any) (any, error) {
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert %T to TIMESTAMP", value)
+			}
+			ts, err := parseTimestamp(str, config.AssumeUTC)
+			if err != nil {
+				return nil, err
+			}
+			return timestampToInt(ts, unit)
+		}
+	}
+
+	if t.Kind() == parquet.Int96 {
+		// INT96 is only ever used for legacy timestamps
+		return func(value any) (any, error) {
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert %T to INT96 timestamp", value)
+			}
+			ts, err := parseTimestamp(str, config.AssumeUTC)
+			if err != nil {
+				return nil, err
+			}
+			return timeToInt96(ts), nil
+		}
+	}
+
+	if lt := t.LogicalType(); lt != nil && lt.Date != nil {
+		return func(value any) (any, error) {
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert %T to DATE", value)
+			}
+			return dateToDays(str)
+		}
+	}
+
+	// Besides json.Number, numeric and boolean leaves accept their value spelled as a string
+	// and string leaves accept any scalar, so hinted columns can hold either form
+	switch t.Kind() {
+	case parquet.Double:
+		return func(value any) (any, error) {
+			switch v := value.(type) {
+			case json.Number:
+				return v.Float64()
+			case string:
+				return strconv.ParseFloat(strings.TrimSpace(v), 64)
+			case bool:
+				return nil, fmt.Errorf("cannot convert bool to DOUBLE")
+			}
+			return value, nil
+		}
+	case parquet.Float:
+		return func(value any) (any, error) {
+			var text string
+			switch v := value.(type) {
+			case json.Number:
+				text = v.String()
+			case string:
+				text = strings.TrimSpace(v)
+			case bool:
+				return nil, fmt.Errorf("cannot convert bool to FLOAT")
+			default:
+				return value, nil
+			}
+			f, err := strconv.ParseFloat(text, 32)
+			return float32(f), err
+		}
+	case parquet.Int64:
+		return func(value any) (any, error) {
+			switch v := value.(type) {
+			case json.Number:
+				return v.Int64()
+			case string:
+				return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			case bool:
+				return nil, fmt.Errorf("cannot convert bool to INT64")
+			}
+			return value, nil
+		}
+	case parquet.Int32:
+		return func(value any) (any, error) {
+			var text string
+			switch v := value.(type) {
+			case json.Number:
+				text = v.String()
+			case string:
+				text = strings.TrimSpace(v)
+			case bool:
+				return nil, fmt.Errorf("cannot convert bool to INT32")
+			default:
+				return value, nil
+			}
+			n, err := strconv.ParseInt(text, 10, 32)
+			return int32(n), err
+		}
+	case parquet.Boolean:
+		return func(value any) (any, error) {
+			switch v := value.(type) {
+			case json.Number:
+				return strconv.ParseBool(v.String())
+			case string:
+				return strconv.ParseBool(strings.TrimSpace(v))
+			}
+			return value, nil
+		}
+	case parquet.ByteArray:
+		if t.LogicalType() == nil {
+			// Raw bytes travel through JSON as base64, the way encoding/json writes them
+			return func(value any) (any, error) {
+				str, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("cannot convert %T to BYTE_ARRAY, want a base64 string", value)
+				}
+				data, err := base64.StdEncoding.DecodeString(str)
+				if err != nil {
+					return nil, fmt.Errorf("invalid base64: %w", err)
+				}
+				return data, nil
+			}
+		}
+		return func(value any) (any, error) {
+			switch v := value.(type) {
+			case json.Number:
+				return v.String(), nil
+			case bool:
+				return strconv.FormatBool(v), nil
+			}
+			return value, nil
+		}
+	}
+	return nil
+}
+
+/*
+decimalToUnscaled converts a JSON number (or numeric string) into the unscaled INT64
+representation of a DECIMAL(precision, scale) value. The conversion is exact: values with
+more fractional digits than the scale, or more digits than the precision, are rejected.
+*/
+func decimalToUnscaled(value any, precision, scale int) (int64, error) {
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		text = v.String()
+	case string:
+		text = strings.TrimSpace(v)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to DECIMAL(%d,%d)", value, precision, scale)
+	}
+
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return 0, fmt.Errorf("invalid decimal value %q", text)
+	}
+
+	r.Mul(r, new(big.Rat).SetInt(pow10(scale)))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("decimal value %s has more than %d fractional digits", text, scale)
+	}
+
+	unscaled := r.Num()
+	if new(big.Int).Abs(unscaled).Cmp(pow10(precision)) >= 0 {
+		return 0, fmt.Errorf("decimal value %s does not fit DECIMAL(%d,%d)", text, precision, scale)
+	}
+	return unscaled.Int64(), nil
+}
+
+// formatDecimal renders an unscaled DECIMAL value as a fixed-point string.
+func formatDecimal(unscaled int64, scale int) string {
+	digits := new(big.Int).Abs(big.NewInt(unscaled)).String()
+	sign := ""
+	if unscaled < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	point := len(digits) - scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// dateLayout is the only layout recognized as a DATE.
+const dateLayout = "2006-01-02"
+
+// isDateString reports whether s is a date-only YYYY-MM-DD string.
+func isDateString(s string) bool {
+	if len(s) != len(dateLayout) {
+		return false
+	}
+	_, err := time.Parse(dateLayout, s)
+	return err == nil
+}
+
+// dateToDays converts a YYYY-MM-DD string to days since the Unix epoch.
+func dateToDays(s string) (int32, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %q: %w", s, err)
+	}
+	return int32(t.Unix() / 86400), nil
+}
+
+// formatDate renders days since the Unix epoch as YYYY-MM-DD.
+func formatDate(days int32) string {
+	return time.Unix(int64(days)*86400, 0).UTC().Format(dateLayout)
+}
+
+// naiveTimestampLayout is an RFC 3339 timestamp without its zone offset, like 2023-05-01T12:00:00.
+const naiveTimestampLayout = "2006-01-02T15:04:05.999999999"
+
+// isTimestampString reports whether s is a timestamp parseTimestamp accepts.
+func isTimestampString(s string, assumeUTC bool) bool {
+	_, err := parseTimestamp(s, assumeUTC)
+	return err == nil
+}
+
+/*
+parseTimestamp parses an RFC 3339 timestamp string into a UTC instant. Z and numeric offsets are
+both accepted. A timestamp without an offset doesn't name an instant, so it is read as UTC only
+when assumeUTC is set and is an error otherwise.
+*/
+func parseTimestamp(s string, assumeUTC bool) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err == nil {
+		return t.UTC(), nil
+	}
+	if naive, naiveErr := time.Parse(naiveTimestampLayout, s); naiveErr == nil {
+		if !assumeUTC {
+			return time.Time{}, fmt.Errorf("timestamp %q has no zone offset", s)
+		}
+		return naive, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", s, err)
+}
+
+// julianUnixEpoch is the Julian day number of 1970-01-01, the day INT96 timestamps count from.
+const julianUnixEpoch = 2440588
+
+const secondsPerDay = 24 * 60 * 60
+
+/*
+timeToInt96 converts t to the legacy INT96 timestamp layout written by Impala and Spark:
+nanoseconds within the day in the low 8 bytes, then the Julian day number.
+*/
+func timeToInt96(t time.Time) deprecated.Int96 {
+	// Whole seconds, as nanoseconds since 1970 only reach the years 1678 to 2262
+	seconds := t.Unix()
+	days := seconds / secondsPerDay
+	if seconds%secondsPerDay < 0 {
+		days-- // Floor, so times before 1970 count forward from their own midnight
+	}
+	ofDay := (seconds-days*secondsPerDay)*int64(time.Second) + int64(t.Nanosecond())
+	return deprecated.Int96{uint32(ofDay), uint32(ofDay >> 32), uint32(days + julianUnixEpoch)}
+}
+
+// int96ToTime converts a legacy INT96 timestamp back to a UTC time.
+func int96ToTime(v deprecated.Int96) time.Time {
+	ofDay := int64(v[1])<<32 | int64(v[0])
+	days := int64(v[2]) - julianUnixEpoch
+	return time.Unix(days*secondsPerDay, ofDay).UTC()
+}
+
+// The times nanoseconds since the Unix epoch can count in an int64, the years 1678 to 2262.
+var (
+	minNanoTime = time.Unix(0, math.MinInt64)
+	maxNanoTime = time.Unix(0, math.MaxInt64)
+)
+
+// unixNano returns t as nanoseconds since the Unix epoch, or an error if they don't fit in an int64.
+func unixNano(t time.Time) (int64, error) {
+	if t.Before(minNanoTime) || t.After(maxNanoTime) {
+		return 0, fmt.Errorf("timestamp %s is out of the range nanoseconds can count (years 1678 to 2262)", t.Format(time.RFC3339Nano))
+	}
+	return t.UnixNano(), nil
+}
+
+/*
+timestampToInt converts t to a count of unit since the Unix epoch, for TIMESTAMP columns.
+Precision finer than unit is an error, so no value is silently truncated.
+*/
+func timestampToInt(t time.Time, unit format.TimeUnit) (int64, error) {
+	switch {
+	case unit.Millis != nil:
+		if t.Nanosecond()%int(time.Millisecond) != 0 {
+			return 0, fmt.Errorf("timestamp %s is more precise than milliseconds", t.Format(time.RFC3339Nano))
+		}
+		return t.UnixMilli(), nil
+	case unit.Micros != nil:
+		if t.Nanosecond()%int(time.Microsecond) != 0 {
+			return 0, fmt.Errorf("timestamp %s is more precise than microseconds", t.Format(time.RFC3339Nano))
+		}
+		return t.UnixMicro(), nil
+	}
+	return unixNano(t)
+}
+
+// formatTimestamp renders a TIMESTAMP value counted in unit as an RFC 3339 string in loc.
+func formatTimestamp(v int64, unit format.TimeUnit, loc *time.Location) string {
+	return timestampTime(v, unit).In(loc).Format(time.RFC3339Nano)
+}
+
+// timestampTime returns the instant v counts in unit since the Unix epoch.
+func timestampTime(v int64, unit format.TimeUnit) time.Time {
+	switch {
+	case unit.Millis != nil:
+		return time.UnixMilli(v)
+	case unit.Micros != nil:
+		return time.UnixMicro(v)
+	}
+	return time.Unix(0, v)
+}
+
+/*
+parseUUID parses a canonical hyphenated UUID string (8-4-4-4-12 hex digits)
+into its 16-byte representation.
+*/
+func parseUUID(s string) ([16]byte, error) {
+	var id [16]byte
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return id, fmt.Errorf("invalid UUID %q", s)
+	}
+
+	digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err := hex.Decode(id[:], []byte(digits)); err != nil {
+		return id, fmt.Errorf("invalid UUID %q", s)
+	}
+	return id, nil
+}
+
+// formatUUID renders 16 bytes as a canonical hyphenated UUID string.
+func formatUUID(id []byte) string {
+	h := hex.EncodeToString(id)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// pow10 returns 10^n as a big.Int.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+/*
+compareValues orders two non-nil JSON values. Values of the same kind compare naturally;
+mixed kinds order booleans before numbers before strings so sorting never fails.
+*/
+func compareValues(a, b any) int {
+	a, b = plainEJSON(a), plainEJSON(b)
+	ra, rb := valueRank(a), valueRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch x := a.(type) {
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		default:
+			return 1
+		}
+	case json.Number:
+		return compareNumbers(x, b.(json.Number))
+	case string:
+		return strings.Compare(x, b.(string))
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// valueRank groups values by kind for mixed-type comparisons.
+func valueRank(v any) int {
+	switch v.(type) {
+	case bool:
+		return 0
+	case json.Number:
+		return 1
+	case string:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// compareNumbers compares two JSON numbers, falling back to exact arithmetic when floats tie.
+func compareNumbers(a, b json.Number) int {
+	if a == b {
+		return 0
+	}
+	fa, errA := a.Float64()
+	fb, errB := b.Float64()
+	if errA == nil && errB == nil && fa != fb {
+		if fa < fb {
+			return -1
+		}
+		return 1
+	}
+
+	ra, okA := new(big.Rat).SetString(a.String())
+	rb, okB := new(big.Rat).SetString(b.String())
+	if !okA || !okB {
+		return strings.Compare(a.String(), b.String())
+	}
+	return ra.Cmp(rb)
+}
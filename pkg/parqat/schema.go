@@ -0,0 +1,257 @@
+package parqat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// SchemaFile is the JSON form of a flat Parquet schema, as written by WriterConfig.DumpSchema
+// and read back by LoadSchemaFile.
+type SchemaFile struct {
+	Fields []SchemaField `json:"fields"`
+}
+
+/*
+SchemaField describes one column of a SchemaFile. Type is one of TypeHintNames, or "date",
+"uuid", "enum" (a string column annotated as ENUM), "decimal", "timestamp_millis", "timestamp_micros", "timestamp_nanos" or
+"timestamp_int96"; Precision and Scale are only used for decimals. Files written by other tools
+can also have nested columns, described as "group", "list" or "map" with their Fields, which
+LoadSchemaFile can't write with.
+*/
+type SchemaField struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Nullable  bool   `json:"nullable"`
+	Precision int    `json:"precision,omitempty"`
+	Scale     int    `json:"scale,omitempty"`
+	// Description documents the column in the written file; see WriterConfig.ColumnMeta.
+	Description string `json:"description,omitempty"`
+	// Repeated marks a field holding any number of values without a LIST annotation.
+	Repeated bool `json:"repeated,omitempty"`
+	// Fields are the fields of a group, the element of a list, or the key and value of a map.
+	Fields []SchemaField `json:"fields,omitempty"`
+}
+
+/*
+DescribeSchema returns the SchemaFile form of a schema built by this package, which only writes
+unannotated BYTE_ARRAY columns for raw bytes, so they are described as binary.
+*/
+func DescribeSchema(schema *parquet.Schema) (SchemaFile, error) {
+	var file SchemaFile
+	for _, field := range schema.Fields() {
+		described, err := describeField(field)
+		if err != nil {
+			return SchemaFile{}, err
+		}
+		file.Fields = append(file.Fields, described)
+	}
+	return file, nil
+}
+
+// describeField returns the SchemaField form of field, with the fields nested in it.
+func describeField(field parquet.Field) (SchemaField, error) {
+	described := SchemaField{Name: field.Name(), Nullable: field.Optional(), Repeated: field.Repeated()}
+	if !field.Leaf() {
+		// A list is a repeated group of one element, and a map a repeated group of a key and
+		// a value; other shapes are described as the groups they are
+		fields, typ := field.Fields(), "group"
+		if lt := field.Type().LogicalType(); lt != nil && len(fields) == 1 && fields[0].Repeated() && !fields[0].Leaf() {
+			switch inner := fields[0].Fields(); {
+			case lt.List != nil && len(inner) == 1:
+				fields, typ = inner, "list"
+			case lt.Map != nil && len(inner) == 2:
+				fields, typ = inner, "map"
+			}
+		}
+		described.Type = typ
+		for _, nested := range fields {
+			child, err := describeField(nested)
+			if err != nil {
+				return SchemaField{}, fmt.Errorf("field %s: %w", field.Name(), err)
+			}
+			described.Fields = append(described.Fields, child)
+		}
+		return described, nil
+	}
+
+	switch logical := field.Type().LogicalType(); {
+	case logical != nil && logical.Decimal != nil:
+		described.Type = "decimal"
+		described.Precision = int(logical.Decimal.Precision)
+		described.Scale = int(logical.Decimal.Scale)
+	case logical != nil && logical.UUID != nil:
+		described.Type = "uuid"
+	case logical != nil && logical.Enum != nil:
+		described.Type = "enum"
+	case logical != nil && logical.Date != nil:
+		described.Type = "date"
+	case logical != nil && logical.Timestamp != nil:
+		switch unit := logical.Timestamp.Unit; {
+		case unit.Millis != nil:
+			described.Type = "timestamp_millis"
+		case unit.Micros != nil:
+			described.Type = "timestamp_micros"
+		default:
+			described.Type = "timestamp_nanos"
+		}
+	default:
+		switch field.Type().Kind() {
+		case parquet.Int96:
+			described.Type = "timestamp_int96"
+		case parquet.Boolean:
+			described.Type = "boolean"
+		case parquet.Int32:
+			described.Type = "int32"
+		case parquet.Int64:
+			described.Type = "int64"
+		case parquet.Float:
+			described.Type = "float"
+		case parquet.Double:
+			described.Type = "double"
+		case parquet.ByteArray:
+			described.Type = "binary"
+			if logical != nil {
+				described.Type = "string"
+			}
+		default:
+			return SchemaField{}, fmt.Errorf("field %s: unsupported type %s", field.Name(), field.Type())
+		}
+	}
+	return described, nil
+}
+
+/*
+dumpSchema writes the SchemaFile form of schema to config.DumpSchema, if set, as indented JSON,
+and its Avro form to config.AvroSchema, if set.
+*/
+func dumpSchema(schema *parquet.Schema, config WriterConfig) error {
+	if err := dumpAvroSchema(schema, config); err != nil {
+		return err
+	}
+	if config.DumpSchema == "" {
+		return nil
+	}
+	described, err := DescribeSchema(schema)
+	if err != nil {
+		return fmt.Errorf("describing schema: %w", err)
+	}
+	descriptions, err := columnDescriptions(schema, config)
+	if err != nil {
+		return err
+	}
+	for i, field := range described.Fields {
+		described.Fields[i].Description = descriptions[field.Name]
+	}
+	data, err := json.MarshalIndent(described, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding schema: %w", err)
+	}
+	if err := os.WriteFile(config.DumpSchema, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing schema file: %w", err)
+	}
+	return nil
+}
+
+// LoadSchemaFile reads a SchemaFile from path, rejecting unknown keys so typos don't go unnoticed.
+func LoadSchemaFile(path string) (*SchemaFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening schema file: %w", err)
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	var schema SchemaFile
+	if err := dec.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("decoding schema file %s: %w", path, err)
+	}
+	if len(schema.Fields) == 0 {
+		return nil, fmt.Errorf("schema file %s has no fields", path)
+	}
+	return &schema, nil
+}
+
+/*
+schemaFromFile builds the Parquet schema a SchemaFile declares, in its field order.
+Encoding options in config apply just as they do to inferred columns.
+*/
+func schemaFromFile(file *SchemaFile, config WriterConfig) (*parquet.Schema, error) {
+	fields := make(parquet.Group)
+	order := make([]string, 0, len(file.Fields))
+	for _, field := range file.Fields {
+		if field.Name == "" {
+			return nil, fmt.Errorf("schema field without a name")
+		}
+		if _, ok := fields[field.Name]; ok {
+			return nil, fmt.Errorf("duplicate schema field %q", field.Name)
+		}
+
+		if field.Repeated || len(field.Fields) > 0 {
+			return nil, fmt.Errorf("field %s: nested and repeated columns can't be written; objects and arrays are stored as JSON strings", field.Name)
+		}
+
+		var node parquet.Node
+		switch name := strings.ToLower(field.Type); name {
+		case "decimal":
+			if field.Precision < 1 || field.Precision > 18 {
+				return nil, fmt.Errorf("field %s: decimal precision %d out of range (1-18)", field.Name, field.Precision)
+			}
+			if field.Scale < 0 || field.Scale > field.Precision {
+				return nil, fmt.Errorf("field %s: decimal scale %d out of range (0-%d)", field.Name, field.Scale, field.Precision)
+			}
+			node = parquet.Decimal(field.Scale, field.Precision, parquet.Int64Type)
+		case "uuid":
+			node = parquet.UUID()
+		case "enum":
+			node = parquet.Enum()
+		case "date":
+			node = parquet.Date()
+		case "timestamp_millis":
+			node = parquet.Timestamp(parquet.Millisecond)
+		case "timestamp_micros":
+			node = parquet.Timestamp(parquet.Microsecond)
+		case "timestamp_nanos":
+			node = parquet.Timestamp(parquet.Nanosecond)
+		case "timestamp_int96":
+			node = parquet.Leaf(parquet.Int96Type)
+		default:
+			leaf, ok := typeHintNodes[name]
+			if !ok {
+				return nil, fmt.Errorf("field %s: unknown type %q (valid: %s, date, uuid, enum, decimal, timestamp_millis, timestamp_micros, timestamp_nanos, timestamp_int96)", field.Name, field.Type, strings.Join(TypeHintNames(), ", "))
+			}
+			node = leaf
+		}
+
+		node, err := encodeNode(node, field.Name, config)
+		if err != nil {
+			return nil, fmt.Errorf("building node for field %s: %w", field.Name, err)
+		}
+		if field.Nullable {
+			node = parquet.Optional(node)
+		}
+		fields[field.Name] = node
+		order = append(order, field.Name)
+	}
+	return parquet.NewSchema(schemaName(config), orderedGroup{Group: fields, order: order}), nil
+}
+
+// pinnedSchema builds config.Schema, refusing rows with fields it doesn't declare.
+func pinnedSchema(rows []map[string]any, config WriterConfig) (*parquet.Schema, error) {
+	declared := make(map[string]bool, len(config.Schema.Fields))
+	for _, field := range config.Schema.Fields {
+		declared[field.Name] = true
+	}
+	for i, row := range rows {
+		for key := range row {
+			if !declared[key] {
+				return nil, fmt.Errorf("record %d: field %q is not in the schema file", i+1, key)
+			}
+		}
+	}
+	return schemaFromFile(config.Schema, config)
+}
@@ -0,0 +1,212 @@
+package parqat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// MergedSchema is one schema inferred across several JSON inputs, as worked out by MergeSchemaFiles.
+type MergedSchema struct {
+	Schema *parquet.Schema
+	// Coercions lists the fields an input on its own would have been given another type for.
+	Coercions []SchemaCoercion
+}
+
+// SchemaCoercion is a field whose values in one input are converted to the merged schema's type.
+type SchemaCoercion struct {
+	Path  string
+	Field string
+	From  string // the type inferred from the input alone, as SchemaField names types
+	To    string // the type in the merged schema
+}
+
+func (c SchemaCoercion) String() string {
+	return fmt.Sprintf("%s: field %s: %s -> %s", c.Path, c.Field, c.From, c.To)
+}
+
+// mergeSampleSize is how many leading rows of each input MergeSchemaFiles samples.
+const mergeSampleSize = 1024 // as the streaming writer samples
+
+/*
+MergeSchemaFiles infers one schema for the JSON rows of all the files at paths, which may be
+gzip-compressed, as if they were one input: it holds the union of their fields, and types that
+differ between files are resolved as within one file, integers widening to doubles and other
+conflicts going by config.OnTypeConflict. Each file is read to the end but only sampled: its first
+rows, and every later row with a field, or a kind of value for a field, not sampled before. The
+schema can then be pinned for every file, e.g. with NewConverter.
+*/
+func MergeSchemaFiles(paths []string, config WriterConfig) (*MergedSchema, error) {
+	if config.Schema != nil {
+		return nil, fmt.Errorf("merging schemas cannot be combined with a schema file")
+	}
+	// Every row is decoded again when the files are converted, and reported then
+	if config.InvalidRow != nil {
+		config.InvalidRow = func(*DecodeError) {}
+	}
+	config.DuplicateRow = nil
+
+	var (
+		samples = make([][]map[string]any, len(paths))
+		orders  = make([][]string, len(paths))
+		all     []map[string]any
+		order   = newFieldOrder()
+	)
+	for i, path := range paths {
+		var err error
+		if samples[i], orders[i], err = sampleSchemaFile(path, config); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		all = append(all, samples[i]...)
+		for _, name := range orders[i] {
+			order.add(name, nil)
+		}
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no rows to infer a schema from")
+	}
+
+	schema, err := buildOptimizedSchema(all, order.names, config)
+	if err != nil {
+		return nil, fmt.Errorf("building schema: %w", err)
+	}
+	merged := &MergedSchema{Schema: schema}
+	mergedTypes, err := schemaTypes(schema)
+	if err != nil {
+		return nil, err
+	}
+	for i, path := range paths {
+		if len(samples[i]) == 0 {
+			continue
+		}
+		own, err := buildOptimizedSchema(samples[i], orders[i], config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: building schema: %w", path, err)
+		}
+		ownTypes, err := schemaTypes(own)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range orders[i] {
+			if ownTypes[name] != mergedTypes[name] {
+				merged.Coercions = append(merged.Coercions, SchemaCoercion{Path: path, Field: name, From: ownTypes[name], To: mergedTypes[name]})
+			}
+		}
+	}
+	return merged, nil
+}
+
+// sampleSchemaFile returns the rows of the file at path that MergeSchemaFiles samples, with the field order.
+func sampleSchemaFile(path string, config WriterConfig) ([]map[string]any, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+	input, err := DecompressInput(file, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dec := newRowDecoder(input, config.InvalidRow, config)
+	order := newFieldOrder()
+	kinds := make(map[string]map[string]bool)
+	var sample []map[string]any
+	for {
+		row, err := decodeOrderedRow(dec, order)
+		if err != nil {
+			if err == io.EOF {
+				return sample, order.names, nil
+			}
+			return nil, nil, decodeError(dec, err)
+		}
+		row = convertArraysToStrings(row)
+		if novelKinds(kinds, row, config) || len(sample) < mergeSampleSize {
+			sample = append(sample, row)
+		}
+	}
+}
+
+/*
+novelKinds records in kinds the kind of each value of row, as schema inference tells them apart,
+and reports whether any field had a kind of value not recorded for it before.
+*/
+func novelKinds(kinds map[string]map[string]bool, row map[string]any, config WriterConfig) bool {
+	novel := false
+	for name, value := range row {
+		kind := "null"
+		switch v := value.(type) {
+		case nil:
+		case json.Number:
+			kind = "float"
+			if integer, beyondFloat := classifyNumber(v); beyondFloat {
+				kind = "bigint"
+			} else if integer {
+				kind = "int"
+			}
+		case string:
+			kind = "string"
+			if isDateString(v) {
+				kind = "date"
+			} else if config.DetectTimestamps && isTimestampString(v, config.AssumeUTC) {
+				kind = "timestamp"
+			}
+		default:
+			kind = reflect.TypeOf(value).String()
+		}
+		if kinds[name] == nil {
+			kinds[name] = make(map[string]bool)
+		}
+		if !kinds[name][kind] {
+			kinds[name][kind] = true
+			novel = true
+		}
+	}
+	return novel
+}
+
+// schemaTypes maps the fields of schema to their types, as SchemaField names them.
+func schemaTypes(schema *parquet.Schema) (map[string]string, error) {
+	described, err := DescribeSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(described.Fields))
+	for _, field := range described.Fields {
+		types[field.Name] = field.Type
+		if field.Type == "decimal" {
+			types[field.Name] = fmt.Sprintf("decimal(%d,%d)", field.Precision, field.Scale)
+		}
+	}
+	return types, nil
+}
+
+// Describe writes a human-readable summary of the merged schema: one line per column, then the coercions.
+func (m *MergedSchema) Describe(w io.Writer) error {
+	types, err := schemaTypes(m.Schema)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "column\ttype\tnullable")
+	for _, field := range m.Schema.Fields() {
+		fmt.Fprintf(tw, "%s\t%s\t%t\n", field.Name(), types[field.Name()], field.Optional())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(m.Coercions) > 0 {
+		lines := make([]string, len(m.Coercions))
+		for i, coercion := range m.Coercions {
+			lines[i] = "  " + coercion.String()
+		}
+		fmt.Fprintf(w, "\ncoerced to the merged types:\n%s\n", strings.Join(lines, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package parqat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+/*
+ToParquetSplit writes JSON rows from r as a numbered series of Parquet files of roughly
+config.MaxFileBytes each, for object stores and engines like Spark or Athena that work best with
+evenly sized files: out.parquet is written as out-000.parquet, out-001.parquet and so on.
+*/
+func ToParquetSplit(path string, r io.Reader, config WriterConfig) error {
+	return ToParquetSplitContext(context.Background(), path, r, config)
+}
+
+/*
+ToParquetSplitContext is ToParquetSplit with cancellation. Every file shares the schema inferred
+from the whole input, so the files form one consistent dataset, and rows keep their order across
+them; with SortBy each file holds the next stretch of the sorted rows. Rows are held in memory as
+ToParquetWithConfig holds them, and only one file is open at a time. Empty input writes no files.
+*/
+func ToParquetSplitContext(ctx context.Context, path string, r io.Reader, config WriterConfig) error {
+	if config.MaxFileBytes <= 0 {
+		return fmt.Errorf("no maximum file size configured")
+	}
+	if config.Verify {
+		return fmt.Errorf("verifying output cannot be combined with splitting it into files")
+	}
+
+	allRows, records, order, err := readAllRows(ctx, r, config, func(io.Reader, WriterConfig) error {
+		return fmt.Errorf("the input outgrew the %d-byte memory budget, and splitting needs every row in memory", config.MaxMemory)
+	})
+	if err != nil {
+		return err
+	}
+	if len(allRows) == 0 {
+		return nil // Empty input is valid
+	}
+
+	schema, err := buildOptimizedSchema(allRows, order, config)
+	if err != nil {
+		return fmt.Errorf("building schema: %w", err)
+	}
+	if err := dumpSchema(schema, config); err != nil {
+		return err
+	}
+	if allRows, records, err = admitRows(allRows, records, schema, config); err != nil {
+		return err
+	}
+	if config, err = chooseWriterSettings(allRows, schema, config); err != nil {
+		return err
+	}
+	writerConfig, err := newParquetWriterConfig(schema, config)
+	if err != nil {
+		return err
+	}
+	if err := sortForWriting(allRows, records, schema, config, writerConfig); err != nil {
+		return err
+	}
+
+	splitter := &fileSplitter{limit: config.MaxFileBytes}
+	coercer := newRowCoercer(schema, rawByteColumns(schema), config)
+	for part, written := 0, 0; written < len(allRows); part++ {
+		n, err := writeSplitFile(ctx, splitFilePath(path, part), allRows, records, written, coercer, writerConfig, config, splitter)
+		if err != nil {
+			return fmt.Errorf("file %d: %w", part, err)
+		}
+		written += n
+	}
+	return nil
+}
+
+// splitFilePath numbers path for the part-th file of a split: out.parquet becomes out-000.parquet.
+func splitFilePath(path string, part int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(path, ext), part, ext)
+}
+
+/*
+writeSplitFile writes rows from rows[first:], whose input record numbers are in records, to a
+new file at path until splitter finds it full or the rows run out, and returns how many it wrote.
+*/
+func writeSplitFile(ctx context.Context, path string, rows []map[string]any, records []int, first int, coercer *rowCoercer, writerConfig *parquet.WriterConfig, config WriterConfig, splitter *fileSplitter) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("creating output file: %w", err)
+	}
+	defer file.Close()
+
+	writer := parquet.NewWriter(file, writerConfig)
+	flusher := newRowGroupFlusher(config)
+	splitter.start(writer)
+
+	batchSize, err := batchRows(config, 262144) // Check for cancellation once per batch, as writeRows does
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	for i := first; i < len(rows); i++ {
+		if (i-first)%batchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+		row, err := coercer.coerce(convertArraysToStrings(rows[i]))
+		if err != nil {
+			return 0, fmt.Errorf("record %d: %w", records[i], err)
+		}
+		if err := writer.Write(row); err != nil {
+			return 0, fmt.Errorf("writing row to parquet: %w", err)
+		}
+		written++
+		if err := flusher.wrote(writer, row); err != nil {
+			return 0, err
+		}
+		full, err := splitter.wrote(row)
+		if err != nil {
+			return 0, err
+		}
+		if full {
+			break
+		}
+	}
+
+	if err := splitter.close(); err != nil {
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("closing output file: %w", err)
+	}
+	return written, nil
+}
+
+/*
+fileSplitter decides when a file of a split is full. parquet-go holds the open row group in
+memory until it is flushed, so its size is estimated from the rowSize of its rows times the
+ratio of written bytes to estimated bytes seen so far, the estimate itself until a row group
+has been written. Once the estimate would fill half the room left in the file, the row group is flushed
+and measured, so a row group that compresses worse than estimated still fits, and the file counts
+as full when less than a sixteenth of the limit is left. Later row groups get half of what is
+left in turn, so files usually end up between 15/16 of the limit and the limit. The room left
+allows for the footer, which grows with every row group, at what it took per row group in the
+last full file; the first file has nothing to go by and may overshoot by its footer.
+*/
+type fileSplitter struct {
+	limit  int64
+	writer *parquet.Writer // writing the current file
+
+	flushed   int64 // size of the file when the last row group was measured
+	pending   int64 // estimated bytes of the rows in the open row group
+	rowGroups int64 // row groups measured in the file
+
+	footerBytes float64 // footer bytes per row group of the last full file
+
+	// Totals over every row group measured, in all files, for the ratio
+	estimatedBytes int64
+	writtenBytes   int64
+}
+
+// start begins a new file written by writer.
+func (s *fileSplitter) start(writer *parquet.Writer) {
+	s.writer, s.flushed, s.pending, s.rowGroups = writer, 0, 0, 0
+}
+
+// close closes the writer, learning the footer size from the file if it was full.
+func (s *fileSplitter) close() error {
+	before := s.size()
+	if err := s.writer.Close(); err != nil {
+		return err
+	}
+	if s.pending == 0 && s.rowGroups > 0 {
+		// Nothing was left to flush, so everything Close wrote is footer
+		s.footerBytes = float64(s.size()-before) / float64(s.rowGroups)
+	}
+	return nil
+}
+
+// size returns how many bytes of the current file the writer has written, buffered or not.
+func (s *fileSplitter) size() int64 {
+	return s.writer.File().Size()
+}
+
+// wrote accounts for a row just written and reports whether the file is full.
+func (s *fileSplitter) wrote(row map[string]any) (bool, error) {
+	if s.size() != s.flushed {
+		// The writer or the row group flusher closed a row group before this row
+		s.measure()
+	}
+	s.pending += rowSize(row)
+
+	ratio := 1.0
+	if s.estimatedBytes > 0 {
+		ratio = float64(s.writtenBytes) / float64(s.estimatedBytes)
+	}
+	if float64(s.pending)*ratio < s.room()/2 {
+		return false, nil
+	}
+	if err := s.writer.Flush(); err != nil {
+		return false, fmt.Errorf("flushing row group: %w", err)
+	}
+	s.measure()
+	return s.room() < float64(s.limit/16), nil
+}
+
+// room estimates how many bytes the file can still grow by before its footer reaches the limit.
+func (s *fileSplitter) room() float64 {
+	return float64(s.limit-s.size()) - s.footerBytes*float64(s.rowGroups+1)
+}
+
+// measure adds the row group written since the last measurement to the totals.
+func (s *fileSplitter) measure() {
+	size := s.size()
+	s.estimatedBytes += s.pending
+	s.writtenBytes += size - s.flushed
+	if size > s.flushed+4 { // Not just the magic number opening the file
+		s.rowGroups++
+	}
+	s.flushed, s.pending = size, 0
+}
@@ -0,0 +1,266 @@
+package parqat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+/*
+StatsMismatch is a statistic stored in a Parquet file that doesn't hold for the values it
+describes. Page is the index of the page within its column chunk for a column index entry, or -1
+for the statistics of the whole chunk.
+*/
+type StatsMismatch struct {
+	RowGroup int
+	Column   string
+	Page     int
+	Stat     string // "min", "max", "null count", "null page" or "page count"
+	Stored   string
+	Actual   string
+}
+
+func (m StatsMismatch) String() string {
+	where, source := fmt.Sprintf("row group %d, column %s", m.RowGroup, m.Column), "the chunk statistics"
+	if m.Page >= 0 {
+		where, source = fmt.Sprintf("%s, page %d", where, m.Page), "the column index"
+	}
+	return fmt.Sprintf("%s: %s is %s in %s but %s in the data", where, m.Stat, m.Stored, source, m.Actual)
+}
+
+/*
+VerifyStats decodes every column chunk of the Parquet file at filePath and checks the min, max
+and null count stored for it, both in the chunk's statistics and per page in its column index,
+against the values actually there. It returns every statistic that doesn't hold, which is meant
+for auditing files from other writers. Column index bounds of byte arrays may be truncated, as
+writers do to keep the index small; a truncated bound only has to still bound the values. Missing
+statistics are not an error. Panics raised by the Parquet reader are reported as errors.
+*/
+func VerifyStats(filePath string) (mismatches []StatsMismatch, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("verifying statistics of %s: %v", filePath, r)
+		}
+	}()
+
+	pr, closer, err := openParquetFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	if err := checkDecryptable(pr, pr.Schema()); err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	columns := pr.Schema().Columns()
+	indexes := pr.ColumnIndexes() // One per column chunk, row group by row group, if there are any
+	for i, rowGroup := range pr.RowGroups() {
+		for j, chunk := range rowGroup.ColumnChunks() {
+			metadata := pr.Metadata().RowGroups[i].Columns[j]
+			var index *format.ColumnIndex
+			if k := i*len(columns) + j; k < len(indexes) && metadata.ColumnIndexLength > 0 {
+				index = &indexes[k]
+			}
+			v := statsVerifier{rowGroup: i, column: strings.Join(columns[j], "."), typ: chunk.Type()}
+			if err := v.verify(chunk, metadata.MetaData.Statistics, index); err != nil {
+				return nil, fmt.Errorf("%s: row group %d, column %s: %w", filePath, i, v.column, err)
+			}
+			mismatches = append(mismatches, v.mismatches...)
+		}
+	}
+	return mismatches, nil
+}
+
+// statsVerifier collects the statistics of one column chunk that don't hold.
+type statsVerifier struct {
+	rowGroup   int
+	column     string
+	typ        parquet.Type
+	mismatches []StatsMismatch
+}
+
+// verify decodes the pages of chunk, checking each against its entry in index, if the chunk has
+// a column index, and the whole chunk against stats.
+func (v *statsVerifier) verify(chunk parquet.ColumnChunk, stats format.Statistics, index *format.ColumnIndex) error {
+	pages := chunk.Pages()
+	defer pages.Close()
+	var (
+		chunkMin, chunkMax parquet.Value
+		chunkNulls         int64
+		numPages           int
+	)
+	for ; ; numPages++ {
+		page, err := pages.ReadPage()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("reading page %d: %w", numPages, err)
+		}
+
+		min, max, ok := page.Bounds()
+		if ok {
+			min, max = min.Clone(), max.Clone() // The page's memory is reused once released
+			if chunkMin.IsNull() || v.typ.Compare(min, chunkMin) < 0 {
+				chunkMin = min
+			}
+			if chunkMax.IsNull() || v.typ.Compare(max, chunkMax) > 0 {
+				chunkMax = max
+			}
+		}
+		nulls := page.NumNulls()
+		chunkNulls += nulls
+		if index != nil && numPages < len(index.NullPages) {
+			v.verifyPage(numPages, index, min, max, ok, nulls, page.NumValues())
+		}
+		parquet.Release(page)
+	}
+
+	if index != nil && len(index.NullPages) != numPages {
+		v.report(-1, "page count", strconv.Itoa(len(index.NullPages)), strconv.Itoa(numPages))
+	}
+	v.verifyChunk(stats, chunkMin, chunkMax, chunkNulls)
+	return nil
+}
+
+/*
+verifyPage checks the column index entry of the page-th page against the page: it holds values
+values, nulls of them null, and its other values lie between min and max if ok. Bounds stored as
+no bytes at all, as writers leave them when they keep no statistics, aren't checked.
+*/
+func (v *statsVerifier) verifyPage(page int, index *format.ColumnIndex, min, max parquet.Value, ok bool, nulls, values int64) {
+	if page < len(index.NullCounts) && index.NullCounts[page] != nulls {
+		v.report(page, "null count", strconv.FormatInt(index.NullCounts[page], 10), strconv.FormatInt(nulls, 10))
+	}
+	nullPage := index.NullPages[page]
+	if actual := !ok && values > 0; nullPage != actual {
+		v.report(page, "null page", strconv.FormatBool(nullPage), strconv.FormatBool(actual))
+	}
+	if !ok || nullPage {
+		return
+	}
+	for _, bound := range []struct {
+		name   string
+		stored [][]byte
+		actual parquet.Value
+		holds  func(stored, actual parquet.Value) bool
+	}{{"min", index.MinValues, min, v.boundsBelow}, {"max", index.MaxValues, max, v.boundsAbove}} {
+		if page >= len(bound.stored) || len(bound.stored[page]) == 0 {
+			continue
+		}
+		stored, err := v.value(bound.stored[page])
+		switch {
+		case err != nil:
+			v.report(page, bound.name, fmt.Sprintf("%x (%v)", bound.stored[page], err), v.format(bound.actual))
+		case !bound.holds(stored, bound.actual):
+			v.report(page, bound.name, v.format(stored), v.format(bound.actual))
+		}
+	}
+}
+
+/*
+verifyChunk checks the chunk statistics against the min, max and null count of its values.
+Statistics a writer left out aren't checked, and the deprecated min and max fields, which hold
+signed comparisons, only where signed order is the column's order. A null count of 0 reads the
+same as a missing one, so only a nonzero count is checked.
+*/
+func (v *statsVerifier) verifyChunk(stats format.Statistics, min, max parquet.Value, nulls int64) {
+	if !hasStatistics(stats) {
+		return
+	}
+	if stats.NullCount != 0 && stats.NullCount != nulls {
+		v.report(-1, "null count", strconv.FormatInt(stats.NullCount, 10), strconv.FormatInt(nulls, 10))
+	}
+
+	storedMin, storedMax := stats.MinValue, stats.MaxValue
+	if storedMin == nil && storedMax == nil && v.signedOrder() {
+		storedMin, storedMax = stats.Min, stats.Max
+	}
+	for _, bound := range []struct {
+		name   string
+		stored []byte
+		actual parquet.Value
+	}{{"min", storedMin, min}, {"max", storedMax, max}} {
+		if bound.stored == nil {
+			continue
+		}
+		stored, err := v.value(bound.stored)
+		switch {
+		case err != nil:
+			v.report(-1, bound.name, fmt.Sprintf("%x (%v)", bound.stored, err), v.format(bound.actual))
+		case bound.actual.IsNull():
+			v.report(-1, bound.name, v.format(stored), "absent (every value is null)")
+		case v.typ.Compare(stored, bound.actual) != 0:
+			v.report(-1, bound.name, v.format(stored), v.format(bound.actual))
+		}
+	}
+}
+
+// boundsBelow reports whether stored, a column index min, is actual or, for byte arrays, a
+// truncation of it.
+func (v *statsVerifier) boundsBelow(stored, actual parquet.Value) bool {
+	if v.typ.Compare(stored, actual) == 0 {
+		return true
+	}
+	return v.byteArray() && len(stored.ByteArray()) < len(actual.ByteArray()) && bytes.HasPrefix(actual.ByteArray(), stored.ByteArray())
+}
+
+// boundsAbove reports whether stored, a column index max, is actual or, for byte arrays, a
+// truncation of it rounded up.
+func (v *statsVerifier) boundsAbove(stored, actual parquet.Value) bool {
+	if v.typ.Compare(stored, actual) == 0 {
+		return true
+	}
+	return v.byteArray() && len(stored.ByteArray()) <= len(actual.ByteArray()) && v.typ.Compare(stored, actual) > 0
+}
+
+// byteArray reports whether the column holds byte arrays, whose column index bounds may be truncated.
+func (v *statsVerifier) byteArray() bool {
+	kind := v.typ.Kind()
+	return kind == parquet.ByteArray || kind == parquet.FixedLenByteArray
+}
+
+// signedOrder reports whether the column is ordered by signed comparison, as the deprecated
+// statistics are: numbers and booleans without an unsigned integer annotation.
+func (v *statsVerifier) signedOrder() bool {
+	if v.byteArray() || v.typ.Kind() == parquet.Int96 {
+		return false
+	}
+	lt := v.typ.LogicalType()
+	return lt == nil || lt.Integer == nil || lt.Integer.IsSigned
+}
+
+// value decodes a statistic stored as PLAIN bytes, without a length prefix for byte arrays.
+func (v *statsVerifier) value(data []byte) (value parquet.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("not a valid %s: %v", v.typ.Kind(), r)
+		}
+	}()
+	return v.typ.Kind().Value(data), nil
+}
+
+// format renders a value for a mismatch report, quoting byte arrays.
+func (v *statsVerifier) format(value parquet.Value) string {
+	if v.byteArray() {
+		return strconv.Quote(string(value.ByteArray()))
+	}
+	return value.String()
+}
+
+// report records a statistic that doesn't hold.
+func (v *statsVerifier) report(page int, stat, stored, actual string) {
+	v.mismatches = append(v.mismatches, StatsMismatch{
+		RowGroup: v.rowGroup,
+		Column:   v.column,
+		Page:     page,
+		Stat:     stat,
+		Stored:   stored,
+		Actual:   actual,
+	})
+}
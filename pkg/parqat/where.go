@@ -0,0 +1,372 @@
+package parqat
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// Predicate compares a top-level column with a value, as in region == 'eu'.
+type Predicate struct {
+	Column string
+	Op     string // ==, !=, <, <=, > or >=
+	Value  any    // a string, an int64 for integer literals, a float64, a bool, or nil for null
+}
+
+// predicateOps lists the comparison operators, the two-character ones first so they match whole.
+var predicateOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+/*
+ParsePredicate parses a comparison written as column op value: region == 'eu', score >= 0.5,
+active != true or name == null. Strings are quoted with single or double quotes; double-quoted
+ones take Go escapes. Null can only be compared with == and !=.
+*/
+func ParsePredicate(expr string) (*Predicate, error) {
+	at := strings.IndexAny(expr, "=!<>")
+	if at < 0 {
+		return nil, fmt.Errorf("invalid filter %q: want column op value, with op one of %s", expr, strings.Join(predicateOps, " "))
+	}
+	p := &Predicate{Column: strings.TrimSpace(expr[:at])}
+	for _, op := range predicateOps {
+		if strings.HasPrefix(expr[at:], op) {
+			p.Op = op
+			break
+		}
+	}
+	if p.Column == "" || p.Op == "" {
+		return nil, fmt.Errorf("invalid filter %q: want column op value, with op one of %s", expr, strings.Join(predicateOps, " "))
+	}
+
+	literal := strings.TrimSpace(expr[at+len(p.Op):])
+	switch {
+	case len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'':
+		p.Value = literal[1 : len(literal)-1]
+	case len(literal) >= 2 && literal[0] == '"':
+		s, err := strconv.Unquote(literal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: malformed string %s", expr, literal)
+		}
+		p.Value = s
+	case literal == "true" || literal == "false":
+		p.Value = literal == "true"
+	case literal == "null":
+		if p.Op != "==" && p.Op != "!=" {
+			return nil, fmt.Errorf("invalid filter %q: null can only be compared with == or !=", expr)
+		}
+	default:
+		// Integers stay exact, so INT64 values past 2^53 aren't matched by their neighbors
+		if n, err := strconv.ParseInt(literal, 10, 64); err == nil {
+			p.Value = n
+			break
+		}
+		n, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: value %q is not a quoted string, a number, true, false or null", expr, literal)
+		}
+		p.Value = n
+	}
+	return p, nil
+}
+
+func (p *Predicate) String() string {
+	switch v := p.Value.(type) {
+	case nil:
+		return fmt.Sprintf("%s %s null", p.Column, p.Op)
+	case string:
+		return fmt.Sprintf("%s %s %q", p.Column, p.Op, v)
+	}
+	return fmt.Sprintf("%s %s %v", p.Column, p.Op, p.Value)
+}
+
+/*
+rowFilter applies a Predicate to the rows of a file, as read by the generic reader, and to the
+statistics of its row groups. Rows whose value is null match only == null and != anything else
+doesn't, as in SQL: no other comparison holds for them.
+*/
+type rowFilter struct {
+	predicate *Predicate
+	typ       parquet.Type
+	index     int  // of the column's chunks within a row group
+	drop      bool // the column is only read for the filter, and left out of the rows
+}
+
+// newRowFilter checks that predicate can be applied to the columns of schema.
+func newRowFilter(schema *parquet.Schema, predicate *Predicate) (*rowFilter, error) {
+	var field parquet.Field
+	for _, f := range schema.Fields() {
+		if f.Name() == predicate.Column {
+			field = f
+		}
+	}
+	if field == nil {
+		return nil, fmt.Errorf("unknown column %q to filter on (columns: %s)", predicate.Column, strings.Join(fieldNames(schema.Fields()), ", "))
+	}
+	if !field.Leaf() || field.Repeated() {
+		return nil, fmt.Errorf("cannot filter on column %s: only flat columns can be compared", predicate.Column)
+	}
+
+	typ, lt := field.Type(), field.Type().LogicalType()
+	var fits bool
+	switch predicate.Value.(type) {
+	case nil:
+		fits = true
+	case string:
+		fits = typ.Kind() == parquet.ByteArray && (lt == nil || lt.UTF8 != nil || lt.Enum != nil || lt.Json != nil)
+	case int64, float64:
+		fits = numericType(typ) && (lt == nil || lt.Integer != nil)
+	case bool:
+		fits = typ.Kind() == parquet.Boolean
+	}
+	if !fits {
+		return nil, fmt.Errorf("cannot filter on column %s: a %s column can't be compared with %s", predicate.Column, describeLeaf(typ), predicate)
+	}
+	leaf, _ := schema.Lookup(predicate.Column)
+	return &rowFilter{predicate: predicate, typ: typ, index: leaf.ColumnIndex}, nil
+}
+
+// describeLeaf names the type of a leaf for filter errors: its logical type if it has one.
+func describeLeaf(typ parquet.Type) string {
+	if lt := typ.LogicalType(); lt != nil {
+		return strings.ToUpper(strings.SplitN(lt.String(), "(", 2)[0])
+	}
+	return typ.Kind().String()
+}
+
+// match reports whether row satisfies the predicate, dropping the column from it if asked to.
+func (f *rowFilter) match(row any) bool {
+	values, _ := row.(map[string]any)
+	value, ok := f.normalize(values[f.predicate.Column])
+	if f.drop {
+		delete(values, f.predicate.Column)
+	}
+	switch {
+	case f.predicate.Value == nil:
+		return ok == (f.predicate.Op == "!=")
+	case !ok:
+		return false
+	}
+	return f.holds(compareNormalized(value, f.predicate.Value))
+}
+
+// holds reports whether the predicate's operator holds for a value that compares to its value as c.
+func (f *rowFilter) holds(c int) bool {
+	switch f.predicate.Op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+/*
+normalize returns a value of the column as a predicate value: a string, bool, float64, or int64
+for integers that fit one.
+*/
+func (f *rowFilter) normalize(value any) (any, bool) {
+	switch v := value.(type) {
+	case string, bool, float64, int64:
+		return v, true
+	case []byte:
+		return string(v), true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return float64(v), true
+		}
+		return int64(v), true
+	case float32:
+		return float64(v), true
+	}
+	return nil, false
+}
+
+/*
+compareNormalized compares two values returned by normalize, of the same type or both numbers.
+Integers are compared with integers exactly, and with floats by value rather than as floats.
+*/
+func compareNormalized(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int64:
+		if b, ok := b.(float64); ok {
+			return -compareFloatInt(b, a)
+		}
+		return cmp.Compare(a, b.(int64))
+	case float64:
+		if b, ok := b.(int64); ok {
+			return compareFloatInt(a, b)
+		}
+		return cmp.Compare(a, b.(float64))
+	case bool:
+		if a == b.(bool) {
+			return 0
+		} else if a {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// compareFloatInt compares f with i without rounding i to a float64; NaN is less than any integer.
+func compareFloatInt(f float64, i int64) int {
+	switch {
+	case math.IsNaN(f) || f < math.MinInt64:
+		return -1
+	case f >= math.MaxInt64: // 2^63, as MaxInt64 rounds up
+		return 1
+	}
+	whole := math.Trunc(f)
+	if c := cmp.Compare(int64(whole), i); c != 0 {
+		return c
+	}
+	return cmp.Compare(f, whole)
+}
+
+/*
+mayMatch reports whether any row of the row-groupth row group of pr can satisfy the predicate,
+going by the min, max and null count in the statistics of the column's chunk, or the bounds in its
+column index when the statistics have none. Without either it may. Float columns are never
+skipped for !=, since NaN values aren't bounded.
+*/
+func (f *rowFilter) mayMatch(pr *parquet.File, rowGroup int, columnIndexes []format.ColumnIndex) bool {
+	chunk := pr.Metadata().RowGroups[rowGroup].Columns[f.index]
+	stats := chunk.MetaData.Statistics
+	if !hasStatistics(stats) {
+		return true
+	}
+	values := chunk.MetaData.NumValues
+	if f.predicate.Value == nil {
+		if f.predicate.Op == "==" {
+			return true // A null count of 0 may just be missing
+		}
+		return stats.NullCount < values
+	}
+	if stats.NullCount == values {
+		return false // Every value is null
+	}
+
+	v := statsVerifier{typ: f.typ}
+	storedMin, storedMax := stats.MinValue, stats.MaxValue
+	if storedMin == nil && storedMax == nil && v.signedOrder() {
+		storedMin, storedMax = stats.Min, stats.Max
+	}
+	min, max := v.bound(storedMin), v.bound(storedMax)
+	if min.IsNull() || max.IsNull() {
+		k := rowGroup*len(pr.Schema().Columns()) + f.index
+		if k >= len(columnIndexes) || chunk.ColumnIndexLength == 0 {
+			return true
+		}
+		var ok bool
+		if min, max, ok = v.indexBounds(&columnIndexes[k]); !ok {
+			return true
+		}
+	}
+
+	lower, lowerOK := f.normalize(f.goValue(min))
+	upper, upperOK := f.normalize(f.goValue(max))
+	if !lowerOK || !upperOK {
+		return true
+	}
+	switch f.predicate.Op {
+	case "==":
+		return compareNormalized(lower, f.predicate.Value) <= 0 && compareNormalized(upper, f.predicate.Value) >= 0
+	case "!=":
+		kind := f.typ.Kind()
+		return kind == parquet.Float || kind == parquet.Double || compareNormalized(lower, f.predicate.Value) != 0 || compareNormalized(upper, f.predicate.Value) != 0
+	case "<":
+		return compareNormalized(lower, f.predicate.Value) < 0
+	case "<=":
+		return compareNormalized(lower, f.predicate.Value) <= 0
+	case ">":
+		return compareNormalized(upper, f.predicate.Value) > 0
+	}
+	return compareNormalized(upper, f.predicate.Value) >= 0
+}
+
+// goValue returns a bound of the column as the generic reader would read the value.
+func (f *rowFilter) goValue(value parquet.Value) any {
+	switch f.typ.Kind() {
+	case parquet.Boolean:
+		return value.Boolean()
+	case parquet.ByteArray:
+		return string(value.ByteArray())
+	}
+	return (&columnProfiler{typ: f.typ}).goValue(value)
+}
+
+/*
+bound decodes a stored min or max, or returns the null value if there is none or it's malformed.
+Empty bounds count as none, as writers that keep no statistics leave them, even though an empty
+string can be a real one; the row group is then read.
+*/
+func (v *statsVerifier) bound(data []byte) parquet.Value {
+	if len(data) == 0 {
+		return parquet.Value{}
+	}
+	value, err := v.value(data)
+	if err != nil {
+		return parquet.Value{}
+	}
+	return value
+}
+
+/*
+indexBounds returns the least min and greatest max of the pages in a column index that aren't all
+null. Byte array bounds may be truncated there, but a truncated bound still bounds the values.
+*/
+func (v *statsVerifier) indexBounds(index *format.ColumnIndex) (min, max parquet.Value, ok bool) {
+	for page, null := range index.NullPages {
+		if null {
+			continue
+		}
+		if page >= len(index.MinValues) || page >= len(index.MaxValues) {
+			return min, max, false
+		}
+		pageMin, pageMax := v.bound(index.MinValues[page]), v.bound(index.MaxValues[page])
+		if pageMin.IsNull() || pageMax.IsNull() {
+			return min, max, false
+		}
+		if min.IsNull() || v.typ.Compare(pageMin, min) < 0 {
+			min = pageMin
+		}
+		if max.IsNull() || v.typ.Compare(pageMax, max) > 0 {
+			max = pageMax
+		}
+	}
+	return min, max, !min.IsNull()
+}
+
+// matchingRowGroups returns those of indexes naming row groups of pr that may hold a matching row.
+func (f *rowFilter) matchingRowGroups(pr *parquet.File, indexes []int) []int {
+	var columnIndexes []format.ColumnIndex
+	for _, rowGroup := range pr.Metadata().RowGroups {
+		if rowGroup.Columns[f.index].ColumnIndexLength > 0 {
+			columnIndexes = pr.ColumnIndexes()
+			break
+		}
+	}
+	var matching []int
+	for _, i := range indexes {
+		if f.mayMatch(pr, i, columnIndexes) {
+			matching = append(matching, i)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,2994 @@
+package parqat
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+// WriterConfig holds configuration for parquet writing.
+// It allows customization of compression, buffer sizes, row group sizes, and encoding options.
+type WriterConfig struct {
+	Codec              compress.Codec
+	PageBufferSize     int
+	MaxRowsPerRowGroup int64
+	DataPageVersion    int
+	// AutoCodec replaces Codec with whichever of snappy and zstd does best on a sample of the
+	// rows, judged by OptimizeFor. CodecChosen, if set, is told which codec was picked. Neither
+	// it nor AutoTune can be used with AppendToParquet.
+	AutoCodec   bool
+	OptimizeFor string
+	CodecChosen func(codec compress.Codec)
+	// AutoTune replaces PageBufferSize and MaxRowsPerRowGroup with the combination from a small
+	// grid that does best on a sample of the rows, also judged by OptimizeFor. Tuned, if set, is
+	// told which values were picked.
+	AutoTune bool
+	Tuned    func(pageBufferSize int, maxRowsPerRowGroup int64)
+	// UseDictionary dictionary-encodes every column that has no other encoding configured;
+	// without it such columns keep parquet-go's default encoding.
+	UseDictionary bool
+	// DefaultEncodingType names the encoding (see EncodingNames) for every column whose
+	// physical type supports it; columns it cannot encode keep their default encoding.
+	DefaultEncodingType string
+	// ColumnEncodings maps field names to the encoding they are written with, overriding
+	// DefaultEncodingType. The encoding must support the column's physical type.
+	ColumnEncodings map[string]string
+	// DeltaColumns lists integer and timestamp columns to write with DELTA_BINARY_PACKED, which
+	// stores near-monotonic values like sequence numbers and event times in a few bits each.
+	// JSON numbers in these columns are stored as INT64 when every sampled one is an integer.
+	DeltaColumns []string
+	// RowGroupBytes closes a row group once roughly this many bytes of rows were written to it.
+	// The size is estimated from the values of each row as parquet stores them, before
+	// compression; MaxRowsPerRowGroup still applies and whichever limit is reached first starts
+	// the next row group.
+	RowGroupBytes int64
+	// FlushEvery and FlushInterval close a row group once it holds this many rows, or once it
+	// has been open this long, whatever its size, so readers see finished row groups sooner.
+	// Of these, MaxRowsPerRowGroup and RowGroupBytes, the first limit reached wins. The interval
+	// is checked as rows are written, so an idle input doesn't close a row group.
+	FlushEvery    int64
+	FlushInterval time.Duration
+	// BloomColumns lists columns that get split-block bloom filters for fast point lookups.
+	BloomColumns []string
+	// SortBy lists columns to sort rows by before writing; a leading '-' sorts descending.
+	SortBy []string
+	// UUIDColumns lists columns of canonical UUID strings stored as 16-byte UUID values.
+	UUIDColumns []string
+	// BinaryColumns lists columns of base64 strings stored as raw BYTE_ARRAY values, marked in
+	// the footer so the reader turns them back into base64. Naming a column the schema lacks
+	// is an error.
+	BinaryColumns []string
+	// DetectDates stores columns whose values are all YYYY-MM-DD strings as DATE.
+	DetectDates bool
+	// DetectTimestamps stores columns whose values are all RFC 3339 timestamps in the
+	// representation TimestampFormat names; empty means TimestampMicros.
+	DetectTimestamps bool
+	TimestampFormat  string
+	// EJSON unwraps MongoDB Extended JSON values ({"$numberLong": "1"}, $numberDecimal, $date,
+	// $oid, $binary and others), so they are stored as INT64, DECIMAL, TIMESTAMP, strings and
+	// BYTE_ARRAY instead of nested objects.
+	EJSON bool
+	// AssumeUTC reads timestamps without a zone offset as UTC. Otherwise they are not detected
+	// as timestamps, and timestamp columns reject them.
+	AssumeUTC bool
+	// EvolveSchema widens the streaming schema with fields that first appear after the sample.
+	EvolveSchema bool
+	// DecimalColumns maps field names to the DECIMAL precision/scale they are written with.
+	DecimalColumns map[string]DecimalSpec
+	// EnumThreshold, if positive, annotates string columns with fewer distinct values than this
+	// in the sample as ENUM, for readers that treat such columns specially. 0 never does.
+	EnumThreshold int
+	// RequiredThreshold is the share of null or missing values (0 to 1) a column's sample may
+	// have and still be written as a required column; 0 makes any null optional. With a positive
+	// threshold, rows with a null in a required column are handled as OnRequiredNull says.
+	RequiredThreshold float64
+	// OnRequiredNull is RequiredNullError or RequiredNullDrop. Empty means RequiredNullError.
+	OnRequiredNull string
+	// DroppedRow, if set, is told about each row RequiredNullDrop skipped.
+	DroppedRow func(record int, err error)
+	// Defaults maps field names to the value written in place of their nulls and missing
+	// values, as JSON text; text that isn't JSON is taken as a string. A column with a default
+	// is written as required whatever RequiredThreshold says, and the default has to convert
+	// to the column's type.
+	Defaults map[string]string
+	// Defaulted, if set, is told about each null a default from Defaults replaced.
+	Defaulted func(record int, field string)
+	// OnTypeConflict decides what happens to a column whose values have more than one JSON type:
+	// TypeConflictString, TypeConflictError or TypeConflictMajority. Empty means TypeConflictString.
+	OnTypeConflict string
+	// StatsColumns limits min/max statistics (column chunk statistics and the column index) to
+	// these columns; nil keeps them for every column. Page header statistics are only written
+	// when statistics are kept for every column, since they can't be chosen per column.
+	StatsColumns []string
+	// NoStats writes no min/max statistics at all, overriding StatsColumns.
+	NoStats bool
+	// Verify reads the written Parquet data back and compares it with the rows that were
+	// written before handing it to the output. Not supported by the streaming writer.
+	Verify bool
+	// Limit stops reading the input after this many rows (0 = no limit). The output is still
+	// a complete Parquet file, and the rest of the input is never read.
+	Limit int64
+	// Tail keeps only the last this many rows of the input, or of the first Limit rows (0 = all).
+	// Every row is still decoded, but only the kept ones are held in memory. Not supported by
+	// the streaming writer, which starts writing before it has seen the end of the input.
+	Tail int64
+	// PartitionBy names the column ToParquetPartitioned splits the output by.
+	PartitionBy string
+	// KeepPartitionColumn keeps the partition column in each file instead of only in the directory name.
+	KeepPartitionColumn bool
+	// MaxOpenFiles is how many partition files ToParquetPartitioned writes at once, each by a
+	// goroutine of its own; 0 means runtime.GOMAXPROCS(0).
+	MaxOpenFiles int
+	// MaxFileBytes is roughly how large each of the files ToParquetSplit writes may grow.
+	MaxFileBytes int64
+	// TypeHints maps field names to a type name from TypeHintNames, overriding the inferred type.
+	TypeHints map[string]string
+	// InvalidRow, if set, is called for each input record that is valid JSON but not an
+	// object (e.g. 42 or [1,2]); the record is skipped instead of failing the conversion.
+	InvalidRow func(err *DecodeError)
+	// Dedupe skips rows identical to an earlier row, comparing their canonical JSON after
+	// Unwrap and Rename. A 16-byte hash of every distinct row is kept, so memory grows with
+	// the number of distinct rows.
+	Dedupe bool
+	// DedupeBy skips rows whose values in these fields (null when missing) match an earlier
+	// row's, keeping the first; it implies Dedupe. Memory grows with the number of distinct keys.
+	DedupeBy []string
+	// DuplicateRow, if set, is called with the record number of each row skipped as a duplicate.
+	DuplicateRow func(record int)
+	// Stop, once closed, ends the input early, e.g. on an interrupt: nothing more of it is read,
+	// a record it cuts in half is dropped, and the rows read so far are written as a complete,
+	// valid file. Unlike cancelling the context, the conversion then succeeds. Nil never stops.
+	Stop <-chan struct{}
+	// Schema replaces schema inference with the columns it declares; input fields it
+	// doesn't declare are an error. See LoadSchemaFile.
+	Schema *SchemaFile
+	// ColumnMeta describes columns by name, for documentation that travels with the file: each
+	// description is written to the footer's key-value metadata and read back by ColumnMeta.
+	// Descriptions in Schema are added to these.
+	ColumnMeta map[string]string
+	// CreatedBy is written as the created_by string of the file footer, which tools and
+	// debuggers read to tell which writer made a file. Empty keeps parquet-go's own.
+	CreatedBy string
+	// Rename maps input field names to the names they are written under, applied as each row is
+	// decoded, so the schema and every other setting see the new names. A row in which two fields
+	// end up with the same name is an error.
+	Rename map[string]string
+	// Unwrap names an object field of every row whose fields replace it at the top level, before
+	// Rename and schema inference, for payloads wrapped like {"data": {...}, "meta": {...}}. Rows
+	// without it, or with it null, are left as they are. A lifted field named like a top-level
+	// one is an error unless UnwrapPrefix is set, which is prepended to every lifted name.
+	Unwrap       string
+	UnwrapPrefix string
+	// NormalizeKeys rewrites the top-level field names of every row as KeysTrim, KeysLower or
+	// KeysSnake says, after Unwrap and before Rename, which takes the normalized names. Fields
+	// normalized to the same name become one column: in a row holding several of them, a null
+	// gives way to a value, and of several values the one whose field name sorts first is kept.
+	// Nested objects keep their field names. Empty leaves names as they are.
+	NormalizeKeys string
+	// StrictKeys makes two field names normalized to the same name an error, in any rows.
+	StrictKeys bool
+	// DroppedKey, if set, is told about each value NormalizeKeys dropped for the value of
+	// another field normalized to the same name in its row: the field kept and the one dropped.
+	DroppedKey func(record int, kept, dropped string)
+	// SchemaName names the root message of the schema; empty means "row".
+	SchemaName string
+	// DumpSchema is a path the schema used for writing is saved to, in the format LoadSchemaFile reads.
+	DumpSchema string
+	// AvroSchema is a path the schema used for writing is saved to as an Avro record schema.
+	AvroSchema string
+	// TempDir is where temporary spool files are created; empty uses the OS default.
+	TempDir string
+	// KeepTemp leaves the temporary spool files in TempDir instead of removing them, for debugging.
+	KeepTemp bool
+	// NoTemp makes the non-streaming path decode the input straight from memory
+	// instead of spooling it to a temp file first. Intended for small inputs. The streaming
+	// path needs a temp file for input it can't read twice, so it fails on such input instead.
+	NoTemp bool
+	// MaxMemory bounds the rows ToParquetWithConfig holds in memory to roughly this many bytes
+	// (0 = no limit). Once the rows read so far outgrow it, the input is read again by the
+	// streaming writer, with EvolveSchema on. Sorting and Verify need every row in memory, so
+	// they fail instead, as does NoTemp on input that can't be read twice.
+	MaxMemory int64
+	// BatchSize is how many rows are handled per batch between checks for cancellation, and in
+	// streaming mode how many decoded rows are held in memory at once (0 = 2^18 rows held in
+	// memory, 2^17 streaming). Negative sizes are an error.
+	BatchSize int
+}
+
+// batchRows returns config.BatchSize, or def if it is 0.
+func batchRows(config WriterConfig, def int) (int, error) {
+	if config.BatchSize < 0 {
+		return 0, fmt.Errorf("batch size %d is not positive", config.BatchSize)
+	}
+	if config.BatchSize == 0 {
+		return def, nil
+	}
+	return config.BatchSize, nil
+}
+
+// schemaName returns the root message name config asks for.
+func schemaName(config WriterConfig) string {
+	if config.SchemaName == "" {
+		return "row"
+	}
+	return config.SchemaName
+}
+
+// Goals for WriterConfig.OptimizeFor.
+const (
+	OptimizeSize  = "size"  // smallest output (the default)
+	OptimizeSpeed = "speed" // fastest compression
+)
+
+// Representations for WriterConfig.TimestampFormat.
+const (
+	TimestampMicros = "micros" // TIMESTAMP(MICROS), adjusted to UTC
+	TimestampMillis = "millis" // TIMESTAMP(MILLIS), adjusted to UTC
+	TimestampInt96  = "int96"  // the deprecated INT96 layout older Spark, Hive and Impala read
+)
+
+// Policies for WriterConfig.OnTypeConflict.
+const (
+	TypeConflictString   = "string"   // store the column as strings, converting every value
+	TypeConflictError    = "error"    // refuse the input, naming the field and its types
+	TypeConflictMajority = "majority" // use the most common type and convert the other values to it
+)
+
+// Key normalizations for WriterConfig.NormalizeKeys.
+const (
+	KeysTrim  = "trim"  // strip surrounding whitespace
+	KeysLower = "lower" // trim, then lowercase
+	KeysSnake = "snake" // trim, then snake_case: "First Name", "firstName" and "FIRST-NAME" become first_name
+)
+
+// Policies for WriterConfig.OnRequiredNull.
+const (
+	RequiredNullError = "error" // fail the conversion, naming the record and the column
+	RequiredNullDrop  = "drop"  // skip the row, reporting it to WriterConfig.DroppedRow
+)
+
+// DecimalSpec describes a fixed-point DECIMAL column stored as a scaled INT64.
+type DecimalSpec struct {
+	Precision int
+	Scale     int
+}
+
+// DefaultWriterConfig returns sensible defaults for performance.
+// Uses SIMD-optimized buffer sizes and Zstd compression.
+func DefaultWriterConfig() WriterConfig {
+	return WriterConfig{
+		Codec:              &parquet.Zstd, // Better compression than default
+		PageBufferSize:     256 * 1024,    // 262144 (2^18) - SIMD-optimized size
+		MaxRowsPerRowGroup: 1048576,       // 2^20 - SIMD-optimized for typical datasets
+		DataPageVersion:    2,             // Use v2 for better performance
+		UseDictionary:      true,          // Enable dictionary encoding
+		OnTypeConflict:     TypeConflictString,
+	}
+}
+
+// newJSONDecoder returns a decoder that keeps JSON numbers as json.Number so
+// their exact text survives until the schema decides how to store them.
+func newJSONDecoder(r io.Reader) *json.Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec
+}
+
+// DecodeError reports malformed JSON input, locating the record that could not be decoded.
+type DecodeError struct {
+	Record int   // 1-based index of the record that failed
+	Offset int64 // byte offset in the (decompressed) input where decoding stopped
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding json at record %d (offset %d): %v", e.Record, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+/*
+decodeError attaches the position of the record dec was decoding to an error it returned.
+Malformed input becomes a *DecodeError; failures of the underlying reader are wrapped as
+plain read errors.
+*/
+func decodeError(dec *rowDecoder, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		// The whole record had the wrong type, which is more useful said plainly
+		return &DecodeError{Record: dec.record, Offset: dec.InputOffset(), Err: fmt.Errorf("record is a JSON %s, not an object", typeErr.Value)}
+	case errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Record: dec.record, Offset: dec.InputOffset(), Err: err}
+	}
+	return fmt.Errorf("reading input at record %d: %w", dec.record, err)
+}
+
+/*
+rowDecoder reads JSON rows from either newline-delimited objects or a single top-level
+JSON array of objects, streaming the array element by element. A comma trailing a
+newline-delimited row is skipped, so rows cut out of an array still decode.
+*/
+type rowDecoder struct {
+	dec     *json.Decoder
+	r       io.Reader // what dec reads from, minus anything it has buffered
+	base    int64     // input offset of the first byte dec read
+	record  int       // 1-based index of the record being decoded
+	invalid func(*DecodeError)
+	unwrap  string
+	prefix  string // for fields lifted out of unwrap
+	rename  map[string]string
+	keys    string            // the WriterConfig.NormalizeKeys normalization
+	strict  map[string]string // normalized names to the field first normalized to them, with StrictKeys
+	dropped func(record int, kept, dropped string)
+	ejson   bool
+	dedupe  *rowDeduper     // nil unless duplicates are skipped
+	stop    <-chan struct{} // ends the input, see WriterConfig.Stop
+	started bool
+	inArray bool
+}
+
+/*
+newRowDecoder returns a rowDecoder over r, keeping numbers as json.Number like newJSONDecoder.
+If invalid is non-nil, records that are valid JSON but not objects are passed to it and
+skipped rather than returned as errors. Decoded rows are reshaped as config's Unwrap,
+NormalizeKeys, Rename and EJSON say, and rows repeating an earlier one are skipped as its Dedupe
+and DedupeBy say.
+*/
+func newRowDecoder(r io.Reader, invalid func(*DecodeError), config WriterConfig) *rowDecoder {
+	br := bufio.NewReader(r)
+	var strict map[string]string
+	if config.StrictKeys {
+		strict = make(map[string]string)
+	}
+	return &rowDecoder{
+		dec:     newJSONDecoder(br),
+		r:       br,
+		invalid: invalid,
+		unwrap:  config.Unwrap,
+		prefix:  config.UnwrapPrefix,
+		rename:  config.Rename,
+		keys:    config.NormalizeKeys,
+		strict:  strict,
+		dropped: config.DroppedKey,
+		ejson:   config.EJSON,
+		dedupe:  newRowDeduper(config),
+		stop:    config.Stop,
+	}
+}
+
+// InputOffset returns the input offset of the decoder, as json.Decoder.InputOffset does.
+func (d *rowDecoder) InputOffset() int64 {
+	return d.base + d.dec.InputOffset()
+}
+
+/*
+Decode stores the next row in v, returning io.EOF once the input is exhausted. Once the
+decoder's stop channel is closed, a record cut off at the end of the input counts as its end.
+*/
+func (d *rowDecoder) Decode(v any) error {
+	err := d.decode(v)
+	if errors.Is(err, io.ErrUnexpectedEOF) && stopped(d.stop) {
+		return io.EOF
+	}
+	return err
+}
+
+// decode is Decode without the stop channel.
+func (d *rowDecoder) decode(v any) error {
+	if !d.started {
+		d.started = true
+		if err := d.openArray(); err != nil {
+			return err
+		}
+	}
+
+	d.record++
+	for {
+		if d.inArray && !d.dec.More() {
+			// Closing bracket, or the input ended inside the array
+			if _, err := d.dec.Token(); err != nil {
+				if err == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			d.inArray = false
+		}
+
+		err := d.dec.Decode(v)
+		var syntaxErr *json.SyntaxError
+		if !d.inArray && errors.As(err, &syntaxErr) && d.skipComma() {
+			continue
+		}
+		if d.skipInvalid(err) {
+			d.record++
+			continue
+		}
+		if row, ok := v.(*map[string]any); ok && err == nil {
+			if err = d.transform(*row); err == nil && d.dedupe.duplicate(d.record, *row) {
+				*row = nil // Decoding into a map keeps its keys
+				d.record++
+				continue
+			}
+		}
+		return err
+	}
+}
+
+/*
+transform lifts the fields of the unwrapped object of a decoded row, normalizes and renames its
+fields and unwraps its Extended JSON, as configured.
+*/
+func (d *rowDecoder) transform(row map[string]any) error {
+	if err := unwrapField(row, d.unwrap, d.prefix); err != nil {
+		return err
+	}
+	if err := d.normalizeKeys(row); err != nil {
+		return err
+	}
+	if err := renameFields(row, d.rename); err != nil {
+		return err
+	}
+	if d.ejson {
+		return unwrapEJSONRow(row)
+	}
+	return nil
+}
+
+/*
+skipInvalid reports whether err says the current record is not an object and, when
+skipping such records is enabled, hands it to the invalid callback. The decoder has
+already consumed the record, so decoding can carry on with the next one.
+*/
+func (d *rowDecoder) skipInvalid(err error) bool {
+	var typeErr *json.UnmarshalTypeError
+	if d.invalid == nil || !errors.As(err, &typeErr) || typeErr.Field != "" {
+		return false
+	}
+	d.invalid(decodeError(d, err).(*DecodeError))
+	return true
+}
+
+// openArray consumes a leading '[' of the input, switching to streaming array elements.
+func (d *rowDecoder) openArray() error {
+	br := d.r.(*bufio.Reader)
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil // Empty input, Decode reports io.EOF
+			}
+			return err
+		}
+		if strings.IndexByte(jsonSpace, c) < 0 {
+			if err := br.UnreadByte(); err != nil {
+				return err
+			}
+			break
+		}
+		d.base++
+	}
+
+	if next, err := br.Peek(1); err == nil && next[0] == '[' {
+		if _, err := d.dec.Token(); err != nil {
+			return err
+		}
+		d.inArray = true
+	}
+	return nil
+}
+
+/*
+skipComma restarts decoding after a comma between top-level rows. json.Decoder cannot
+step over the comma itself, so a fresh decoder continues from the bytes after it.
+*/
+func (d *rowDecoder) skipComma() bool {
+	buffered, err := io.ReadAll(d.dec.Buffered())
+	if err != nil {
+		return false
+	}
+	rest := bytes.TrimLeft(buffered, jsonSpace)
+	if len(rest) == 0 || rest[0] != ',' {
+		return false
+	}
+	rest = rest[1:]
+
+	d.base += d.dec.InputOffset() + int64(len(buffered)-len(rest))
+	d.r = io.MultiReader(bytes.NewReader(rest), d.r)
+	d.dec = newJSONDecoder(d.r)
+	return true
+}
+
+// rowDeduper remembers the rows, or the keys of the rows, a decoder has returned.
+type rowDeduper struct {
+	by       []string
+	seen     map[[16]byte]struct{}
+	reported func(record int)
+}
+
+// newRowDeduper returns the deduper for config, or nil when duplicates are kept.
+func newRowDeduper(config WriterConfig) *rowDeduper {
+	if !config.Dedupe && len(config.DedupeBy) == 0 {
+		return nil
+	}
+	return &rowDeduper{by: config.DedupeBy, seen: make(map[[16]byte]struct{}), reported: config.DuplicateRow}
+}
+
+/*
+duplicate reports whether row, the record-th of the input, repeats an earlier row, and remembers
+it otherwise. Rows are compared by the FNV-128a hash of their canonical JSON (keys sorted, as
+encoding/json writes maps), or of the JSON array of their key values with DedupeBy.
+*/
+func (d *rowDeduper) duplicate(record int, row map[string]any) bool {
+	if d == nil {
+		return false
+	}
+	var key any = row
+	if len(d.by) > 0 {
+		values := make([]any, len(d.by))
+		for i, name := range d.by {
+			values[i] = row[name]
+		}
+		key = values
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return false // Not a JSON value, so not a repeat of any; the writer reports it
+	}
+
+	h := fnv.New128a()
+	h.Write(data)
+	var sum [16]byte
+	h.Sum(sum[:0])
+	if _, ok := d.seen[sum]; !ok {
+		d.seen[sum] = struct{}{}
+		return false
+	}
+	if d.reported != nil {
+		d.reported(record)
+	}
+	return true
+}
+
+// jsonSpace lists the whitespace characters allowed between JSON values.
+const jsonSpace = " \t\r\n"
+
+// gzipMagic is the header every gzip stream starts with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+/*
+DecompressInput wraps r in a gzip reader when it starts with the gzip magic bytes, or
+unconditionally when force is set. Other input is returned buffered, or unchanged when it is
+seekable, so the writers can read a plain file twice instead of spooling it.
+*/
+func DecompressInput(r io.Reader, force bool) (io.Reader, error) {
+	if rs, start, ok := seekableStart(r); ok && !force {
+		// Sniff without buffering so a plain file stays seekable for the writers
+		magic := make([]byte, len(gzipMagic))
+		n, _ := io.ReadFull(rs, magic)
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("seeking input: %w", err)
+		}
+		if n < len(magic) || !bytes.Equal(magic, gzipMagic) {
+			return rs, nil
+		}
+	}
+
+	br := bufio.NewReader(r)
+	if !force {
+		magic, err := br.Peek(len(gzipMagic))
+		if err != nil || !bytes.Equal(magic, gzipMagic) {
+			return br, nil
+		}
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("opening gzip input: %w", err)
+	}
+	return gz, nil
+}
+
+/*
+IsGzipFile reports whether the file at path starts with the gzip magic bytes. A named pipe or
+other file that isn't a regular one is reported as not gzip without reading from it, since the
+bytes read could not be read again.
+*/
+func IsGzipFile(path string) (bool, error) {
+	if info, err := os.Stat(path); err == nil && !info.Mode().IsRegular() {
+		return false, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("opening file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false, nil // Too short to be gzip
+	}
+	return bytes.Equal(magic, gzipMagic), nil
+}
+
+/*
+seekableStart reports whether r can be read again from where it is now, which holds for
+regular files but not for pipes or terminals, and returns that position.
+*/
+func seekableStart(r io.Reader) (io.ReadSeeker, int64, bool) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return nil, 0, false
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, false
+	}
+	return rs, start, true
+}
+
+// removeTemp closes a temporary spool file and removes it, unless config.KeepTemp keeps it.
+func removeTemp(file *os.File, config WriterConfig) {
+	file.Close()
+	if !config.KeepTemp {
+		os.Remove(file.Name())
+	}
+}
+
+/*
+contextReader fails reads once its context is done, so any loop decoding from it
+stops promptly on cancellation.
+*/
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+/*
+stopReader reads from r until stop is closed, and then reports io.EOF; see WriterConfig.Stop.
+Each read of r runs in its own goroutine, so a read blocked on a pipe with nothing to say, like
+a producer waiting for more work, doesn't hold up the stop; that read is abandoned.
+*/
+type stopReader struct {
+	stop <-chan struct{}
+	r    io.Reader
+	buf  []byte
+}
+
+// stopReadResult is the outcome of one read of a stopReader's input.
+type stopReadResult struct {
+	n   int
+	err error
+}
+
+func (s *stopReader) Read(p []byte) (int, error) {
+	if stopped(s.stop) {
+		return 0, io.EOF
+	}
+	if cap(s.buf) < len(p) {
+		s.buf = make([]byte, len(p))
+	}
+	buf := s.buf[:len(p)]
+	done := make(chan stopReadResult, 1)
+	go func() {
+		n, err := s.r.Read(buf)
+		done <- stopReadResult{n: n, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return copy(p, buf[:res.n]), res.err
+	case <-s.stop:
+		s.buf = nil // Still being read into
+		return 0, io.EOF
+	}
+}
+
+// stoppable returns r ended by stop, or r itself if stop is nil.
+func stoppable(r io.Reader, stop <-chan struct{}) io.Reader {
+	if stop == nil {
+		return r
+	}
+	return &stopReader{stop: stop, r: r}
+}
+
+// stopped reports whether stop is closed; a nil stop never is.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+StreamingToParquet writes JSON to Parquet in a streaming fashion without loading all data into memory.
+It samples the first N rows for schema inference, then reads the input again to write it, so a
+bad row past the sample fails after earlier rows were written: callers writing to a file should
+remove it on error. Input that can't be read again is copied byte for byte to a temporary file,
+so pretty-printed objects and high-precision numbers are decoded from exactly the text that was
+given.
+*/
+func StreamingToParquet(w io.Writer, r io.Reader, config WriterConfig) error {
+	return StreamingToParquetContext(context.Background(), w, r, config)
+}
+
+/*
+StreamingToParquetContext is StreamingToParquet with cancellation: it returns ctx's error
+once ctx is done, checking between reads of the input and between written batches.
+*/
+func StreamingToParquetContext(ctx context.Context, w io.Writer, r io.Reader, config WriterConfig) error {
+	if len(config.SortBy) > 0 {
+		return fmt.Errorf("sorting requires the full input in memory and cannot be used in streaming mode")
+	}
+	if config.Tail > 0 {
+		return fmt.Errorf("keeping the last rows requires reading to the end of the input first and cannot be used in streaming mode")
+	}
+
+	// Create a buffer to collect rows for schema inference
+	var sampleRows []map[string]any
+	const sampleSize = 1024 // Sample first 1024 rows for schema inference (2^10 - SIMD-optimized)
+
+	// A seekable input is simply read again for the second pass; anything else, like a
+	// pipe, is teed to a temporary file as the first pass reads it, which is then read
+	// again in its place. The raw bytes are kept rather than re-encoded rows, so numbers
+	// and strings survive exactly
+	input, start, seekable := seekableStart(r)
+	r = stoppable(r, config.Stop)
+	var tempFile *os.File
+	if !seekable {
+		if config.NoTemp {
+			return fmt.Errorf("streaming input that can't be read twice needs a temp file for its second pass, which NoTemp rules out")
+		}
+		var err error
+		if tempFile, err = os.CreateTemp(config.TempDir, "parqat_stream_*.json"); err != nil {
+			return fmt.Errorf("creating temp file: %w", err)
+		}
+		defer removeTemp(tempFile, config)
+		r = io.TeeReader(r, tempFile)
+		input, start = tempFile, 0
+	}
+	r = contextReader{ctx: ctx, r: r}
+
+	dec := newRowDecoder(r, config.InvalidRow, config)
+
+	// First pass: collect samples and write to temp file
+	order := newFieldOrder()
+	limit := config.Limit
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+	for len(sampleRows) < sampleSize && int64(len(sampleRows)) < limit {
+		row, err := decodeOrderedRow(dec, order)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return decodeError(dec, err)
+		}
+
+		sampleRows = append(sampleRows, convertArraysToStrings(row))
+	}
+
+	// Tee the rest of the input to the temp file. With a limit, only rows up to it are
+	// read, so an endless input still ends
+	switch {
+	case tempFile == nil:
+	case limit == math.MaxInt64:
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return fmt.Errorf("copying input to temp file: %w", err)
+		}
+	default:
+		for rows := int64(len(sampleRows)); rows < limit; rows++ {
+			var row map[string]any
+			if err := dec.Decode(&row); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return decodeError(dec, err)
+			}
+		}
+	}
+
+	if len(sampleRows) == 0 {
+		return nil // Empty input is valid
+	}
+
+	// rewind returns a decoder over every row from the start again. Rows re-read from the
+	// input are handed to invalid when they aren't objects, to duplicate when they repeat an
+	// earlier row, and to droppedKey when normalizing their keys drops a value.
+	rewind := func(invalid func(*DecodeError), duplicate func(record int), droppedKey func(record int, kept, dropped string)) (*rowDecoder, error) {
+		if _, err := input.Seek(start, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("seeking input: %w", err)
+		}
+		rewound := config
+		rewound.DuplicateRow = duplicate
+		rewound.DroppedKey = droppedKey
+		var r io.Reader = input
+		if !stopped(config.Stop) {
+			r = stoppable(r, config.Stop)
+		}
+		return newRowDecoder(contextReader{ctx: ctx, r: r}, invalid, rewound), nil
+	}
+
+	// Invalid and duplicate records and dropped values within the sample were already reported
+	// by the first pass
+	sampled := dec.record
+	var quiet, unreported func(*DecodeError)
+	if config.InvalidRow != nil {
+		quiet = func(*DecodeError) {}
+		unreported = func(err *DecodeError) {
+			if err.Record > sampled {
+				config.InvalidRow(err)
+			}
+		}
+	}
+	var unreportedDuplicate func(record int)
+	if config.DuplicateRow != nil {
+		unreportedDuplicate = func(record int) {
+			if record > sampled {
+				config.DuplicateRow(record)
+			}
+		}
+	}
+	var unreportedDroppedKey func(record int, kept, dropped string)
+	if config.DroppedKey != nil {
+		unreportedDroppedKey = func(record int, kept, dropped string) {
+			if record > sampled {
+				config.DroppedKey(record, kept, dropped)
+			}
+		}
+	}
+
+	if config.EvolveSchema {
+		// Add every row that introduces a field the sample never saw
+		rest, err := rewind(quiet, nil, nil)
+		if err != nil {
+			return err
+		}
+		sampleRows, err = appendWideningRows(sampleRows, rest, order)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Build optimized schema from samples
+	schema, err := buildOptimizedSchema(sampleRows, order.names, config)
+	if err != nil {
+		return fmt.Errorf("building schema: %w", err)
+	}
+	if err := dumpSchema(schema, config); err != nil {
+		return err
+	}
+	if config, err = chooseWriterSettings(sampleRows, schema, config); err != nil {
+		return err
+	}
+	coercer := newRowCoercer(schema, rawByteColumns(schema), config)
+	guard, err := newRequiredGuard(schema, rawByteColumns(schema), config)
+	if err != nil {
+		return err
+	}
+	knownFields := make(map[string]bool)
+	for _, field := range schema.Fields() {
+		knownFields[field.Name()] = true
+	}
+
+	writerConfig, err := newParquetWriterConfig(schema, config)
+	if err != nil {
+		return err
+	}
+	batchSize, err := batchRows(config, 131072) // 2^17 - SIMD-optimized batch processing
+	if err != nil {
+		return err
+	}
+
+	// Second pass: read every row again and write it. If the input was stopped during the
+	// first pass, a seekable input is only read as far as the first pass got; a temp file
+	// already ends there
+	if stopped(config.Stop) && tempFile == nil {
+		limit = min(limit, int64(len(sampleRows)))
+	}
+	if dec, err = rewind(unreported, unreportedDuplicate, unreportedDroppedKey); err != nil {
+		return err
+	}
+	writer := parquet.NewWriter(w, writerConfig)
+	flusher := newRowGroupFlusher(config)
+	record := int64(0) // rows read, which the input record numbers exceed once rows are skipped
+	for {
+		var (
+			batch   []map[string]any
+			records []int
+		)
+		for len(batch) < batchSize && record+int64(len(batch)) < limit {
+			var row map[string]any
+			if err := dec.Decode(&row); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return decodeError(dec, err)
+			}
+			batch, records = append(batch, row), append(records, dec.record)
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for i, row := range batch {
+			record++
+			// Refuse to silently drop fields the sample never saw
+			for key := range row {
+				if !knownFields[key] && config.Schema != nil {
+					return fmt.Errorf("record %d: field %q is not in the schema file", records[i], key)
+				}
+				if !knownFields[key] {
+					return fmt.Errorf("field %q first appears at record %d, after the %d-row schema sample; rerun with --evolve to widen the schema", key, records[i], sampleSize)
+				}
+			}
+			if ok, err := guard.admit(records[i], row); !ok {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Convert array values to strings for reliable parquet storage
+			convertedRow, err := coercer.coerce(convertArraysToStrings(row))
+			if err != nil {
+				return fmt.Errorf("record %d: %w", records[i], err)
+			}
+			if err := writer.Write(convertedRow); err != nil {
+				return fmt.Errorf("writing row to parquet: %w", err)
+			}
+			if err := flusher.wrote(writer, convertedRow); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Close()
+}
+
+// chooseWriterSettings applies AutoCodec and then AutoTune, so tuning is measured with the chosen codec.
+func chooseWriterSettings(rows []map[string]any, schema *parquet.Schema, config WriterConfig) (WriterConfig, error) {
+	config, err := chooseCodec(rows, schema, config)
+	if err != nil {
+		return config, err
+	}
+	return tuneWriter(rows, schema, config)
+}
+
+// codecSampleRows is the number of rows AutoCodec compresses with each candidate codec.
+const codecSampleRows = 4096
+
+// autoCodecs are the codecs AutoCodec chooses between.
+var autoCodecs = []compress.Codec{&parquet.Snappy, &parquet.Zstd}
+
+/*
+chooseCodec sets config.Codec for AutoCodec: the first rows are written with each candidate
+codec, and the one with the smallest output (or the fastest, for OptimizeSpeed) wins, as
+betterTrial judges them.
+*/
+func chooseCodec(rows []map[string]any, schema *parquet.Schema, config WriterConfig) (WriterConfig, error) {
+	if !config.AutoCodec {
+		return config, nil
+	}
+	switch config.OptimizeFor {
+	case "", OptimizeSize, OptimizeSpeed:
+	default:
+		return config, fmt.Errorf("unknown optimization goal %q (valid: %s, %s)", config.OptimizeFor, OptimizeSize, OptimizeSpeed)
+	}
+
+	sample := rows[:min(len(rows), codecSampleRows)]
+	trial := config
+	trial.SortBy = nil // The order doesn't matter for comparing codecs
+	var (
+		best     compress.Codec
+		bestSize int
+		bestTime time.Duration
+	)
+	for _, codec := range autoCodecs {
+		trial.Codec = codec
+		size, elapsed, err := writeTrial(sample, schema, trial)
+		if err != nil {
+			return config, fmt.Errorf("trying codec %s: %w", codec, err)
+		}
+		if best == nil || betterTrial(config.OptimizeFor, size, elapsed, bestSize, bestTime) {
+			best, bestSize, bestTime = codec, size, elapsed
+		}
+	}
+
+	config.Codec = best
+	if config.CodecChosen != nil {
+		config.CodecChosen(best)
+	}
+	return config, nil
+}
+
+// tuneSampleRows is the number of rows AutoTune writes with each candidate combination.
+const tuneSampleRows = 16384
+
+// Candidates AutoTune chooses between, defaults first so they win ties.
+var (
+	tunePageBufferSizes     = []int{256 * 1024, 64 * 1024, 1024 * 1024}
+	tuneMaxRowsPerRowGroups = []int64{1048576, 16 * 1024, 4 * 1024}
+)
+
+/*
+tuneWriter sets PageBufferSize and MaxRowsPerRowGroup for AutoTune: the first rows are written
+with every combination of the candidates, and the smallest output (or the fastest, for
+OptimizeSpeed) wins, as betterTrial judges them. Row group sizes larger than the sample all
+behave alike on it, so the sample is large enough to hold several of the smaller candidate
+groups.
+*/
+func tuneWriter(rows []map[string]any, schema *parquet.Schema, config WriterConfig) (WriterConfig, error) {
+	if !config.AutoTune {
+		return config, nil
+	}
+	switch config.OptimizeFor {
+	case "", OptimizeSize, OptimizeSpeed:
+	default:
+		return config, fmt.Errorf("unknown optimization goal %q (valid: %s, %s)", config.OptimizeFor, OptimizeSize, OptimizeSpeed)
+	}
+
+	sample := rows[:min(len(rows), tuneSampleRows)]
+	trial := config
+	trial.SortBy = nil
+	var (
+		bestPageBuffer int
+		bestRowGroup   int64
+		bestSize       int
+		bestTime       time.Duration
+	)
+	for _, pageBufferSize := range tunePageBufferSizes {
+		for _, maxRows := range tuneMaxRowsPerRowGroups {
+			trial.PageBufferSize, trial.MaxRowsPerRowGroup = pageBufferSize, maxRows
+			size, elapsed, err := writeTrial(sample, schema, trial)
+			if err != nil {
+				return config, fmt.Errorf("trying page buffer size %d and row group size %d: %w", pageBufferSize, maxRows, err)
+			}
+			if bestPageBuffer == 0 || betterTrial(config.OptimizeFor, size, elapsed, bestSize, bestTime) {
+				bestPageBuffer, bestRowGroup, bestSize, bestTime = pageBufferSize, maxRows, size, elapsed
+			}
+		}
+	}
+
+	config.PageBufferSize, config.MaxRowsPerRowGroup = bestPageBuffer, bestRowGroup
+	if config.Tuned != nil {
+		config.Tuned(bestPageBuffer, bestRowGroup)
+	}
+	return config, nil
+}
+
+// trialRuns is how many times writeTrial writes the sample when timing it.
+const trialRuns = 3
+
+// trialTimeMargin is how close, as a fraction, two trial times are for betterTrial to call them even.
+const trialTimeMargin = 0.05
+
+/*
+writeTrial writes sample with the settings of trial and returns the size of the output and how
+long writing it took. The time is the fastest of trialRuns runs, as the slower ones were held
+up by something other than the settings; the output is the same every run.
+*/
+func writeTrial(sample []map[string]any, schema *parquet.Schema, trial WriterConfig) (int, time.Duration, error) {
+	writerConfig, err := newParquetWriterConfig(schema, trial)
+	if err != nil {
+		return 0, 0, err
+	}
+	var (
+		buf     bytes.Buffer
+		fastest time.Duration
+	)
+	for run := range trialRuns {
+		buf.Reset()
+		start := time.Now()
+		if err := writeRows(context.Background(), &buf, sample, nil, schema, writerConfig, trial); err != nil {
+			return 0, 0, err
+		}
+		if elapsed := time.Since(start); run == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return buf.Len(), fastest, nil
+}
+
+/*
+betterTrial reports whether a trial beats the best so far for goal: its output is smaller or,
+for OptimizeSpeed, it was faster by more than trialTimeMargin. Times closer than that are
+noise, so the smaller output wins between them.
+*/
+func betterTrial(goal string, size int, elapsed time.Duration, bestSize int, bestTime time.Duration) bool {
+	if goal == OptimizeSpeed {
+		margin := time.Duration(float64(bestTime) * trialTimeMargin)
+		switch {
+		case elapsed < bestTime-margin:
+			return true
+		case elapsed > bestTime+margin:
+			return false
+		}
+	}
+	return size < bestSize
+}
+
+// bloomFilterBitsPerValue is the parquet-go recommended size/error-rate tradeoff.
+const bloomFilterBitsPerValue = 10
+
+/*
+newParquetWriterConfig translates a WriterConfig into the parquet-go writer configuration for schema.
+It validates options that refer to columns by name against the inferred schema.
+*/
+func newParquetWriterConfig(schema *parquet.Schema, config WriterConfig) (*parquet.WriterConfig, error) {
+	writerConfig := &parquet.WriterConfig{
+		Schema:             schema,
+		Compression:        config.Codec,
+		PageBufferSize:     config.PageBufferSize,
+		MaxRowsPerRowGroup: config.MaxRowsPerRowGroup,
+		DataPageVersion:    config.DataPageVersion,
+		DataPageStatistics: true, // Enable statistics for better query performance
+		CreatedBy:          config.CreatedBy,
+	}
+
+	for _, column := range config.BloomColumns {
+		if _, ok := schema.Lookup(column); !ok {
+			return nil, fmt.Errorf("bloom filter column %q not found in inferred schema", column)
+		}
+		writerConfig.BloomFilters = append(writerConfig.BloomFilters, parquet.SplitBlockFilter(bloomFilterBitsPerValue, column))
+	}
+
+	for _, column := range config.BinaryColumns {
+		if _, ok := schema.Lookup(column); !ok {
+			return nil, fmt.Errorf("binary column %q not found in inferred schema", column)
+		}
+	}
+	for _, column := range config.UUIDColumns {
+		if _, ok := schema.Lookup(column); !ok {
+			return nil, fmt.Errorf("uuid column %q not found in inferred schema", column)
+		}
+	}
+	for _, column := range config.StatsColumns {
+		if _, ok := schema.Lookup(column); !ok {
+			return nil, fmt.Errorf("statistics column %q not found in inferred schema", column)
+		}
+	}
+	for _, column := range config.DeltaColumns {
+		if _, ok := schema.Lookup(column); !ok {
+			return nil, fmt.Errorf("delta column %q not found in inferred schema", column)
+		}
+	}
+	if config.NoStats || config.StatsColumns != nil {
+		writerConfig.DataPageStatistics = false
+		for _, path := range schema.Columns() {
+			if config.NoStats || !slices.Contains(config.StatsColumns, path[0]) {
+				writerConfig.SkipPageBounds = append(writerConfig.SkipPageBounds, path)
+			}
+		}
+	}
+
+	descriptions, err := columnDescriptions(schema, config)
+	if err != nil {
+		return nil, err
+	}
+	setColumnMeta(writerConfig, descriptions)
+	setBinaryMeta(writerConfig, rawByteColumns(schema))
+
+	return writerConfig, nil
+}
+
+/*
+rowGroupFlusher starts a new row group when the rows written since the last flush reach
+the configured byte budget, row count or age. The byte budget is approximate: it sums the
+size rowSize estimates for each row.
+*/
+type rowGroupFlusher struct {
+	bytesLimit int64
+	rowLimit   int64
+	interval   time.Duration
+	maxRows    int64 // where the writer closes row groups by itself
+
+	bytes   int64
+	rows    int64
+	started time.Time
+}
+
+// newRowGroupFlusher creates a flusher for the row group limits in config.
+func newRowGroupFlusher(config WriterConfig) *rowGroupFlusher {
+	return &rowGroupFlusher{
+		bytesLimit: config.RowGroupBytes,
+		rowLimit:   config.FlushEvery,
+		interval:   config.FlushInterval,
+		maxRows:    config.MaxRowsPerRowGroup,
+	}
+}
+
+// wrote accounts for a row just written and flushes the row group if a limit is reached.
+func (f *rowGroupFlusher) wrote(writer *parquet.Writer, row map[string]any) error {
+	f.rows++
+	if f.rows == 1 && f.interval > 0 {
+		f.started = time.Now()
+	}
+	flush := (f.rowLimit > 0 && f.rows >= f.rowLimit) || (f.interval > 0 && time.Since(f.started) >= f.interval)
+
+	if f.bytesLimit > 0 {
+		f.bytes += rowSize(row)
+		flush = flush || f.bytes >= f.bytesLimit
+	}
+
+	if !flush {
+		if f.maxRows > 0 && f.rows >= f.maxRows {
+			// The writer closed this row group itself
+			f.bytes, f.rows = 0, 0
+		}
+		return nil
+	}
+
+	f.bytes, f.rows = 0, 0
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("flushing row group: %w", err)
+	}
+	return nil
+}
+
+/*
+rowSize estimates how many bytes a coerced row takes in a row group before compression, from
+the size parquet stores each value at, without encoding the row. Values of nested groups are
+counted in full, and a value of a type it does not know counts as 8 bytes.
+*/
+func rowSize(row map[string]any) int64 {
+	var size int64
+	for _, value := range row {
+		size += valueSize(value)
+	}
+	return size
+}
+
+// valueSize estimates the bytes parquet stores value in, for rowSize.
+func valueSize(value any) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case int32, float32:
+		return 4
+	case deprecated.Int96:
+		return 12
+	case [16]byte:
+		return 16
+	case string:
+		return 4 + int64(len(v)) // Byte arrays carry a 4-byte length
+	case []byte:
+		return 4 + int64(len(v))
+	case map[string]any:
+		return rowSize(v)
+	case []any:
+		var size int64
+		for _, item := range v {
+			size += valueSize(item)
+		}
+		return size
+	default:
+		return 8
+	}
+}
+
+/*
+appendWideningRows scans the remaining JSON rows and appends to sampleRows every row that
+carries a field not seen so far, so schema inference can cover fields that appear late.
+*/
+func appendWideningRows(sampleRows []map[string]any, dec *rowDecoder, order *fieldOrder) ([]map[string]any, error) {
+	for {
+		seen := len(order.names)
+		row, err := decodeOrderedRow(dec, order)
+		if err != nil {
+			if err == io.EOF {
+				return sampleRows, nil
+			}
+			return nil, fmt.Errorf("decoding json for schema evolution: %w", err)
+		}
+
+		if len(order.names) > seen {
+			sampleRows = append(sampleRows, convertArraysToStrings(row))
+		}
+	}
+}
+
+// fieldOrder records top-level field names in the order they are first seen in the input.
+type fieldOrder struct {
+	seen  map[string]bool
+	names []string
+}
+
+// newFieldOrder creates an empty fieldOrder.
+func newFieldOrder() *fieldOrder {
+	return &fieldOrder{seen: make(map[string]bool)}
+}
+
+/*
+observe records the fields of row, decoded from object by dec, that haven't been seen yet, in the
+order object had them. Fields lifted out of the unwrapped object take its place.
+*/
+func (o *fieldOrder) observe(object *orderedObject, row map[string]any, dec *rowDecoder) {
+	fresh := false
+	for key := range row {
+		if !o.seen[key] {
+			fresh = true
+			break
+		}
+	}
+	if !fresh {
+		return
+	}
+
+	for _, key := range object.keys {
+		if dec.unwrap != "" && key == dec.unwrap {
+			// Anything but an object was dropped or rejected by transform
+			for _, name := range object.lifted {
+				o.add(normalizedKey(dec.prefix+name, dec.keys), dec.rename)
+			}
+			continue
+		}
+		o.add(normalizedKey(key, dec.keys), dec.rename)
+	}
+}
+
+// add records the field key, as renamed by rename, if it hasn't been seen yet.
+func (o *fieldOrder) add(key string, rename map[string]string) {
+	if name, renamed := rename[key]; renamed {
+		key = name
+	}
+	if !o.seen[key] {
+		o.seen[key] = true
+		o.names = append(o.names, key)
+	}
+}
+
+/*
+orderedObject decodes a JSON object into fields as newJSONDecoder would decode it into a map,
+and in the same pass records the order of its keys, which Go maps forget, and of the keys of the
+object under the key unwrap. Anything but an object fails to decode as it would into a map.
+*/
+type orderedObject struct {
+	unwrap string
+	fields map[string]any
+	keys   []string
+	lifted []string // keys of the object under unwrap
+}
+
+func (o *orderedObject) UnmarshalJSON(data []byte) error {
+	o.fields, o.keys, o.lifted = nil, nil, nil
+	if trimmed := bytes.TrimLeft(data, jsonSpace); len(trimmed) == 0 || trimmed[0] != '{' {
+		return json.Unmarshal(data, &o.fields)
+	}
+	dec := newJSONDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	var err error
+	o.fields, o.keys, err = readObject(dec, o.unwrap, &o.lifted)
+	return err
+}
+
+/*
+readObject reads the fields of a JSON object from dec, after its opening brace, returning them
+with their keys in order. The keys of an object under the key unwrap go to lifted.
+*/
+func readObject(dec *json.Decoder, unwrap string, lifted *[]string) (map[string]any, []string, error) {
+	fields := make(map[string]any)
+	var keys []string
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, _ := token.(string)
+		var value any
+		if unwrap != "" && key == unwrap {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, nil, err
+			}
+			nested := orderedObject{}
+			if err := nested.UnmarshalJSON(raw); err == nil && nested.fields != nil {
+				value, *lifted = nested.fields, nested.keys
+			} else if err := newJSONDecoder(bytes.NewReader(raw)).Decode(&value); err != nil {
+				return nil, nil, err
+			}
+		} else if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		fields[key] = value
+		keys = append(keys, key)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	return fields, keys, nil
+}
+
+/*
+unwrapField replaces the object field name of row with its fields, named with prefix prepended.
+A missing or null field is left out; anything else that isn't an object is an error, as is a
+lifted field that would overwrite one already at the top level.
+*/
+func unwrapField(row map[string]any, name, prefix string) error {
+	if name == "" {
+		return nil
+	}
+	value, ok := row[name]
+	if !ok || value == nil {
+		delete(row, name)
+		return nil
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("unwrapping field %s: it is not an object", name)
+	}
+	delete(row, name)
+	for key, field := range object {
+		if _, taken := row[prefix+key]; taken {
+			return fmt.Errorf("unwrapping field %s: %q is already a top-level field; set --unwrap-prefix to keep both", name, prefix+key)
+		}
+		row[prefix+key] = field
+	}
+	return nil
+}
+
+// decodeOrderedRow decodes the next JSON object from dec and records its field order.
+func decodeOrderedRow(dec *rowDecoder, order *fieldOrder) (map[string]any, error) {
+	object := &orderedObject{unwrap: dec.unwrap}
+	for {
+		if err := dec.Decode(object); err != nil {
+			return nil, err
+		}
+		if err := dec.transform(object.fields); err != nil {
+			return nil, err
+		}
+		if !dec.dedupe.duplicate(dec.record, object.fields) {
+			break
+		}
+	}
+	order.observe(object, object.fields, dec)
+	return object.fields, nil
+}
+
+// renameFields renames the keys of row as rename maps them, in place.
+func renameFields(row map[string]any, rename map[string]string) error {
+	if len(rename) == 0 {
+		return nil
+	}
+	renamed := make(map[string]any, len(row))
+	for key, value := range row {
+		name, ok := rename[key]
+		if !ok {
+			name = key
+		}
+		if _, taken := renamed[name]; taken {
+			return fmt.Errorf("renaming fields: more than one field is named %q", name)
+		}
+		renamed[name] = value
+	}
+	clear(row)
+	maps.Copy(row, renamed)
+	return nil
+}
+
+/*
+normalizeKeys normalizes the top-level field names of row as the decoder's NormalizeKeys says, in
+place, merging fields that end up with the same name and reporting the values that lose out.
+*/
+func (d *rowDecoder) normalizeKeys(row map[string]any) error {
+	if d.keys == "" {
+		return nil
+	}
+	normalized := make(map[string]any, len(row))
+	kept := make(map[string]string, len(row)) // normalized names to the field whose value they hold
+	for _, key := range slices.Sorted(maps.Keys(row)) {
+		name, err := normalizeKey(key, d.keys)
+		if err != nil {
+			return err
+		}
+		if d.strict != nil {
+			if first, ok := d.strict[name]; !ok {
+				d.strict[name] = key
+			} else if first != key {
+				return fmt.Errorf("normalizing keys: fields %q and %q are both normalized to %q", first, key, name)
+			}
+		}
+		switch value, taken := normalized[name]; {
+		case !taken || value == nil:
+			normalized[name], kept[name] = row[key], key
+		case row[key] != nil && d.dropped != nil:
+			d.dropped(d.record, kept[name], key)
+		}
+	}
+	clear(row)
+	maps.Copy(row, normalized)
+	return nil
+}
+
+// normalizedKey returns key normalized as mode says, or key itself if mode is unknown.
+func normalizedKey(key, mode string) string {
+	if name, err := normalizeKey(key, mode); err == nil {
+		return name
+	}
+	return key
+}
+
+// normalizeKey returns a field name normalized as mode, a WriterConfig.NormalizeKeys value, says.
+func normalizeKey(key, mode string) (string, error) {
+	switch mode {
+	case "":
+		return key, nil
+	case KeysTrim:
+		return strings.TrimSpace(key), nil
+	case KeysLower:
+		return strings.ToLower(strings.TrimSpace(key)), nil
+	case KeysSnake:
+		return snakeCase(key), nil
+	}
+	return "", fmt.Errorf("unknown key normalization %q (valid: %s, %s, %s)", mode, KeysTrim, KeysLower, KeysSnake)
+}
+
+/*
+snakeCase lowercases name with words joined by underscores: runs of anything but letters and
+digits separate words, as does a capital after a lowercase letter or digit, or the last capital
+of a run followed by a lowercase letter, so userID is user_id and HTTPServer is http_server.
+*/
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	separate := false
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			separate = b.Len() > 0
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				separate = b.Len() > 0
+			}
+		}
+		if separate {
+			b.WriteByte('_')
+			separate = false
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// renameColumns returns columns renamed by rename, failing when two end up with the same name.
+func renameColumns(columns []string, rename map[string]string) ([]string, error) {
+	renamed := make([]string, len(columns))
+	for i, column := range columns {
+		renamed[i] = column
+		if name, ok := rename[column]; ok {
+			renamed[i] = name
+		}
+		if slices.Contains(renamed[:i], renamed[i]) {
+			return nil, fmt.Errorf("renaming columns: more than one column is named %q", renamed[i])
+		}
+	}
+	return renamed, nil
+}
+
+/*
+orderedGroup is a parquet.Group whose fields keep the order they were first seen in the
+input instead of parquet-go's alphabetical order, so column order is stable and meaningful.
+Every method of the Node interface that depends on the order of the fields is overridden, so
+nothing sees the embedded group's own order.
+*/
+type orderedGroup struct {
+	parquet.Group
+	order []string
+}
+
+// Fields returns the group's fields in first-seen order.
+func (g orderedGroup) Fields() []parquet.Field {
+	rank := make(map[string]int, len(g.order))
+	for i, name := range g.order {
+		rank[name] = i
+	}
+
+	fields := g.Group.Fields()
+	sort.SliceStable(fields, func(i, j int) bool {
+		ri, okI := rank[fields[i].Name()]
+		rj, okJ := rank[fields[j].Name()]
+		if okI != okJ {
+			return okI // Unordered fields go last, alphabetically
+		}
+		return ri < rj
+	})
+	return fields
+}
+
+// String prints the group as parquet.Group does, in first-seen order.
+func (g orderedGroup) String() string {
+	var s strings.Builder
+	parquet.PrintSchema(&s, "", g)
+	return s.String()
+}
+
+// GoType returns a struct type with a field for each of the group's, as parquet.Group does, in first-seen order.
+func (g orderedGroup) GoType() reflect.Type {
+	fields := g.Fields()
+	structFields := make([]reflect.StructField, len(fields))
+	for i, field := range fields {
+		first, size := utf8.DecodeRuneInString(field.Name())
+		structFields[i].Name = string(unicode.ToUpper(first)) + field.Name()[size:]
+		structFields[i].Type = field.GoType()
+	}
+	return reflect.StructOf(structFields)
+}
+
+/*
+buildOptimizedSchema analyzes sample rows to build an optimized Parquet schema.
+It infers field types, nullability, and handles arrays safely for compatibility.
+*/
+func buildOptimizedSchema(sampleRows []map[string]any, order []string, config WriterConfig) (*parquet.Schema, error) {
+	if len(sampleRows) == 0 {
+		return nil, fmt.Errorf("no sample rows provided")
+	}
+	if config.Schema != nil {
+		return pinnedSchema(sampleRows, config)
+	}
+
+	// Analyze all fields across all samples
+	fieldStats := make(map[string]*fieldAnalysis)
+
+	for _, row := range sampleRows {
+		for key, value := range row {
+			if fieldStats[key] == nil {
+				fieldStats[key] = &fieldAnalysis{
+					name:       key,
+					types:      make(map[reflect.Type]int),
+					arrayTypes: make(map[reflect.Type]int),
+				}
+			}
+
+			stats := fieldStats[key]
+			stats.totalCount++
+
+			if value == nil {
+				stats.nullCount++
+				continue
+			}
+
+			t := reflect.TypeOf(value)
+			stats.types[t]++
+
+			if str, ok := value.(string); ok && len(stats.distinct) < config.EnumThreshold {
+				if stats.distinct == nil {
+					stats.distinct = make(map[string]bool)
+				}
+				stats.distinct[str] = true
+			}
+			if str, ok := value.(string); ok && isDateString(str) {
+				stats.dateCount++
+			} else if ok && config.DetectTimestamps && isTimestampString(str, config.AssumeUTC) {
+				stats.timestampCount++
+			}
+			if d, ok := value.(ejsonDecimal); ok {
+				precision, scale, exact := decimalShape(string(d))
+				stats.decimalWhole = max(stats.decimalWhole, precision-scale)
+				stats.decimalScale = max(stats.decimalScale, scale)
+				stats.decimalInexact = stats.decimalInexact || !exact
+			}
+			if n, ok := value.(json.Number); ok {
+				integer, beyondFloat := classifyNumber(n)
+				if integer {
+					stats.intCount++
+				}
+				if beyondFloat {
+					stats.bigIntCount++
+				}
+			}
+
+			// Special handling for arrays
+			if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Interface {
+				if slice, ok := value.([]any); ok && len(slice) > 0 {
+					// Analyze all elements in the array, not just the first
+					for _, elem := range slice {
+						if elem != nil {
+							elemType := reflect.TypeOf(elem)
+							stats.arrayTypes[elemType]++
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Build schema fields
+	schemaFields := make(parquet.Group)
+
+	for name, stats := range fieldStats {
+		// Fields missing from some rows count as null there, or they'd be written as zero values
+		stats.nullCount += len(sampleRows) - stats.totalCount
+		stats.totalCount = len(sampleRows)
+
+		node, err := buildNodeFromStats(stats, config)
+		if err != nil {
+			return nil, fmt.Errorf("building node for field %s: %w", name, err)
+		}
+		schemaFields[name] = node
+	}
+
+	return parquet.NewSchema(schemaName(config), orderedGroup{Group: schemaFields, order: order}), nil
+}
+
+/*
+fieldAnalysis holds statistics for a single field across sample rows.
+Used for schema inference and type analysis.
+*/
+type fieldAnalysis struct {
+	name        string
+	totalCount  int
+	nullCount   int
+	types       map[reflect.Type]int
+	arrayTypes  map[reflect.Type]int
+	dateCount   int // string values shaped like YYYY-MM-DD
+	intCount    int // numbers written as integers that fit in INT64
+	bigIntCount int // of those, the ones a DOUBLE would round
+	// string values that are RFC 3339 timestamps, counted with DetectTimestamps only
+	timestampCount int
+	// the most whole and fractional digits of the $numberDecimal values, and whether any had
+	// no fixed-point shape
+	decimalWhole, decimalScale int
+	decimalInexact             bool
+	// the distinct string values, collected with EnumThreshold only and up to that many
+	distinct map[string]bool
+}
+
+/*
+buildNodeFromStats creates a Parquet node for a field based on its observed types and nullability.
+Handles arrays by converting them to strings for safety, and honors declared DECIMAL columns.
+*/
+func buildNodeFromStats(stats *fieldAnalysis, config WriterConfig) (parquet.Node, error) {
+	// Determine the most common type
+	var dominantType reflect.Type
+	maxCount := 0
+
+	for t, count := range stats.types {
+		if count > maxCount {
+			maxCount = count
+			dominantType = t
+		}
+	}
+
+	var node parquet.Node
+
+	switch spec, isDecimal := config.DecimalColumns[stats.name]; {
+	case isDecimal:
+		// Declared decimals win over whatever the samples looked like
+		if spec.Precision < 1 || spec.Precision > 18 {
+			return nil, fmt.Errorf("decimal precision %d out of range (1-18)", spec.Precision)
+		}
+		if spec.Scale < 0 || spec.Scale > spec.Precision {
+			return nil, fmt.Errorf("decimal scale %d out of range (0-%d)", spec.Scale, spec.Precision)
+		}
+		node = parquet.Decimal(spec.Scale, spec.Precision, parquet.Int64Type)
+	case slices.Contains(config.UUIDColumns, stats.name):
+		node = parquet.UUID()
+	case slices.Contains(config.BinaryColumns, stats.name):
+		node = typeHintNodes["binary"]
+	case config.TypeHints[stats.name] != "":
+		// Hints replace the statistical guess; nullability still comes from the data
+		hinted, ok := typeHintNodes[config.TypeHints[stats.name]]
+		if !ok {
+			return nil, fmt.Errorf("unknown type hint %q (valid: %s)", config.TypeHints[stats.name], strings.Join(TypeHintNames(), ", "))
+		}
+		node = hinted
+	case len(stats.types) > 1 && config.OnTypeConflict == TypeConflictError:
+		return nil, fmt.Errorf("conflicting types %s", describeTypes(stats.types))
+	case len(stats.types) > 1 && (config.OnTypeConflict == "" || config.OnTypeConflict == TypeConflictString):
+		// Every scalar has a string form, so the column can hold all of them
+		node = parquet.String()
+	case len(stats.types) > 1 && config.OnTypeConflict != TypeConflictMajority:
+		return nil, fmt.Errorf("unknown type conflict policy %q", config.OnTypeConflict)
+	case dominantType != nil && dominantType.Kind() == reflect.Slice:
+		// Handle array types - following WWJD pattern: convert arrays to strings to avoid known bugs
+		// See GitHub issues #304, #268, #267, #185, #187 - complex types cause panics and corruption
+		// Arrays are converted to JSON strings to avoid known reflection bugs and corruption
+		// This is the safe approach until upstream bugs are fixed
+		node = parquet.String()
+	case dominantType == ejsonLongType:
+		node = parquet.Leaf(parquet.Int64Type)
+	case dominantType == ejsonDecimalType && !stats.decimalInexact && stats.decimalWhole+stats.decimalScale <= 18:
+		node = parquet.Decimal(stats.decimalScale, max(stats.decimalWhole+stats.decimalScale, 1), parquet.Int64Type)
+	case dominantType == ejsonDateType:
+		timestamp, err := timestampNode(config.TimestampFormat)
+		if err != nil {
+			return nil, err
+		}
+		node = timestamp
+	case dominantType == ejsonBinaryType:
+		node = typeHintNodes["binary"]
+	case dominantType == numberType && stats.intCount == stats.types[numberType] && (stats.bigIntCount > 0 || slices.Contains(config.DeltaColumns, stats.name)):
+		// Every number is an integer and some would lose digits as DOUBLE, or the column is
+		// to be delta-encoded, which only works for integers
+		node = parquet.Leaf(parquet.Int64Type)
+	case config.DetectDates && stats.dateCount > 0 && stats.dateCount == stats.totalCount-stats.nullCount:
+		// Every non-null sample is a YYYY-MM-DD string
+		node = parquet.Date()
+	case config.DetectTimestamps && stats.timestampCount > 0 && stats.timestampCount == stats.totalCount-stats.nullCount:
+		// Every non-null sample is an RFC 3339 timestamp
+		timestamp, err := timestampNode(config.TimestampFormat)
+		if err != nil {
+			return nil, err
+		}
+		node = timestamp
+	case dominantType == reflect.TypeOf("") && len(stats.distinct) < config.EnumThreshold:
+		// Few enough distinct strings to be a set of labels
+		node = parquet.Enum()
+	case dominantType != nil:
+		node = createLeafNode(dominantType)
+	default:
+		// Default to string for unknown types
+		node = parquet.String()
+	}
+
+	node, err := encodeNode(node, stats.name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make optional if nulls are more common than the threshold allows, unless they get a default
+	_, defaulted := config.Defaults[stats.name]
+	if stats.nullCount > 0 && float64(stats.nullCount)/float64(stats.totalCount) > config.RequiredThreshold && !defaulted {
+		node = parquet.Optional(node)
+	}
+
+	return node, nil
+}
+
+// timestampNode returns the leaf for timestamps written in the given WriterConfig.TimestampFormat.
+func timestampNode(format string) (parquet.Node, error) {
+	switch format {
+	case "", TimestampMicros:
+		return parquet.Timestamp(parquet.Microsecond), nil
+	case TimestampMillis:
+		return parquet.Timestamp(parquet.Millisecond), nil
+	case TimestampInt96:
+		return parquet.Leaf(parquet.Int96Type), nil
+	}
+	return nil, fmt.Errorf("unknown timestamp format %q (valid: %s, %s, %s)", format, TimestampMicros, TimestampMillis, TimestampInt96)
+}
+
+// describeTypes lists observed value types by JSON name with their counts, most common first.
+func describeTypes(types map[reflect.Type]int) string {
+	type typeCount struct {
+		name  string
+		count int
+	}
+	counts := make([]typeCount, 0, len(types))
+	for t, count := range types {
+		name := t.String()
+		switch {
+		case t == numberType:
+			name = "number"
+		case t.Kind() == reflect.String:
+			name = "string"
+		case t.Kind() == reflect.Bool:
+			name = "boolean"
+		}
+		counts = append(counts, typeCount{name: name, count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].name < counts[j].name
+	})
+
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%s (%d)", c.name, c.count)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// encodings maps the names accepted in WriterConfig encoding options to parquet-go encodings.
+var encodings = map[string]encoding.Encoding{
+	"PLAIN":                   &parquet.Plain,
+	"RLE":                     &parquet.RLE,
+	"RLE_DICTIONARY":          &parquet.RLEDictionary,
+	"DELTA_BINARY_PACKED":     &parquet.DeltaBinaryPacked,
+	"DELTA_LENGTH_BYTE_ARRAY": &parquet.DeltaLengthByteArray,
+	"DELTA_BYTE_ARRAY":        &parquet.DeltaByteArray,
+	"BYTE_STREAM_SPLIT":       &parquet.ByteStreamSplit,
+}
+
+// EncodingNames returns the encoding names accepted in WriterConfig encoding options, sorted.
+func EncodingNames() []string {
+	names := make([]string, 0, len(encodings))
+	for name := range encodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+encodeNode applies the encoding configured for column to the leaf node. A per-column encoding,
+including delta encoding for DeltaColumns, that cannot store the node's physical type is an
+error; the default encoding is simply skipped.
+Columns left without an encoding are dictionary-encoded when UseDictionary is set.
+*/
+func encodeNode(node parquet.Node, column string, config WriterConfig) (parquet.Node, error) {
+	kind := node.Type().Kind()
+	name, explicit := config.ColumnEncodings[column]
+	if slices.Contains(config.DeltaColumns, column) {
+		if explicit && strings.ToUpper(name) != "DELTA_BINARY_PACKED" {
+			return nil, fmt.Errorf("delta column %s is also configured with encoding %s", column, strings.ToUpper(name))
+		}
+		if kind != parquet.Int32 && kind != parquet.Int64 {
+			return nil, fmt.Errorf("delta column %s holds %s values, but delta encoding needs an integer or timestamp column", column, kind)
+		}
+		return parquet.Encoded(node, &parquet.DeltaBinaryPacked), nil
+	}
+	if !explicit {
+		name = config.DefaultEncodingType
+	}
+
+	if name != "" {
+		enc, ok := encodings[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown encoding %q (valid: %s)", name, strings.Join(EncodingNames(), ", "))
+		}
+		if canEncodeKind(enc, kind) {
+			return parquet.Encoded(node, enc), nil
+		}
+		if explicit {
+			return nil, fmt.Errorf("encoding %s cannot be used for %s values", strings.ToUpper(name), kind)
+		}
+	}
+
+	if config.UseDictionary && kind != parquet.Boolean {
+		// Booleans already pack to one bit per value, a dictionary can't beat that
+		return parquet.Encoded(node, &parquet.RLEDictionary), nil
+	}
+	return node, nil
+}
+
+// canEncodeKind reports whether enc supports values of the physical type kind.
+func canEncodeKind(enc encoding.Encoding, kind parquet.Kind) bool {
+	if enc == &parquet.RLEDictionary {
+		// Dictionary pages hold plain values and data pages hold indexes, so any type works
+		return true
+	}
+	switch kind {
+	case parquet.Boolean:
+		return encoding.CanEncodeBoolean(enc)
+	case parquet.Int32:
+		return encoding.CanEncodeInt32(enc)
+	case parquet.Int64:
+		return encoding.CanEncodeInt64(enc)
+	case parquet.Int96:
+		return encoding.CanEncodeInt96(enc)
+	case parquet.Float:
+		return encoding.CanEncodeFloat(enc)
+	case parquet.Double:
+		return encoding.CanEncodeDouble(enc)
+	case parquet.ByteArray:
+		return encoding.CanEncodeByteArray(enc)
+	case parquet.FixedLenByteArray:
+		return encoding.CanEncodeFixedLenByteArray(enc)
+	}
+	return false
+}
+
+// typeHintNodes maps the type names accepted in WriterConfig.TypeHints to their Parquet leaves.
+var typeHintNodes = map[string]parquet.Node{
+	"string":  parquet.String(),
+	"binary":  parquet.Leaf(parquet.ByteArrayType),
+	"int32":   parquet.Leaf(parquet.Int32Type),
+	"int64":   parquet.Leaf(parquet.Int64Type),
+	"float":   parquet.Leaf(parquet.FloatType),
+	"double":  parquet.Leaf(parquet.DoubleType),
+	"boolean": parquet.Leaf(parquet.BooleanType),
+}
+
+// TypeHintNames returns the type names accepted in WriterConfig.TypeHints, sorted.
+func TypeHintNames() []string {
+	names := make([]string, 0, len(typeHintNodes))
+	for name := range typeHintNodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// createLeafNode returns a Parquet leaf node for a given Go type.
+// Falls back to string for unknown or unsupported types.
+func createLeafNode(t reflect.Type) parquet.Node {
+	if t == numberType {
+		// JSON numbers are decoded as json.Number to keep their exact text
+		return parquet.Leaf(parquet.DoubleType)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return parquet.String()
+	case reflect.Float64:
+		return parquet.Leaf(parquet.DoubleType)
+	case reflect.Float32:
+		return parquet.Leaf(parquet.FloatType)
+	case reflect.Int, reflect.Int64:
+		return parquet.Leaf(parquet.Int64Type)
+	case reflect.Int32:
+		return parquet.Leaf(parquet.Int32Type)
+	case reflect.Bool:
+		return parquet.Leaf(parquet.BooleanType)
+	default:
+		// Default to string for unknown types
+		return parquet.String()
+	}
+}
+
+/*
+convertArraysToStrings converts any slice, map, or struct values to JSON strings to avoid mixed type issues.
+This follows the WWJD pattern from parquet-go tests and avoids known bugs #304, #268, #267, #185, #187.
+*/
+func convertArraysToStrings(row map[string]any) map[string]any {
+	convertedRow := make(map[string]any)
+	for key, value := range row {
+		if value == nil {
+			convertedRow[key] = nil
+			continue
+		}
+
+		t := reflect.TypeOf(value)
+		// Convert complex types (slices, maps, structs) to JSON strings for safety
+		// This avoids reflection panics and data corruption in the parquet library
+		switch t.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Struct:
+			// Convert complex types to JSON string for reliable storage
+			if jsonBytes, err := json.Marshal(value); err == nil {
+				convertedRow[key] = string(jsonBytes)
+			} else {
+				convertedRow[key] = fmt.Sprintf("%v", value)
+			}
+		default:
+			convertedRow[key] = value
+		}
+	}
+	return convertedRow
+}
+
+// sortKey is a column rows are ordered by before writing.
+type sortKey struct {
+	column     string
+	descending bool
+}
+
+// parseSortKeys parses --sort-by entries and checks that each column exists in schema.
+func parseSortKeys(specs []string, schema *parquet.Schema) ([]sortKey, error) {
+	keys := make([]sortKey, 0, len(specs))
+	for _, spec := range specs {
+		key := sortKey{column: spec}
+		if strings.HasPrefix(spec, "-") {
+			key = sortKey{column: spec[1:], descending: true}
+		}
+		if _, ok := schema.Lookup(key.column); !ok {
+			return nil, fmt.Errorf("sort column %q not found in inferred schema", key.column)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+/*
+sortRows orders rows by the given keys, and records, their input record numbers, along with
+them if not nil. The sort is stable, nulls and missing values always sort last regardless of
+direction, and mixed types are ordered by compareValues.
+*/
+func sortRows(rows []map[string]any, records []int, keys []sortKey) {
+	sort.Stable(rowSorter{rows: rows, records: records, keys: keys})
+}
+
+// rowSorter is the sort.Interface sortRows sorts with.
+type rowSorter struct {
+	rows    []map[string]any
+	records []int
+	keys    []sortKey
+}
+
+func (s rowSorter) Len() int { return len(s.rows) }
+
+func (s rowSorter) Swap(i, j int) {
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+	if s.records != nil {
+		s.records[i], s.records[j] = s.records[j], s.records[i]
+	}
+}
+
+func (s rowSorter) Less(i, j int) bool {
+	for _, key := range s.keys {
+		a, b := s.rows[i][key.column], s.rows[j][key.column]
+		switch {
+		case a == nil && b == nil:
+			continue
+		case a == nil:
+			return false
+		case b == nil:
+			return true
+		}
+
+		c := compareValues(a, b)
+		if c == 0 {
+			continue
+		}
+		if key.descending {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+/*
+ToParquet is the backward-compatible function for writing JSON to Parquet with performance improvements.
+Uses default configuration for typical use cases.
+*/
+func ToParquet(w io.Writer, r io.Reader) error {
+	config := DefaultWriterConfig()
+
+	// For small datasets or when memory is not a concern, use original approach
+	// but with optimizations
+	return toParquetOptimized(context.Background(), w, r, config)
+}
+
+/*
+AppendToParquet writes the row groups of existing followed by the JSON rows read from r to w.
+The new rows reuse the existing schema; fields it doesn't have, values of an incompatible type,
+or nulls in required columns are reported as errors. Every existing row is rewritten.
+*/
+func AppendToParquet(w io.Writer, existing *parquet.File, r io.Reader, config WriterConfig) error {
+	if config.AutoCodec || config.AutoTune {
+		// They'd judge the whole rewritten file by the new rows alone
+		return fmt.Errorf("AutoCodec and AutoTune cannot be used when appending")
+	}
+	var (
+		newRows []map[string]any
+		records []int
+	)
+	dec := newRowDecoder(stoppable(r, config.Stop), config.InvalidRow, config)
+	for read := int64(0); config.Limit <= 0 || read < config.Limit; read++ {
+		var row map[string]any
+		if err := dec.Decode(&row); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return decodeError(dec, err)
+		}
+		// Drop nulls so all-null columns don't get inferred as strings; missing keys are still written as null
+		converted := convertArraysToStrings(row)
+		for key, value := range converted {
+			if value == nil {
+				delete(converted, key)
+			}
+		}
+		newRows = append(newRows, converted)
+		newRows = keepTail(newRows, config.Tail)
+		records = append(records, dec.record)
+		records = keepTail(records, config.Tail)
+	}
+
+	schema := existing.Schema()
+	if len(newRows) > 0 {
+		inferred, err := buildOptimizedSchema(newRows, nil, config)
+		if err != nil {
+			return fmt.Errorf("building schema: %w", err)
+		}
+		if err := checkAppendSchema(schema, inferred); err != nil {
+			return err
+		}
+	}
+
+	writerConfig, err := newParquetWriterConfig(schema, config)
+	if err != nil {
+		return err
+	}
+	keepColumnMeta(writerConfig, existing)
+	keepBinaryMeta(writerConfig, existing, config.BinaryColumns)
+
+	writer := parquet.NewWriter(w, writerConfig)
+	for i, rowGroup := range existing.RowGroups() {
+		if _, err := writer.WriteRowGroup(rowGroup); err != nil {
+			return fmt.Errorf("copying existing row group %d: %w", i, err)
+		}
+	}
+
+	binary := fileBinaryColumns(existing, config.BinaryColumns)
+	coercer := newRowCoercer(schema, binary, config)
+	guard, err := newRequiredGuard(schema, binary, config)
+	if err != nil {
+		return err
+	}
+	flusher := newRowGroupFlusher(config)
+	for i, row := range newRows {
+		if ok, err := guard.admit(records[i], row); !ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		row, err := coercer.coerce(row)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", records[i], err)
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("writing row to parquet: %w", err)
+		}
+		if err := flusher.wrote(writer, row); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// checkAppendSchema reports whether rows with the inferred schema can be written with existing.
+func checkAppendSchema(existing, inferred *parquet.Schema) error {
+	if err := checkSchemaFits(existing, inferred, false); err != nil {
+		return fmt.Errorf("cannot append: %w", err)
+	}
+	return nil
+}
+
+/*
+checkSchemaFits reports the first reason rows with the inferred schema can't be written with
+existing. JSON numbers are inferred as DOUBLE but convert exactly into INT64 columns; loose also
+lets integers widen into DOUBLE columns and string columns take any scalar, spelled out as text.
+*/
+func checkSchemaFits(existing, inferred *parquet.Schema, loose bool) error {
+	for _, field := range inferred.Fields() {
+		target, ok := existing.Lookup(field.Name())
+		if !ok {
+			return fmt.Errorf("field %q is not in the existing schema", field.Name())
+		}
+		if !target.Node.Leaf() {
+			return fmt.Errorf("field %q is a nested group in the existing schema", field.Name())
+		}
+
+		have, want := field.Type().Kind(), target.Node.Type().Kind()
+		numeric := have == parquet.Double && want == parquet.Int64 || loose && have == parquet.Int64 && want == parquet.Double
+		text := loose && field.Leaf() && isStringNode(target.Node)
+		if have != want && !numeric && !text && !isDecimalNode(target.Node) {
+			return fmt.Errorf("field %q is %s in the new data but %s in the existing schema", field.Name(), have, want)
+		}
+		if field.Optional() && target.Node.Required() {
+			return fmt.Errorf("field %q has nulls but is required in the existing schema", field.Name())
+		}
+	}
+
+	for _, field := range existing.Fields() {
+		if _, ok := inferred.Lookup(field.Name()); !ok && field.Required() {
+			return fmt.Errorf("required field %q is missing from the new data", field.Name())
+		}
+	}
+	return nil
+}
+
+// isStringNode reports whether node is annotated with the STRING logical type.
+func isStringNode(node parquet.Node) bool {
+	lt := node.Type().LogicalType()
+	return lt != nil && lt.UTF8 != nil
+}
+
+// isDecimalNode reports whether node is annotated with the DECIMAL logical type.
+func isDecimalNode(node parquet.Node) bool {
+	lt := node.Type().LogicalType()
+	return lt != nil && lt.Decimal != nil
+}
+
+/*
+ToParquetWithConfig wraps ToParquet with a custom WriterConfig.
+It allows fine-tuned control over Parquet writing parameters.
+*/
+func ToParquetWithConfig(w io.Writer, r io.Reader, config WriterConfig) error {
+	return ToParquetContext(context.Background(), w, r, config)
+}
+
+/*
+ToParquetContext is ToParquetWithConfig with cancellation: it returns ctx's error once ctx
+is done, checking between reads of the input and between written batches.
+*/
+func ToParquetContext(ctx context.Context, w io.Writer, r io.Reader, config WriterConfig) error {
+	return toParquetOptimized(ctx, w, r, config)
+}
+
+/*
+toParquetOptimized implements the core logic for converting JSON to Parquet efficiently.
+Streams input to a temp file, infers schema, and writes in optimized batches.
+*/
+func toParquetOptimized(ctx context.Context, w io.Writer, r io.Reader, config WriterConfig) error {
+	allRows, records, order, err := readAllRows(ctx, r, config, func(replay io.Reader, config WriterConfig) error {
+		if len(config.SortBy) > 0 || config.Verify {
+			return fmt.Errorf("the input outgrew the %d-byte memory budget, and sorting and verifying need every row in memory", config.MaxMemory)
+		}
+		// Every row counts for the schema in memory, so fields past the streaming sample must too
+		config.EvolveSchema = true
+		return StreamingToParquetContext(ctx, w, replay, config)
+	})
+	if err != nil {
+		return err
+	}
+	if len(allRows) == 0 {
+		return nil // Empty input is valid, or the streaming writer took over
+	}
+
+	// Build optimized schema
+	schema, err := buildOptimizedSchema(allRows, order, config)
+	if err != nil {
+		return fmt.Errorf("building schema: %w", err)
+	}
+	if err := dumpSchema(schema, config); err != nil {
+		return err
+	}
+	if allRows, records, err = admitRows(allRows, records, schema, config); err != nil {
+		return err
+	}
+	if config, err = chooseWriterSettings(allRows, schema, config); err != nil {
+		return err
+	}
+	writerConfig, err := newParquetWriterConfig(schema, config)
+	if err != nil {
+		return err
+	}
+	return writeVerifiedRows(ctx, w, allRows, records, schema, writerConfig, config)
+}
+
+/*
+overBudgetFunc takes over a conversion whose rows outgrew WriterConfig.MaxMemory. replay reads
+the whole input again, and config no longer reports the invalid rows that were already reported.
+*/
+type overBudgetFunc func(replay io.Reader, config WriterConfig) error
+
+// rowMemoryOverhead is roughly how many times its JSON size a decoded row takes in memory.
+const rowMemoryOverhead = 4
+
+/*
+readAllRows decodes every JSON row of r, spooling the input through a temp file unless
+config.NoTemp is set. It returns the rows with arrays converted to strings, the input record
+number of each, which differ from their positions once rows are skipped, and the field order.
+With config.MaxMemory set, overBudget is handed the input instead once the rows outgrow it,
+and readAllRows returns no rows and overBudget's error.
+*/
+func readAllRows(ctx context.Context, r io.Reader, config WriterConfig, overBudget overBudgetFunc) ([]map[string]any, []int, []string, error) {
+	// A seekable input is already a file, and with a limit only the first rows are read,
+	// straight from the input; spooling it all would wait for a stream that may never end
+	input, start, seekable := seekableStart(r)
+	r = contextReader{ctx: ctx, r: stoppable(r, config.Stop)}
+	budget := config.MaxMemory
+	if overBudget == nil || config.Tail > 0 {
+		// The rows kept for Tail take bounded memory, and the streaming writer can't keep them
+		budget = 0
+	}
+
+	var replay func() (io.Reader, error)
+	switch {
+	case !config.NoTemp && config.Limit <= 0 && !seekable:
+		// Create a temporary file to store JSON data
+		tempFile, err := os.CreateTemp(config.TempDir, "parqat_temp_*.json")
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("creating temp file: %w", err)
+		}
+		defer removeTemp(tempFile, config)
+
+		// Stream JSON from stdin to temp file
+		if _, err := io.Copy(tempFile, r); err != nil {
+			return nil, nil, nil, fmt.Errorf("copying input to temp file: %w", err)
+		}
+
+		// Rewind temp file for reading
+		if _, err := tempFile.Seek(0, 0); err != nil {
+			return nil, nil, nil, fmt.Errorf("seeking temp file: %w", err)
+		}
+		r = tempFile
+		replay = func() (io.Reader, error) {
+			_, err := tempFile.Seek(0, io.SeekStart)
+			return tempFile, err
+		}
+	case seekable:
+		replay = func() (io.Reader, error) {
+			_, err := input.Seek(start, io.SeekStart)
+			return input, err
+		}
+	case budget > 0 && config.NoTemp:
+		return nil, nil, nil, fmt.Errorf("a memory budget on input that can't be read twice needs a temp file to read it again, which NoTemp rules out")
+	case budget > 0:
+		// The stream can't be read twice, so keep what is read in case it has to be
+		tempFile, err := os.CreateTemp(config.TempDir, "parqat_temp_*.json")
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("creating temp file: %w", err)
+		}
+		defer removeTemp(tempFile, config)
+
+		rest := r
+		r = io.TeeReader(r, tempFile)
+		replay = func() (io.Reader, error) {
+			_, err := tempFile.Seek(0, io.SeekStart)
+			return io.MultiReader(tempFile, rest), err
+		}
+	}
+
+	// Read all JSON rows to determine schema
+	var (
+		allRows []map[string]any
+		records []int
+		orders  [][]string // the field order of each kept row, with Tail
+	)
+	dec := newRowDecoder(r, config.InvalidRow, config)
+	order := newFieldOrder()
+
+	for read := int64(0); config.Limit <= 0 || read < config.Limit; read++ {
+		rowOrder := order
+		if config.Tail > 0 {
+			// Rows that don't make the tail mustn't decide the order of the fields
+			rowOrder = newFieldOrder()
+		}
+		row, err := decodeOrderedRow(dec, rowOrder)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, nil, decodeError(dec, err)
+		}
+		// Convert arrays to strings before schema inference
+		convertedRow := convertArraysToStrings(row)
+		allRows = append(allRows, convertedRow)
+		allRows = keepTail(allRows, config.Tail)
+		records = append(records, dec.record)
+		records = keepTail(records, config.Tail)
+		if config.Tail > 0 {
+			orders = keepTail(append(orders, rowOrder.names), config.Tail)
+		}
+
+		// Once stopped the input ends soon, and what was read of it stays in memory
+		if budget > 0 && dec.InputOffset()*rowMemoryOverhead > budget && !stopped(config.Stop) {
+			allRows = nil // Let the rows go before the input is read again
+			input, err := replay()
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("rewinding input: %w", err)
+			}
+			seen := dec.record
+			if report := config.InvalidRow; report != nil {
+				config.InvalidRow = func(err *DecodeError) {
+					if err.Record > seen {
+						report(err)
+					}
+				}
+			}
+			if report := config.DuplicateRow; report != nil {
+				config.DuplicateRow = func(record int) {
+					if record > seen {
+						report(record)
+					}
+				}
+			}
+			if report := config.DroppedKey; report != nil {
+				config.DroppedKey = func(record int, kept, dropped string) {
+					if record > seen {
+						report(record, kept, dropped)
+					}
+				}
+			}
+			return nil, nil, nil, overBudget(input, config)
+		}
+	}
+	for _, names := range orders {
+		for _, name := range names {
+			order.add(name, nil)
+		}
+	}
+	return allRows, records, order.names, nil
+}
+
+/*
+keepTail drops the first row of rows once they are more than tail (when positive). The rows
+dropped stay in the backing array only until append next grows it, so memory stays bounded.
+*/
+func keepTail[T any](rows []T, tail int64) []T {
+	if tail > 0 && int64(len(rows)) > tail {
+		var zero T
+		rows[0] = zero
+		return rows[1:]
+	}
+	return rows
+}
+
+// recordNumber returns the input record number of rows[i], given records as readAllRows returns them, or i+1 without.
+func recordNumber(records []int, i int) int {
+	if records == nil {
+		return i + 1
+	}
+	return records[i]
+}
+
+/*
+writeVerifiedRows is writeRows that, when config.Verify is set, builds the file in memory and
+checks it with verifyParquet before anything reaches w, so a bad file is never shipped.
+*/
+func writeVerifiedRows(ctx context.Context, w io.Writer, rows []map[string]any, records []int, schema *parquet.Schema, writerConfig *parquet.WriterConfig, config WriterConfig) error {
+	if !config.Verify {
+		return writeRows(ctx, w, rows, records, schema, writerConfig, config)
+	}
+
+	var buf bytes.Buffer
+	if err := writeRows(ctx, &buf, rows, records, schema, writerConfig, config); err != nil {
+		return err
+	}
+	if err := verifyParquet(buf.Bytes(), rows, records, schema, config); err != nil {
+		return fmt.Errorf("verifying output: %w", err)
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+/*
+verifyParquet reads Parquet data back and checks that it holds exactly rows, in order, as they
+were handed to the writer (after array-to-string conversion and type coercion). It reports the
+first row that differs.
+*/
+func verifyParquet(data []byte, rows []map[string]any, records []int, schema *parquet.Schema, config WriterConfig) error {
+	pr, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("reopening written data: %w", err)
+	}
+	if pr.NumRows() != int64(len(rows)) {
+		return fmt.Errorf("wrote %d rows, read back %d", len(rows), pr.NumRows())
+	}
+
+	coercer := newRowCoercer(schema, rawByteColumns(schema), config)
+	fields := schema.Fields()
+	index := 0
+	return readRows(context.Background(), pr, DefaultReaderConfig(), func(row any) error {
+		got, _ := row.(map[string]any)
+		record := recordNumber(records, index)
+		want, err := coercer.coerce(convertArraysToStrings(rows[index]))
+		if err != nil {
+			return fmt.Errorf("record %d: %w", record, err)
+		}
+		index++
+
+		for _, field := range fields {
+			name := field.Name()
+			if !reflect.DeepEqual(verifiableValue(want[name]), verifiableValue(got[name])) {
+				return fmt.Errorf("record %d: field %s: wrote %v, read back %v", record, name, want[name], got[name])
+			}
+		}
+		return nil
+	})
+}
+
+// verifiableValue maps a value to a form that compares equal to the generic reader's.
+func verifiableValue(value any) any {
+	switch v := value.(type) {
+	case [16]byte:
+		return string(v[:])
+	case []byte:
+		return string(v) // Byte arrays come back as strings
+	}
+	return value
+}
+
+/*
+writeRows writes rows to w as one Parquet file with schema, sorting them first if configured.
+writerConfig is newParquetWriterConfig's for schema and config, built once by the caller for
+every file written with them.
+*/
+func writeRows(ctx context.Context, w io.Writer, allRows []map[string]any, records []int, schema *parquet.Schema, writerConfig *parquet.WriterConfig, config WriterConfig) error {
+	coercer := newRowCoercer(schema, rawByteColumns(schema), config)
+
+	if err := sortForWriting(allRows, records, schema, config, writerConfig); err != nil {
+		return err
+	}
+
+	writer := parquet.NewWriter(w, writerConfig)
+	flusher := newRowGroupFlusher(config)
+
+	// Write all rows in batches for better performance
+	batchSize, err := batchRows(config, 262144) // 2^18 - SIMD-optimized batch processing
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(allRows); i += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(i+batchSize, len(allRows))
+		batch := allRows[i:end]
+		for j, row := range batch {
+			// Convert array values to strings for reliable parquet storage
+			row, err := coercer.coerce(convertArraysToStrings(row))
+			if err != nil {
+				return fmt.Errorf("record %d: %w", recordNumber(records, i+j), err)
+			}
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("writing row to parquet: %w", err)
+			}
+			if err := flusher.wrote(writer, row); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writer.Close()
+}
+
+// sortForWriting sorts rows by config.SortBy, if set, and records the order in writerConfig.
+func sortForWriting(rows []map[string]any, records []int, schema *parquet.Schema, config WriterConfig, writerConfig *parquet.WriterConfig) error {
+	if len(config.SortBy) == 0 {
+		return nil
+	}
+	keys, err := parseSortKeys(config.SortBy, schema)
+	if err != nil {
+		return err
+	}
+	sortRows(rows, records, keys)
+
+	// Record the order in the footer so readers know the row groups are sorted
+	columns := make([]parquet.SortingColumn, len(keys))
+	for i, key := range keys {
+		if key.descending {
+			columns[i] = parquet.Descending(key.column)
+		} else {
+			columns[i] = parquet.Ascending(key.column)
+		}
+	}
+	writerConfig.Sorting.SortingColumns = columns
+	return nil
+}
+
+/*
+requiredGuard keeps nulls out of required columns once WriterConfig.RequiredThreshold allows
+nulls in the sample of a required column. parquet-go would write such a null as the zero value,
+so each row is checked before it is written and either refused or dropped. Nulls in columns with
+a WriterConfig.Defaults entry are replaced with the default first.
+*/
+type requiredGuard struct {
+	columns   []string
+	drop      bool
+	dropped   func(record int, err error)
+	defaults  map[string]any
+	defaulted func(record int, field string)
+}
+
+// newRequiredGuard returns the guard for schema, or nil when config.RequiredThreshold is 0 and there are no defaults.
+func newRequiredGuard(schema *parquet.Schema, binary map[string]bool, config WriterConfig) (*requiredGuard, error) {
+	if config.RequiredThreshold < 0 || config.RequiredThreshold > 1 {
+		return nil, fmt.Errorf("required threshold %g out of range (0-1)", config.RequiredThreshold)
+	}
+	if config.OnRequiredNull != "" && config.OnRequiredNull != RequiredNullError && config.OnRequiredNull != RequiredNullDrop {
+		return nil, fmt.Errorf("unknown required null policy %q", config.OnRequiredNull)
+	}
+	defaults, err := parseDefaults(schema, binary, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.RequiredThreshold == 0 && defaults == nil {
+		return nil, nil
+	}
+
+	g := &requiredGuard{
+		drop:      config.OnRequiredNull == RequiredNullDrop,
+		dropped:   config.DroppedRow,
+		defaults:  defaults,
+		defaulted: config.Defaulted,
+	}
+	for _, field := range schema.Fields() {
+		if field.Required() {
+			g.columns = append(g.columns, field.Name())
+		}
+	}
+	return g, nil
+}
+
+/*
+parseDefaults decodes the values of config.Defaults and checks that each converts to the type of
+its column in schema, returning them by field name, or nil if there are none.
+*/
+func parseDefaults(schema *parquet.Schema, binary map[string]bool, config WriterConfig) (map[string]any, error) {
+	if len(config.Defaults) == 0 {
+		return nil, nil
+	}
+	defaults := make(map[string]any, len(config.Defaults))
+	for name, text := range config.Defaults {
+		var value any = text
+		dec := newJSONDecoder(strings.NewReader(text))
+		var decoded any
+		if err := dec.Decode(&decoded); err == nil && !dec.More() && decoded != nil {
+			switch decoded.(type) {
+			case map[string]any, []any:
+			default:
+				value = decoded
+			}
+		}
+
+		field, ok := schema.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("default for field %q, which is not in the schema", name)
+		}
+		if !field.Node.Leaf() {
+			return nil, fmt.Errorf("default for field %q, which is a nested group", name)
+		}
+		if coerce := columnCoercer(name, field.Node.Type(), binary, config); coerce != nil {
+			if _, err := coerce(value); err != nil {
+				return nil, fmt.Errorf("default %s for field %q doesn't fit its %s column: %w", text, name, field.Node.Type().Kind(), err)
+			}
+		}
+		defaults[name] = value
+	}
+	return defaults, nil
+}
+
+// admit reports whether row, the record-th of the input, may be written, filling in defaults.
+func (g *requiredGuard) admit(record int, row map[string]any) (bool, error) {
+	if g == nil {
+		return true, nil
+	}
+	for name, value := range g.defaults {
+		if row[name] == nil {
+			row[name] = value
+			if g.defaulted != nil {
+				g.defaulted(record, name)
+			}
+		}
+	}
+	for _, name := range g.columns {
+		if row[name] != nil {
+			continue
+		}
+		err := fmt.Errorf("record %d: field %q is null but the column is required", record, name)
+		if !g.drop {
+			return false, err
+		}
+		if g.dropped != nil {
+			g.dropped(record, err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// admitRows returns the rows of allRows the guard for schema lets through.
+func admitRows(allRows []map[string]any, records []int, schema *parquet.Schema, config WriterConfig) ([]map[string]any, []int, error) {
+	guard, err := newRequiredGuard(schema, rawByteColumns(schema), config)
+	if err != nil || guard == nil {
+		return allRows, records, err
+	}
+	kept, keptRecords := allRows[:0], records[:0]
+	for i, row := range allRows {
+		ok, err := guard.admit(records[i], row)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			kept, keptRecords = append(kept, row), append(keptRecords, records[i])
+		}
+	}
+	return kept, keptRecords, nil
+}
+
+/*
+ToParquetPartitioned writes JSON rows from r as a Hive-style dataset under dir: one
+dir/column=value/part.parquet file per distinct value of config.PartitionBy.
+*/
+func ToParquetPartitioned(dir string, r io.Reader, config WriterConfig) error {
+	return ToParquetPartitionedContext(context.Background(), dir, r, config)
+}
+
+/*
+ToParquetPartitionedContext is ToParquetPartitioned with cancellation. Every partition shares
+the schema inferred from the whole input, so the files form one consistent dataset. Rows are
+grouped in memory and the partitions written in parallel, with no more than config.MaxOpenFiles
+files open at a time no matter how many partitions there are. After a partition fails, no more
+are started, and the first failure in partition order is returned.
+*/
+func ToParquetPartitionedContext(ctx context.Context, dir string, r io.Reader, config WriterConfig) error {
+	column := config.PartitionBy
+	if column == "" {
+		return fmt.Errorf("no partition column configured")
+	}
+
+	allRows, records, order, err := readAllRows(ctx, r, config, func(io.Reader, WriterConfig) error {
+		return fmt.Errorf("the input outgrew the %d-byte memory budget, and partitioning needs every row in memory", config.MaxMemory)
+	})
+	if err != nil {
+		return err
+	}
+	if len(allRows) == 0 {
+		return nil // Empty input is valid
+	}
+
+	rowPartitions := make([]string, len(allRows))
+	for i, row := range allRows {
+		rowPartitions[i] = column + "=" + partitionValue(row[column])
+		if !config.KeepPartitionColumn {
+			// The value lives in the directory name
+			delete(row, column)
+		}
+	}
+	if !config.KeepPartitionColumn {
+		order = slices.DeleteFunc(slices.Clone(order), func(name string) bool { return name == column })
+	}
+
+	schema, err := buildOptimizedSchema(allRows, order, config)
+	if err != nil {
+		return fmt.Errorf("building schema: %w", err)
+	}
+	if err := dumpSchema(schema, config); err != nil {
+		return err
+	}
+	if config, err = chooseWriterSettings(allRows, schema, config); err != nil {
+		return err
+	}
+	guard, err := newRequiredGuard(schema, rawByteColumns(schema), config)
+	if err != nil {
+		return err
+	}
+	writerConfig, err := newParquetWriterConfig(schema, config) // The same for every partition
+	if err != nil {
+		return err
+	}
+
+	// Group rows by partition directory, keeping first-seen partition order
+	partitions := make(map[string][]map[string]any)
+	partitionRecords := make(map[string][]int)
+	var names []string
+	for i, row := range allRows {
+		if ok, err := guard.admit(records[i], row); !ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		name := rowPartitions[i]
+		if _, ok := partitions[name]; !ok {
+			names = append(names, name)
+		}
+		partitions[name] = append(partitions[name], row)
+		partitionRecords[name] = append(partitionRecords[name], records[i])
+	}
+
+	workers := config.MaxOpenFiles
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Bool
+		errs   = make([]error, len(names))
+		next   = make(chan int)
+	)
+	for range min(workers, len(names)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if failed.Load() {
+					continue
+				}
+				// Sorting records its order in the writer config, so each file gets a copy
+				partConfig := *writerConfig
+				name := names[i]
+				if err := writePartition(ctx, filepath.Join(dir, name), partitions[name], partitionRecords[name], schema, &partConfig, config); err != nil {
+					errs[i] = fmt.Errorf("partition %s: %w", name, err)
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := range names {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePartition writes rows to partDir/part.parquet, creating the directory as needed.
+func writePartition(ctx context.Context, partDir string, rows []map[string]any, records []int, schema *parquet.Schema, writerConfig *parquet.WriterConfig, config WriterConfig) error {
+	if err := os.MkdirAll(partDir, 0o755); err != nil {
+		return fmt.Errorf("creating partition directory: %w", err)
+	}
+
+	file, err := os.Create(filepath.Join(partDir, "part.parquet"))
+	if err != nil {
+		return fmt.Errorf("creating partition file: %w", err)
+	}
+	defer file.Close()
+
+	if err := writeVerifiedRows(ctx, file, rows, records, schema, writerConfig, config); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("closing partition file: %w", err)
+	}
+	return nil
+}
+
+// hiveDefaultPartition names the partition of rows whose partition value is null, missing or empty.
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+/*
+partitionValue renders a partition column value for use in a directory name. Characters that
+are unsafe in paths (separators, '=', '%', control characters, ...) are percent-escaped the way
+Hive does, and "." / ".." can't occur because dots are escaped when they make up the whole value.
+*/
+func partitionValue(value any) string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return hiveDefaultPartition
+	case string:
+		text = v
+	default:
+		text = fmt.Sprint(v)
+	}
+	if text == "" {
+		return hiveDefaultPartition
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte(`"#%'*/:=?\{[]^`, c) >= 0 || (c == '.' && strings.Trim(text, ".") == "") {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}